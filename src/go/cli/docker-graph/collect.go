@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/hosts"
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+const (
+	// connectionCheckInterval is the delay between two checks of the connections while collecting.
+	connectionCheckInterval = 100 * time.Millisecond
+)
+
+// collectGraph connects to the Docker hosts, waits for them to be synchronized and returns a snapshot of the graph.
+// It fails as soon as the first connection to a host fails.
+func collectGraph(ctx context.Context, timeout time.Duration) (g graph.Graph, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	spv := newSupervisor()
+	dispatcher := utils.NewDispatcher[api.Event]("events")
+	spv.Add(dispatcher)
+	done := spv.ServeBackground(ctx)
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Subscribe before starting the hosts, so no "synced" event is missed
+	events, unsubscribe := dispatcher.SubscribeWithoutHooks()
+	defer unsubscribe()
+
+	source, err := addHosts(spv, dispatcher, nil)
+	if err != nil {
+		return
+	}
+	pending := make(map[string]*hosts.Host, len(source.Hosts))
+	for _, host := range source.Hosts {
+		pending[host.Name] = host
+	}
+
+	ticker := time.NewTicker(connectionCheckInterval)
+	defer ticker.Stop()
+	for len(pending) > 0 {
+		select {
+		case event := <-events:
+			if control, ok := event.(*api.ControlEvent); ok && control.Type == "synced" {
+				delete(pending, control.Host)
+			}
+		case <-ticker.C:
+			for name, host := range pending {
+				status := host.Connection.Status()
+				if status.State == connections.StateConnecting && status.LastError != "" {
+					return g, fmt.Errorf("%s: %s", name, status.LastError)
+				}
+			}
+		case <-ctx.Done():
+			names := make([]string, 0, len(pending))
+			for name := range pending {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return g, fmt.Errorf("timeout waiting for %s: %w", strings.Join(names, ", "), ctx.Err())
+		}
+	}
+
+	return source.Snapshot(), nil
+}
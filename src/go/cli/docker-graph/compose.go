@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/compose"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+)
+
+type (
+	// stringList is a flag that can be repeated.
+	stringList []string
+)
+
+var (
+	_ flag.Value = (*stringList)(nil)
+)
+
+const (
+	// composeHost is the host of the containers declared by the compose files.
+	composeHost = "compose"
+)
+
+// runCompose implements the "compose" command, that previews the graph of compose files,
+// or compares them with the running containers.
+func runCompose(ctx context.Context, args []string) int {
+	var opts compose.Options
+	flags := flag.NewFlagSet("compose", flag.ExitOnError)
+	flags.Var((*stringList)(&opts.Files), "f", "Compose file (can be repeated, defaults to the compose file of the current directory)")
+	flags.StringVar(&opts.ProjectName, "p", "", "Project name")
+	flags.StringVar(&opts.ProjectDir, "projectDir", "", "Project directory (defaults to the directory of the first file)")
+	flags.Var((*stringList)(&opts.Profiles), "profile", "Profile to enable (can be repeated)")
+	flags.StringVar(&opts.EnvFile, "envFile", "", "Environment file (defaults to the .env file of the project directory)")
+	diff := flags.Bool("diff", false, "Compare the declared containers with the ones of the Docker hosts")
+	diffHost := flags.String("host", "", "Only compare the containers of this Docker host, with -diff")
+	formatName := flags.String("format", "", "Output format (preview: "+strings.Join(snapshotFormatNames(), ", ")+"; diff: text, json)")
+	timeout := flags.Duration("timeout", 30*time.Second, "Maximum time to wait for the Docker hosts, with -diff")
+	flags.Parse(args)
+
+	project, err := compose.Load(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load the project: %s\n", err)
+		return 2
+	}
+
+	if *diff {
+		return composeDiff(ctx, project, *diffHost, *formatName, *timeout)
+	}
+
+	if *formatName == "" {
+		*formatName = "tree"
+	}
+	write, found := snapshotFormat(*formatName)
+	if !found {
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *formatName)
+		return 2
+	}
+	g, err := project.Graph(composeHost)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid project: %s\n", err)
+		return 2
+	}
+	if err := write(os.Stdout, g, false); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write the graph: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func composeDiff(ctx context.Context, project *compose.Project, host, formatName string, timeout time.Duration) int {
+	var write func(io.Writer, compose.Diff) error
+	switch formatName {
+	case "", "text":
+		write = writeDiffText
+	case "json":
+		write = writeDiffJSON
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", formatName)
+		return 2
+	}
+
+	g, err := collectGraph(ctx, timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not collect the graph: %s\n", err)
+		return 1
+	}
+	diff, err := project.Diff(g.Containers, host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid project: %s\n", err)
+		return 2
+	}
+	if err := write(os.Stdout, diff); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write the diff: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func writeDiffText(w io.Writer, diff compose.Diff) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "Project %s (%s)\n", diff.Project, diff.WorkingDir)
+	writeDiffSection(buf, "Running", diff.Running)
+	writeDiffSection(buf, "Declared but not running", diff.NotRunning)
+	writeDiffSection(buf, "Running but not declared", diff.NotDeclared)
+	return buf.Flush()
+}
+
+func writeDiffSection(w io.Writer, title string, list []containers.Container) {
+	fmt.Fprintf(w, "%s: %d\n", title, len(list))
+	for _, ctn := range list {
+		fmt.Fprintf(w, "  %s (%s, %s)", ctn.Name, ctn.Service, ctn.Image)
+		if ctn.Host != "" {
+			fmt.Fprintf(w, " on %s", ctn.Host)
+		}
+		if ctn.Status != compose.DeclaredStatus && !ctn.Status.IsRunning() {
+			fmt.Fprintf(w, " %s", ctn.Status)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func writeDiffJSON(w io.Writer, diff compose.Diff) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diff)
+}
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
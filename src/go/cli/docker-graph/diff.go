@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/history"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+// runDiff implements the "diff" command, that compares the containers at two times, from the history file.
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	path := flags.String("history", historyFile, "History file written by the server")
+	fromValue := flags.String("from", "", "Start time (RFC 3339, date, or duration before now like 2h)")
+	toValue := flags.String("to", "now", "End time")
+	formatName := flags.String("format", "text", "Output format (text, json)")
+	flags.Parse(args)
+
+	var write func(io.Writer, history.Diff) error
+	switch *formatName {
+	case "text":
+		write = writeChangesText
+	case "json":
+		write = writeChangesJSON
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *formatName)
+		return 2
+	}
+
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "the history file is required")
+		return 2
+	}
+	now := time.Now()
+	from, err := utils.ParseTime(*fromValue, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -from: %s\n", err)
+		return 2
+	}
+	to, err := utils.ParseTime(*toValue, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -to: %s\n", err)
+		return 2
+	}
+	if to.Before(from) {
+		fmt.Fprintln(os.Stderr, "-to is before -from")
+		return 2
+	}
+
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "could not read the history: %s\n", err)
+		return 1
+	}
+	diff, err := history.NewStore(*path, nil).Diff(from, to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read the history: %s\n", err)
+		return 1
+	}
+	if err := write(os.Stdout, diff); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write the diff: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func writeChangesText(w io.Writer, diff history.Diff) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "Changes from %s to %s\n", diff.From.Format(time.RFC3339), diff.To.Format(time.RFC3339))
+	writeContainerSection(buf, "Added", "+", diff.Added)
+	writeContainerSection(buf, "Removed", "-", diff.Removed)
+	fmt.Fprintf(buf, "Changed: %d\n", len(diff.Changed))
+	for _, changed := range diff.Changed {
+		fmt.Fprintf(buf, "  ~ %s/%s\n", changed.Host, changed.Name)
+		for _, change := range changed.Changes {
+			fmt.Fprintf(buf, "      %s: %s -> %s\n", change.Field, changeValue(change.From), changeValue(change.To))
+		}
+	}
+	return buf.Flush()
+}
+
+func writeContainerSection(w io.Writer, title, mark string, list []containers.Container) {
+	fmt.Fprintf(w, "%s: %d\n", title, len(list))
+	for _, ctn := range list {
+		fmt.Fprintf(w, "  %s %s/%s (%s, %s)\n", mark, ctn.Host, ctn.Name, ctn.Image, ctn.Status)
+	}
+}
+
+func changeValue(value any) string {
+	switch value := value.(type) {
+	case string:
+		if value == "" {
+			return "none"
+		}
+		return value
+	case []string:
+		if len(value) == 0 {
+			return "none"
+		}
+		return strings.Join(value, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+func writeChangesJSON(w io.Writer, diff history.Diff) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diff)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/export"
+)
+
+// runExport implements the "export" command, that prints the current graph of the Docker hosts.
+func runExport(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := flags.String("format", "dot", "Output format ("+strings.Join(export.FormatNames(), ", ")+")")
+	hideStopped := flags.Bool("hideStopped", false, "Exclude the containers that are not running")
+	timeout := flags.Duration("timeout", 30*time.Second, "Maximum time to wait for the Docker hosts")
+	flags.Parse(args)
+
+	format, found := export.Formats[*formatName]
+	if !found {
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *formatName)
+		return 2
+	}
+
+	g, err := collectGraph(ctx, *timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not collect the graph: %s\n", err)
+		return 1
+	}
+
+	if err := format.Write(os.Stdout, export.Build(g, export.Options{HideStopped: *hideStopped})); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write the graph: %s\n", err)
+		return 1
+	}
+	return 0
+}
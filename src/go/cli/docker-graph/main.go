@@ -3,33 +3,81 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/compose"
 	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
 	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/hosts"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/images"
 	"github.com/adirelle/docker-graph/src/go/lib/docker/listeners"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/networks"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/stats"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/swarm"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/volumes"
+	"github.com/adirelle/docker-graph/src/go/lib/export"
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+	"github.com/adirelle/docker-graph/src/go/lib/history"
 	"github.com/adirelle/docker-graph/src/go/lib/logging"
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
 	"github.com/adirelle/docker-graph/src/go/lib/utils"
-	"github.com/docker/docker/client"
 	log "github.com/inconshreveable/log15"
 	"github.com/thejerf/suture/v4"
 )
 
 var (
 	Log = log.New()
+
+	volumeUsageInterval time.Duration
+	statsInterval       time.Duration
+	swarmMode           bool
+	journalSize         int
+	historyFile         string
+	endpoints           connections.Endpoints
+)
+
+const (
+	// statsBuffer is the number of stats that a client of the event streams can lag behind.
+	statsBuffer = 256
 )
 
+func init() {
+	flag.DurationVar(&connections.DefaultPingInterval, "pingInterval", connections.DefaultPingInterval, "Interval between checks of the Docker daemons")
+	flag.DurationVar(&connections.DefaultBackoff.Min, "reconnectMin", connections.DefaultBackoff.Min, "Minimum delay before reconnecting to a Docker daemon")
+	flag.DurationVar(&connections.DefaultBackoff.Max, "reconnectMax", connections.DefaultBackoff.Max, "Maximum delay before reconnecting to a Docker daemon")
+	flag.Var(&endpoints, "host", "Docker host to connect to, as name=url (can be repeated, defaults to the environment settings)")
+	flag.IntVar(&journalSize, "journalSize", api.DefaultJournalSize, "Number of events kept to resume event streams")
+	flag.Var(&containers.GroupingsFlag{Target: &containers.ActiveGroupings}, "group", "Labels to group the containers by, from the top level, separated by commas (can be repeated)")
+	flag.Var(&containers.EnvAllowList, "envAllow", "Pattern of the environment variables whose values are exposed, like LC_* (can be repeated, added to the defaults ; an empty pattern removes the previous ones)")
+	flag.StringVar(&historyFile, "history", "", "File to record the events into, to query the past states of the graph (disabled by default)")
+	flag.DurationVar(&history.DefaultRetention, "historyRetention", history.DefaultRetention, "How long the events are kept in the history file (0 to keep them all)")
+	flag.DurationVar(&volumeUsageInterval, "volumeUsage", 0, "Interval between volume size refreshes (0 to disable)")
+	flag.DurationVar(&statsInterval, "stats", 0, "Interval between the resource usage updates of the running containers (0 to disable)")
+	flag.BoolVar(&swarmMode, "swarm", false, "Track the swarm nodes, services, tasks, configs and secrets of the manager hosts")
+	flag.DurationVar(&swarm.DefaultTaskInterval, "taskInterval", swarm.DefaultTaskInterval, "Interval between swarm task refreshes (0 to disable)")
+}
+
 func main() {
 	webLogger := Log.New(logging.ModuleKey, "webserver")
 	utils.Log = Log.New(logging.ModuleKey, "dispatcher")
+	compose.Log = Log.New(logging.ModuleKey, "compose")
+	history.Log = Log.New(logging.ModuleKey, "history")
 
 	dockerLogger := Log.New(logging.ModuleKey, "docker")
 	connections.Log = dockerLogger.New(logging.ModuleKey, "connections")
 	containers.Log = dockerLogger.New(logging.ModuleKey, "containers")
+	hosts.Log = dockerLogger.New(logging.ModuleKey, "hosts")
+	images.Log = dockerLogger.New(logging.ModuleKey, "images")
 	listeners.Log = dockerLogger.New(logging.ModuleKey, "listeners")
+	networks.Log = dockerLogger.New(logging.ModuleKey, "networks")
+	stats.Log = dockerLogger.New(logging.ModuleKey, "stats")
+	swarm.Log = dockerLogger.New(logging.ModuleKey, "swarm")
+	volumes.Log = dockerLogger.New(logging.ModuleKey, "volumes")
 
 	logConfig := logging.Config{
 		Modules:     logging.ModuleLevels{logging.MainModule: log.LvlWarn},
@@ -39,33 +87,120 @@ func main() {
 
 	flag.Parse()
 
+	// The terminal UI would be garbled by the logs
+	logConfig.Quiet = flag.Arg(0) == "tui"
 	logConfig.Apply(Log)
 
-	spv := suture.New("docker-graph", suture.Spec{
-		EventHook: func(ev suture.Event) {
-			Log.Error(ev.String(), "type", ev.Type(), "context", log.Ctx(ev.Map()))
-		},
-	})
+	ctx, _ := signal.NotifyContext(context.Background(), os.Kill, os.Interrupt, syscall.SIGHUP)
+
+	switch command := flag.Arg(0); command {
+	case "":
+		serve(ctx, webLogger)
+	case "export":
+		os.Exit(runExport(ctx, flag.Args()[1:]))
+	case "snapshot":
+		os.Exit(runSnapshot(ctx, flag.Args()[1:]))
+	case "compose":
+		os.Exit(runCompose(ctx, flag.Args()[1:]))
+	case "tui":
+		os.Exit(runTUI(ctx, flag.Args()[1:]))
+	case "diff":
+		os.Exit(runDiff(flag.Args()[1:]))
+	default:
+		Log.Crit("unknown command", "command", command)
+		os.Exit(2)
+	}
+}
 
-	dispatcher := utils.NewDispatcher[api.Event]()
+func serve(ctx context.Context, webLogger log.Logger) {
+	spv := newSupervisor()
+
+	dispatcher := api.NewJournal(journalSize)
 	spv.Add(dispatcher)
 
-	connFactory := connections.MakeBasicFactory(client.FromEnv)
+	var store *history.Store
+	if historyFile != "" {
+		store = history.NewStore(historyFile, dispatcher)
+		spv.Add(store)
+	}
 
-	containerRepo := containers.NewRepository(dispatcher, connFactory)
-	spv.Add(containerRepo)
+	// The stats are not journaled, nor recorded in the history
+	var statsSource api.StatsSource
+	var statsDispatcher containers.Dispatcher
+	if statsInterval > 0 {
+		// A client that lags behind misses some stats, instead of delaying the collectors
+		statsEvents := utils.NewLossyDispatcher[api.Event]("stats", statsBuffer)
+		spv.Add(statsEvents)
+		statsSource, statsDispatcher = statsEvents, statsEvents
+	}
 
-	listener := listeners.NewListener(connFactory, containerRepo)
-	spv.Add(listener)
+	graphSource, err := addHosts(spv, dispatcher, statsDispatcher)
+	if err != nil {
+		Log.Crit("invalid endpoint", "error", err)
+		os.Exit(1)
+	}
 
 	webserver := NewWebServer(webLogger)
 	spv.Add(webserver)
 
-	eventAPI := api.NewAPI(dispatcher)
-	eventAPI.MountInto(webserver.App.Group("/api"))
+	apiRouter := webserver.App.Group("/api")
+
+	eventAPI := api.NewAPI(dispatcher, containers.ParseEventFilter, statsSource)
+	eventAPI.MountInto(apiRouter)
+
+	var graphHistory graph.History
+	if store != nil {
+		graphHistory = store
+		historyAPI := history.NewAPI(store)
+		historyAPI.MountInto(apiRouter)
+	}
+
+	graphAPI := graph.NewAPI(graphSource, dispatcher, graphHistory)
+	graphAPI.MountInto(apiRouter)
+
+	exportAPI := export.NewAPI(graphSource)
+	exportAPI.MountInto(apiRouter)
+
+	metrics.Default.Register(graphSource)
+	metricsAPI := metrics.NewAPI(metrics.Default)
+	metricsAPI.MountInto(webserver.App)
 
-	ctx, _ := signal.NotifyContext(context.Background(), os.Kill, os.Interrupt, syscall.SIGHUP)
 	if err := spv.Serve(ctx); err != nil {
 		Log.Crit("Exiting: %s", err)
 	}
 }
+
+func newSupervisor() *suture.Supervisor {
+	return suture.New("docker-graph", suture.Spec{
+		EventHook: func(ev suture.Event) {
+			Log.Error(ev.String(), "type", ev.Type(), "context", log.Ctx(ev.Map()))
+		},
+	})
+}
+
+// addHosts creates the services of the Docker hosts declared on the command line.
+// The stats are only collected when statsDispatcher is not nil.
+func addHosts(spv *suture.Supervisor, dispatcher hosts.Dispatcher, statsDispatcher containers.Dispatcher) (*graph.Source, error) {
+	if len(endpoints) == 0 {
+		endpoints = connections.Endpoints{{Name: connections.DefaultEndpointName}}
+	}
+	graphSource := &graph.Source{}
+	for _, endpoint := range endpoints {
+		connFactory, err := endpoint.Factory()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", endpoint.Name, err)
+		}
+
+		host := hosts.NewHost(endpoint.Name, connFactory, dispatcher)
+		host.Volumes.UsageInterval = volumeUsageInterval
+		if swarmMode {
+			host.EnableSwarm(dispatcher)
+		}
+		if statsDispatcher != nil {
+			host.EnableStats(statsDispatcher, statsInterval)
+		}
+		spv.Add(host)
+		graphSource.Hosts = append(graphSource.Hosts, host)
+	}
+	return graphSource, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/export"
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+	"github.com/adirelle/docker-graph/src/go/lib/tui"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+type (
+	// snapshotWriter prints a graph in a snapshot format.
+	snapshotWriter func(w io.Writer, g graph.Graph, hideStopped bool) error
+)
+
+var (
+	// snapshotFormats are the formats that are specific to the "snapshot" command ; it also accepts the export formats.
+	snapshotFormats = map[string]snapshotWriter{
+		"json": writeJSON,
+		"tree": writeTree,
+	}
+)
+
+// runSnapshot implements the "snapshot" command, that prints the current state of the Docker hosts and exits.
+// It returns 1 if the hosts cannot be reached, and 2 on usage errors.
+func runSnapshot(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	formatName := flags.String("format", "json", "Output format ("+strings.Join(snapshotFormatNames(), ", ")+")")
+	hideStopped := flags.Bool("hideStopped", false, "Exclude the containers that are not running")
+	timeout := flags.Duration("timeout", 30*time.Second, "Maximum time to wait for the Docker hosts")
+	flags.Parse(args)
+
+	write, found := snapshotFormat(*formatName)
+	if !found {
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *formatName)
+		return 2
+	}
+
+	g, err := collectGraph(ctx, *timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not collect the graph: %s\n", err)
+		return 1
+	}
+
+	if err := write(os.Stdout, g, *hideStopped); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write the graph: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// snapshotFormat returns the writer of a snapshot format or of an export format.
+func snapshotFormat(name string) (snapshotWriter, bool) {
+	if write, found := snapshotFormats[name]; found {
+		return write, true
+	}
+	format, found := export.Formats[name]
+	if !found {
+		return nil, false
+	}
+	return func(w io.Writer, g graph.Graph, hideStopped bool) error {
+		return format.Write(w, export.Build(g, export.Options{HideStopped: hideStopped}))
+	}, true
+}
+
+func snapshotFormatNames() []string {
+	return append(utils.SortedKeys(snapshotFormats), export.FormatNames()...)
+}
+
+// writeJSON prints the graph like the /api/graph endpoint.
+func writeJSON(w io.Writer, g graph.Graph, hideStopped bool) error {
+	if hideStopped {
+		running := []containers.Container{}
+		for _, ctn := range g.Containers {
+			if ctn.Status.IsRunning() {
+				running = append(running, ctn)
+			}
+		}
+		g.Containers = running
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// writeTree prints the containers of each host by project and service.
+func writeTree(w io.Writer, g graph.Graph, hideStopped bool) error {
+	var match func(*containers.Container) bool
+	if hideStopped {
+		match = func(ctn *containers.Container) bool { return ctn.Status.IsRunning() }
+	}
+	return tui.WriteTree(w, tui.BuildTree(g.Hosts, g.Containers, match))
+}
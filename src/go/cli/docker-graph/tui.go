@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/tui"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+// runTUI implements the "tui" command, that displays the live graph in the terminal.
+func runTUI(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("tui", flag.ExitOnError)
+	refreshInterval := flags.Duration("refresh", tui.DefaultRefreshInterval, "Minimum delay between two redraws")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	spv := newSupervisor()
+	dispatcher := utils.NewDispatcher[api.Event]("events")
+	spv.Add(dispatcher)
+	source, err := addHosts(spv, dispatcher, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid endpoint: %s\n", err)
+		return 2
+	}
+	done := spv.ServeBackground(ctx)
+
+	app := tui.NewApp(dispatcher, source)
+	app.RefreshInterval = *refreshInterval
+	err = app.Run(ctx)
+
+	cancel()
+	<-done
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
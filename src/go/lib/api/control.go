@@ -0,0 +1,31 @@
+package api
+
+import (
+	"time"
+)
+
+type (
+	// ControlEvent informs the clients about the stream itself.
+	ControlEvent struct {
+		Type string
+		Host string
+		When time.Time
+	}
+)
+
+var (
+	_ Event = (*ControlEvent)(nil)
+)
+
+func (e *ControlEvent) ID() string {
+	return e.When.Format(time.RFC3339Nano)
+}
+
+func (e *ControlEvent) Data() any {
+	return EventDTO{
+		TargetType: "stream",
+		Host:       e.Host,
+		Type:       e.Type,
+		Time:       e.When,
+	}
+}
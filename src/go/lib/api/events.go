@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
+	"time"
 
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
 	"github.com/gofiber/fiber/v2"
 
 	log "github.com/inconshreveable/log15"
@@ -13,21 +16,62 @@ import (
 
 type (
 	API struct {
-		source EventSource
+		source  EventSource
+		filters FilterParser
+		stats   StatsSource
 	}
 
+	// EventSource closes the channel of the subscribers that lag too far behind.
 	EventSource interface {
+		SubscribeSince(lastID string) (c <-chan Event, replay []Event, cancel func())
+	}
+
+	// StatsSource provides the resource usage events, which are not journaled as they are only relevant
+	// when they are received.
+	StatsSource interface {
 		Subscribe() (c <-chan Event, cancel func())
 	}
 
+	// statsLimiter drops the stats of a target that come too soon after the last ones sent.
+	statsLimiter struct {
+		interval time.Duration
+		last     map[string]time.Time
+	}
+
 	Event interface {
 		ID() string
 		Data() any
 	}
+
+	// EventFilter selects the events sent to a subscriber. It can replace an event, e.g. by a "removed" event
+	// when a resource stops matching, so it must only be used for a single stream.
+	EventFilter interface {
+		Filter(dto EventDTO) (EventDTO, bool)
+	}
+
+	// FilterParser builds the filter of a stream from the query parameters ; it returns nil when there is none.
+	FilterParser func(query url.Values) (EventFilter, error)
+
+	EventDTO struct {
+		TargetType string
+		Host       string `json:",omitempty"`
+		TargetID   string
+		Type       string
+		Time       time.Time
+		Details    any
+		// Changes describes what changed since the previous event about the same target, when it is known.
+		Changes []PatchOperation `json:",omitempty"`
+	}
 )
 
-func NewAPI(source EventSource) *API {
-	return &API{source}
+var (
+	HeartbeatInterval = 15 * time.Second
+)
+
+// NewAPI creates the API ; filters can be nil, in which case the streams are not filtered, and stats can be nil,
+// in which case the clients cannot ask for the resource usage.
+func NewAPI(source EventSource, filters FilterParser, stats StatsSource) *API {
+	return &API{source, filters, stats}
 }
 
 func (a *API) MountInto(mnt fiber.Router) {
@@ -37,34 +81,95 @@ func (a *API) MountInto(mnt fiber.Router) {
 func (a *API) streamEvents(ctx *fiber.Ctx) error {
 	logger := ctx.Locals("logger").(log.Logger)
 
-	ctx.Set("Content-Type", "text/event-stream")
-	ctx.Set("Cache-Control", "no-cache")
-	ctx.Set("Connection", "keep-alive")
-	ctx.Set("Transfer-Encoding", "chunked")
+	// Browsers send the header when they reconnect by themselves, other clients can use the query parameter
+	lastID := ctx.Get("Last-Event-ID", ctx.Query("lastEventId"))
 
-	logger.Debug("starting event stream")
+	var filter EventFilter
+	if a.filters != nil {
+		query := make(url.Values)
+		ctx.Context().QueryArgs().VisitAll(func(key, value []byte) {
+			query.Add(string(key), string(value))
+		})
+		// The filters can tell whether the client already knows some resources
+		query.Set("lastEventId", lastID)
+		var err error
+		if filter, err = a.filters(query); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	}
+
+	limiter, err := parseStatsParameter(ctx.Query("stats"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if limiter != nil && a.stats == nil {
+		return fiber.NewError(fiber.StatusNotImplemented, "the stats are disabled")
+	}
+
+	setStreamHeaders(ctx)
+
+	logger.Debug("starting event stream", "lastID", lastID, "stats", limiter != nil)
 
 	ctx.Context().SetBodyStreamWriter(func(output *bufio.Writer) {
+		metrics.EventStreams.Inc()
+		defer metrics.EventStreams.Dec()
+
 		var err error
 		defer func() {
 			if err != nil && err != io.EOF {
-				logger.Error("streaming error", err)
+				logger.Error("streaming error", "error", err)
 			} else {
 				logger.Debug("event stream ended")
 			}
 		}()
 
-		events, done := a.source.Subscribe()
+		events, replay, done := a.source.SubscribeSince(lastID)
 		defer done()
 
-		logger.Debug("waiting for events")
 		enc := json.NewEncoder(output)
-		for event := range events {
-			logger.Debug("sending events", "event", event)
-			if err := sendEvent(output, enc, event); err != nil {
-				logger.Error("error sending event", "event", event, "error", err)
-			} else {
+		logger.Debug("replaying events", "#events", len(replay))
+		for _, event := range replay {
+			if err = sendFilteredEvent(output, enc, event, filter); err != nil {
+				return
+			}
+		}
+
+		// Subscribe after the replay, so the client knows the containers when it receives their stats
+		var stats <-chan Event
+		if limiter != nil {
+			var cancel func()
+			stats, cancel = a.stats.Subscribe()
+			defer cancel()
+		}
+
+		heartbeat := time.NewTicker(HeartbeatInterval)
+		defer heartbeat.Stop()
+
+		logger.Debug("waiting for events")
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					// The client can resume the stream from the last event it received
+					logger.Warn("the client lags too far behind, closing the event stream")
+					return
+				}
+				logger.Debug("sending events", "event", event)
+				if err = sendFilteredEvent(output, enc, event, filter); err != nil {
+					return
+				}
 				logger.Debug("sent event", "event", event)
+			case event := <-stats:
+				if dto, ok := event.Data().(EventDTO); ok && !limiter.Allow(dto) {
+					continue
+				}
+				if err = sendFilteredEvent(output, enc, event, filter); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if err = sendHeartbeat(output); err != nil {
+					return
+				}
 			}
 		}
 	})
@@ -72,11 +177,55 @@ func (a *API) streamEvents(ctx *fiber.Ctx) error {
 	return nil
 }
 
-func sendEvent(output *bufio.Writer, enc *json.Encoder, event Event) (err error) {
-	if _, err = fmt.Fprintf(output, "id:%s\ndata:", event.ID()); err != nil {
+// WriteEventStream sends a finite list of events as a server-sent event stream, and ends it.
+func WriteEventStream(ctx *fiber.Ctx, events []Event) error {
+	logger := ctx.Locals("logger").(log.Logger)
+	setStreamHeaders(ctx)
+
+	ctx.Context().SetBodyStreamWriter(func(output *bufio.Writer) {
+		enc := json.NewEncoder(output)
+		for _, event := range events {
+			if err := sendEvent(output, enc, event, event.Data()); err != nil {
+				logger.Error("streaming error", "error", err)
+				return
+			}
+		}
+		logger.Debug("event stream ended", "#events", len(events))
+	})
+
+	return nil
+}
+
+func setStreamHeaders(ctx *fiber.Ctx) {
+	ctx.Set("Content-Type", "text/event-stream")
+	ctx.Set("Cache-Control", "no-cache")
+	ctx.Set("Connection", "keep-alive")
+	ctx.Set("Transfer-Encoding", "chunked")
+}
+
+// sendFilteredEvent sends the event if it passes the filter, or the event the filter replaced it with.
+func sendFilteredEvent(output *bufio.Writer, enc *json.Encoder, event Event, filter EventFilter) error {
+	data := event.Data()
+	if dto, ok := data.(EventDTO); ok && filter != nil {
+		if data, ok = filter.Filter(dto); !ok {
+			return nil
+		}
+	}
+	return sendEvent(output, enc, event, data)
+}
+
+// sendEvent sends the data of an event ; the ID of the event is sent when it can be used to resume the stream.
+func sendEvent(output *bufio.Writer, enc *json.Encoder, event Event, data any) (err error) {
+	// Only journaled events can be used to resume the stream
+	if entry, ok := event.(*JournalEntry); ok {
+		if _, err = fmt.Fprintf(output, "id:%s\n", entry.ID()); err != nil {
+			return
+		}
+	}
+	if _, err = output.WriteString("data:"); err != nil {
 		return
 	}
-	if err = enc.Encode(event.Data()); err != nil {
+	if err = enc.Encode(data); err != nil {
 		return
 	}
 	if _, err = output.WriteString("\n\n"); err != nil {
@@ -84,3 +233,38 @@ func sendEvent(output *bufio.Writer, enc *json.Encoder, event Event) (err error)
 	}
 	return output.Flush()
 }
+
+// parseStatsParameter reads the "stats" query parameter, that can be a boolean, or the minimum duration between two
+// stats of a resource. It returns nil when the client does not ask for the stats.
+func parseStatsParameter(value string) (*statsLimiter, error) {
+	var interval time.Duration
+	switch value {
+	case "", "0", "false", "no":
+		return nil, nil
+	case "1", "true", "yes":
+	default:
+		var err error
+		if interval, err = time.ParseDuration(value); err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid stats parameter %q, expected a boolean or a duration", value)
+		}
+	}
+	return &statsLimiter{interval, make(map[string]time.Time)}, nil
+}
+
+// Allow tells whether the stats can be sent, and remembers when they were. A tenth of the interval is tolerated,
+// as the stats are usually taken at a regular interval which would be just missed.
+func (l *statsLimiter) Allow(dto EventDTO) bool {
+	key := dto.Host + "/" + dto.TargetID
+	if last, found := l.last[key]; found && dto.Time.Sub(last) < l.interval-l.interval/10 {
+		return false
+	}
+	l.last[key] = dto.Time
+	return true
+}
+
+func sendHeartbeat(output *bufio.Writer) (err error) {
+	if _, err = output.WriteString(":\n\n"); err != nil {
+		return
+	}
+	return output.Flush()
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+type (
+	// Journal dispatches events and keeps the most recent ones, so reconnecting clients only receive what they missed.
+	// The streams of SubscribeSince are fed without blocking, while the subscribers of the embedded dispatcher
+	// receive all the events.
+	Journal struct {
+		*utils.Dispatcher[Event]
+
+		size     int
+		epoch    string
+		seq      uint64
+		entries  []*JournalEntry
+		streams  map[chan Event]struct{}
+		duration *metrics.Histogram
+		mu       sync.Mutex
+	}
+
+	// JournalEntry is an event numbered by the journal.
+	JournalEntry struct {
+		Event
+		epoch string
+		Seq   uint64
+	}
+)
+
+var (
+	_ EventSource = (*Journal)(nil)
+	_ Event       = (*JournalEntry)(nil)
+
+	DefaultJournalSize = 1000
+
+	// StreamBufferSize is the number of events a stream can lag behind before it is closed.
+	StreamBufferSize = 100
+)
+
+func NewJournal(size int) *Journal {
+	if size < 1 {
+		size = 1
+	}
+	return &Journal{
+		// The journal measures the dispatches itself, to include the wait for its lock
+		Dispatcher: utils.NewDispatcher[Event](""),
+		size:       size,
+		epoch:      strconv.FormatInt(time.Now().UnixNano(), 36),
+		entries:    make([]*JournalEntry, 0, size),
+		streams:    make(map[chan Event]struct{}),
+		duration:   metrics.DispatchDuration.With("events"),
+	}
+}
+
+func (j *Journal) Dispatch(event Event, ctx context.Context) error {
+	defer j.duration.ObserveSince(time.Now())
+
+	j.mu.Lock()
+	j.seq++
+	entry := &JournalEntry{event, j.epoch, j.seq}
+	if len(j.entries) >= j.size {
+		copy(j.entries, j.entries[1:])
+		j.entries = j.entries[:len(j.entries)-1]
+	}
+	j.entries = append(j.entries, entry)
+
+	// Feed the streams while holding the lock, so they receive the events in sequence order,
+	// but do not wait for them: a stream that lags too far behind is closed, and its client can resume it
+	for c := range j.streams {
+		select {
+		case c <- entry:
+		default:
+			delete(j.streams, c)
+			close(c)
+		}
+	}
+	j.mu.Unlock()
+
+	return j.Dispatcher.Dispatch(entry, ctx)
+}
+
+// Last returns the last dispatched event, if any.
+func (j *Journal) Last() (Event, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.entries) == 0 {
+		return nil, false
+	}
+	return j.entries[len(j.entries)-1], true
+}
+
+// SubscribeSince subscribes to the future events and returns the events to send beforehand.
+// These are the events that happened after lastID if it is still in the journal,
+// or else a full resync. The channel is closed if the subscriber lags too far behind.
+func (j *Journal) SubscribeSince(lastID string) (c <-chan Event, replay []Event, cancel func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entries, ok := j.entriesSince(lastID); ok {
+		replay = make([]Event, len(entries), len(entries)+1)
+		for i, entry := range entries {
+			replay[i] = entry
+		}
+	} else {
+		if lastID != "" {
+			replay = append(replay, &ControlEvent{Type: "resync", When: time.Now()})
+		}
+		replay = append(replay, j.Dispatcher.Prime()...)
+	}
+
+	// Tell the client it is up to date, with the ID of the last event so it can resume from there
+	replay = append(replay, &JournalEntry{&ControlEvent{Type: "synced", When: time.Now()}, j.epoch, j.seq})
+
+	stream := make(chan Event, StreamBufferSize)
+	j.streams[stream] = struct{}{}
+	cancel = func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, found := j.streams[stream]; found {
+			delete(j.streams, stream)
+			close(stream)
+		}
+	}
+	return stream, replay, cancel
+}
+
+func (j *Journal) entriesSince(lastID string) ([]*JournalEntry, bool) {
+	epoch, seqStr, found := strings.Cut(lastID, "-")
+	if !found || epoch != j.epoch {
+		return nil, false
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil || seq > j.seq {
+		return nil, false
+	}
+	if seq == j.seq {
+		return nil, true
+	}
+	if len(j.entries) == 0 || seq+1 < j.entries[0].Seq {
+		return nil, false
+	}
+	return j.entries[seq+1-j.entries[0].Seq:], true
+}
+
+func (e *JournalEntry) ID() string {
+	return fmt.Sprintf("%s-%d", e.epoch, e.Seq)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJournalDoesNotWaitForStreams(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	j := NewJournal(2 * StreamBufferSize)
+	go j.Serve(ctx)
+
+	c, replay, unsubscribe := j.SubscribeSince("")
+	defer unsubscribe()
+	if len(replay) != 1 {
+		t.Fatalf("expected only the synced event, got %d events", len(replay))
+	}
+
+	// Nobody reads the stream
+	for i := 0; i < StreamBufferSize+1; i++ {
+		if err := j.Dispatch(&ControlEvent{Type: "test", When: time.Now()}, ctx); err != nil {
+			t.Fatalf("dispatch #%d: %s", i, err)
+		}
+	}
+	if last, ok := j.Last(); !ok || last.(*JournalEntry).Seq != uint64(StreamBufferSize+1) {
+		t.Errorf("unexpected last event: %v", last)
+	}
+
+	n := 0
+	for range c {
+		n++
+	}
+	if n != StreamBufferSize {
+		t.Errorf("expected %d buffered events before the stream is closed, got %d", StreamBufferSize, n)
+	}
+
+	// Resuming from the last received event replays the dropped one
+	_, replay, unsubscribe2 := j.SubscribeSince(j.entries[n-1].ID())
+	defer unsubscribe2()
+	if len(replay) != 2 || replay[0].(*JournalEntry).Seq != uint64(n+1) {
+		t.Errorf("unexpected replay: %v", replay)
+	}
+}
+
+func TestJournalStreamsKeepTheOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	j := NewJournal(10)
+	go j.Serve(ctx)
+
+	c, _, unsubscribe := j.SubscribeSince("")
+	for i := 0; i < 5; i++ {
+		_ = j.Dispatch(&ControlEvent{Type: "test", When: time.Now()}, ctx)
+	}
+	unsubscribe()
+	unsubscribe()
+
+	var seq uint64
+	for event := range c {
+		if next := event.(*JournalEntry).Seq; next != seq+1 {
+			t.Errorf("expected event #%d, got #%d", seq+1, next)
+		}
+		seq++
+	}
+	if seq != 5 {
+		t.Errorf("expected 5 events, got %d", seq)
+	}
+}
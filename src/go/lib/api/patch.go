@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// PatchOperation is an operation of a JSON patch (RFC 6902), that describes a change of the details of an event.
+	PatchOperation struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+)
+
+var (
+	_ json.Marshaler = PatchOperation{}
+
+	pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+)
+
+// Diff builds the JSON patch that turns the JSON document of a value into the one of another value.
+// The objects are compared key by key, while the arrays are replaced as a whole.
+func Diff(from, to any) ([]PatchOperation, error) {
+	fromDoc, err := toDocument(from)
+	if err != nil {
+		return nil, err
+	}
+	toDoc, err := toDocument(to)
+	if err != nil {
+		return nil, err
+	}
+	return diffValues(nil, "", fromDoc, toDoc), nil
+}
+
+// MarshalJSON leaves out the value of the "remove" operations.
+func (o PatchOperation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+	type operation PatchOperation
+	return json.Marshal(operation(o))
+}
+
+func toDocument(value any) (doc any, err error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &doc)
+	return
+}
+
+func diffValues(ops []PatchOperation, path string, from, to any) []PatchOperation {
+	fromObj, fromIsObj := from.(map[string]any)
+	toObj, toIsObj := to.(map[string]any)
+	if !fromIsObj || !toIsObj {
+		if !reflect.DeepEqual(from, to) {
+			ops = append(ops, PatchOperation{Op: "replace", Path: path, Value: to})
+		}
+		return ops
+	}
+
+	keys := make([]string, 0, len(fromObj)+len(toObj))
+	for key := range fromObj {
+		keys = append(keys, key)
+	}
+	for key := range toObj {
+		if _, found := fromObj[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "/" + pointerEscaper.Replace(key)
+		fromValue, inFrom := fromObj[key]
+		toValue, inTo := toObj[key]
+		switch {
+		case !inFrom:
+			ops = append(ops, PatchOperation{Op: "add", Path: keyPath, Value: toValue})
+		case !inTo:
+			ops = append(ops, PatchOperation{Op: "remove", Path: keyPath})
+		default:
+			ops = diffValues(ops, keyPath, fromValue, toValue)
+		}
+	}
+	return ops
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	type inner struct {
+		A int
+		B string `json:",omitempty"`
+	}
+	type value struct {
+		Name   string
+		Labels map[string]string
+		Inner  *inner
+		List   []string
+	}
+
+	tests := []struct {
+		name string
+		from any
+		to   any
+		want []PatchOperation
+	}{
+		{
+			name: "same values",
+			from: value{Name: "a", List: []string{"x"}},
+			to:   value{Name: "a", List: []string{"x"}},
+			want: nil,
+		},
+		{
+			name: "replaced scalar",
+			from: value{Name: "a"},
+			to:   value{Name: "b"},
+			want: []PatchOperation{{Op: "replace", Path: "/Name", Value: "b"}},
+		},
+		{
+			name: "added and removed keys",
+			from: value{Labels: map[string]string{"old": "1", "same": "2"}},
+			to:   value{Labels: map[string]string{"new": "3", "same": "2"}},
+			want: []PatchOperation{
+				{Op: "add", Path: "/Labels/new", Value: "3"},
+				{Op: "remove", Path: "/Labels/old"},
+			},
+		},
+		{
+			name: "omitted fields",
+			from: value{Inner: &inner{A: 1}},
+			to:   value{Inner: &inner{A: 1, B: "b"}},
+			want: []PatchOperation{{Op: "add", Path: "/Inner/B", Value: "b"}},
+		},
+		{
+			name: "null replaced by an object",
+			from: value{},
+			to:   value{Inner: &inner{A: 1}},
+			want: []PatchOperation{{Op: "replace", Path: "/Inner", Value: map[string]any{"A": float64(1)}}},
+		},
+		{
+			name: "escaped pointers",
+			from: value{Labels: map[string]string{"a/b": "1", "c~d": "2"}},
+			to:   value{Labels: map[string]string{"a/b": "3", "c~d": "4"}},
+			want: []PatchOperation{
+				{Op: "replace", Path: "/Labels/a~1b", Value: "3"},
+				{Op: "replace", Path: "/Labels/c~0d", Value: "4"},
+			},
+		},
+		{
+			name: "arrays replaced whole",
+			from: value{List: []string{"x", "y"}},
+			to:   value{List: []string{"x", "z"}},
+			want: []PatchOperation{{Op: "replace", Path: "/List", Value: []any{"x", "z"}}},
+		},
+		{
+			name: "whole document",
+			from: "a",
+			to:   "b",
+			want: []PatchOperation{{Op: "replace", Path: "", Value: "b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchOperationMarshalJSON(t *testing.T) {
+	tests := []struct {
+		op   PatchOperation
+		want string
+	}{
+		{PatchOperation{Op: "add", Path: "/a", Value: 1}, `{"op":"add","path":"/a","value":1}`},
+		{PatchOperation{Op: "replace", Path: "/a", Value: nil}, `{"op":"replace","path":"/a","value":null}`},
+		{PatchOperation{Op: "remove", Path: "/a"}, `{"op":"remove","path":"/a"}`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.op)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("got %s, want %s", data, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package compose
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type (
+	// Environment holds the variables used to interpolate the compose files.
+	Environment map[string]string
+
+	// MissingVariableError is returned when a required variable, like ${VAR:?message}, is not set.
+	MissingVariableError struct {
+		Name    string
+		Message string
+	}
+)
+
+// OSEnvironment returns the variables of the process.
+func OSEnvironment() Environment {
+	env := make(Environment)
+	for _, entry := range os.Environ() {
+		if name, value, found := strings.Cut(entry, "="); found {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// LoadEnvFile reads a .env file ; the variables that are already set take precedence over the file.
+// A missing file is not an error.
+func (e Environment) LoadEnvFile(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	defined := make(Environment, len(e))
+	for name, value := range e {
+		defined[name] = value
+	}
+
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, raw, found := strings.Cut(line, "=")
+		if !found {
+			return fmt.Errorf("%s:%d: invalid line", path, lineNum)
+		}
+		name = strings.TrimSpace(name)
+		value, err := parseEnvValue(strings.TrimSpace(raw), defined)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		if _, set := e[name]; !set {
+			e[name] = value
+		}
+		defined[name] = e[name]
+	}
+	return scanner.Err()
+}
+
+// parseEnvValue unquotes a value of a .env file ; unquoted and double-quoted values are interpolated.
+func parseEnvValue(raw string, env Environment) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, "'"):
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		return raw[1 : end+1], nil
+	case strings.HasPrefix(raw, `"`):
+		var buf strings.Builder
+		for i := 1; i < len(raw); i++ {
+			switch c := raw[i]; {
+			case c == '"':
+				return env.Interpolate(buf.String())
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					buf.WriteByte('\n')
+				case 't':
+					buf.WriteByte('\t')
+				default:
+					buf.WriteByte(raw[i])
+				}
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated quote")
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return env.Interpolate(raw)
+}
+
+// Interpolate replaces the variables in a string, with the syntax of docker compose:
+// $VAR, ${VAR}, ${VAR:-default}, ${VAR-default}, ${VAR:?error}, ${VAR?error}, ${VAR:+replacement},
+// ${VAR+replacement} ; $$ is a literal dollar sign. Unset variables are replaced with an empty string.
+func (e Environment) Interpolate(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+		switch next := s[i+1]; {
+		case next == '$':
+			buf.WriteByte('$')
+			i++
+		case next == '{':
+			end := matchingBrace(s, i+1)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable in %q", s)
+			}
+			value, err := e.expand(s[i+2 : end])
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(value)
+			i = end
+		case isNameChar(next, true):
+			j := i + 2
+			for j < len(s) && isNameChar(s[j], false) {
+				j++
+			}
+			value, found := e[s[i+1:j]]
+			if !found {
+				Log.Warn("variable is not set, using an empty string", "name", s[i+1:j])
+			}
+			buf.WriteString(value)
+			i = j - 1
+		default:
+			buf.WriteByte('$')
+		}
+	}
+	return buf.String(), nil
+}
+
+// expand evaluates the content of a ${...} expression.
+func (e Environment) expand(expr string) (string, error) {
+	end := 0
+	for end < len(expr) && isNameChar(expr[end], end == 0) {
+		end++
+	}
+	name, op := expr[:end], expr[end:]
+	if name == "" {
+		return "", fmt.Errorf("invalid variable: ${%s}", expr)
+	}
+	value, set := e[name]
+
+	var operator, arg string
+	for _, candidate := range []string{":-", ":?", ":+", "-", "?", "+"} {
+		if strings.HasPrefix(op, candidate) {
+			operator, arg = candidate, op[len(candidate):]
+			break
+		}
+	}
+	if operator == "" && op != "" {
+		return "", fmt.Errorf("invalid variable: ${%s}", expr)
+	}
+
+	// The colon forms also apply to empty variables
+	missing := !set || (strings.HasPrefix(operator, ":") && value == "")
+	switch strings.TrimPrefix(operator, ":") {
+	case "-":
+		if missing {
+			return e.Interpolate(arg)
+		}
+	case "?":
+		if missing {
+			message, err := e.Interpolate(arg)
+			if err != nil {
+				return "", err
+			}
+			return "", &MissingVariableError{name, message}
+		}
+	case "+":
+		if missing {
+			return "", nil
+		}
+		return e.Interpolate(arg)
+	default:
+		if !set {
+			Log.Warn("variable is not set, using an empty string", "name", name)
+		}
+	}
+	return value, nil
+}
+
+func (e *MissingVariableError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("required variable %s is missing a value", e.Name)
+	}
+	return fmt.Sprintf("required variable %s is missing a value: %s", e.Name, e.Message)
+}
+
+// matchingBrace returns the index of the brace closing the one at start, or -1.
+func matchingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
@@ -0,0 +1,122 @@
+package compose
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := Environment{"SET": "value", "EMPTY": ""}
+	tests := []struct {
+		input string
+		want  string
+		err   string
+	}{
+		{"no variable", "no variable", ""},
+		{"$SET and ${SET}", "value and value", ""},
+		{"$SET_suffix ${SET}_suffix", " value_suffix", ""},
+		{"$UNSET", "", ""},
+		{"$$SET costs $$5", "$SET costs $5", ""},
+		{"trailing $", "trailing $", ""},
+		{"$-not a variable", "$-not a variable", ""},
+
+		{"${SET:-default}", "value", ""},
+		{"${EMPTY:-default}", "default", ""},
+		{"${UNSET:-default}", "default", ""},
+		{"${EMPTY-default}", "", ""},
+		{"${UNSET-default}", "default", ""},
+		{"${UNSET:-$SET}", "value", ""},
+		{"${UNSET:-${ALSO_UNSET:-nested}}", "nested", ""},
+
+		{"${SET:?required}", "value", ""},
+		{"${EMPTY?required}", "", ""},
+		{"${EMPTY:?required}", "", "required variable EMPTY is missing a value: required"},
+		{"${UNSET?}", "", "required variable UNSET is missing a value"},
+		{"${UNSET:?$SET is needed}", "", "required variable UNSET is missing a value: value is needed"},
+
+		{"${SET:+replacement}", "replacement", ""},
+		{"${EMPTY:+replacement}", "", ""},
+		{"${EMPTY+replacement}", "replacement", ""},
+		{"${UNSET+replacement}", "", ""},
+		{"${SET:+$$SET}", "$SET", ""},
+
+		{"${SET", "", "unterminated variable"},
+		{"${}", "", "invalid variable"},
+		{"${SET!}", "", "invalid variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := env.Interpolate(tt.input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateMissingVariableError(t *testing.T) {
+	_, err := Environment{}.Interpolate("${NAME:?message}")
+	var missing *MissingVariableError
+	if !errors.As(err, &missing) || missing.Name != "NAME" || missing.Message != "message" {
+		t.Errorf("unexpected error: %#v", err)
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	env := Environment{"PRESET": "from the environment"}
+	if err := env.LoadEnvFile("testdata/env/quoting.env"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"PLAIN", "value"},
+		{"SPACED", "spaced value"},
+		{"SINGLE", "single $PLAIN # not a comment"},
+		{"DOUBLE", "double value\nsecond line"},
+		{"ESCAPED", `a "quoted" word`},
+		{"EXPORTED", "yes"},
+		{"REFERENCE", "value-from the environment"},
+		{"PRESET", "from the environment"},
+		{"DOLLAR", "$PLAIN"},
+	}
+	for _, tt := range tests {
+		if got, found := env[tt.name]; !found || got != tt.want {
+			t.Errorf("%s: got %q (set: %t), want %q", tt.name, got, found, tt.want)
+		}
+	}
+}
+
+func TestLoadEnvFileErrors(t *testing.T) {
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"testdata/env/missing.env", ""},
+		{"testdata/env/invalid.env", "invalid.env:2: invalid line"},
+		{"testdata/env/unterminated.env", "unterminated.env:1: unterminated quote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := Environment{}.LoadEnvFile(tt.path)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
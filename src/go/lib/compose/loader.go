@@ -0,0 +1,455 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Options describe the compose project to load, like the options of "docker compose".
+	Options struct {
+		// Files are the compose files, merged in order ; defaults to the files found in the current directory.
+		Files []string
+		// ProjectName defaults to COMPOSE_PROJECT_NAME, the name declared in the files, or the name of the project directory.
+		ProjectName string
+		// ProjectDir defaults to the directory of the first file.
+		ProjectDir string
+		// Profiles defaults to COMPOSE_PROFILES.
+		Profiles []string
+		// EnvFile defaults to the .env file of the project directory.
+		EnvFile string
+		// Environment defaults to the environment of the process.
+		Environment Environment
+	}
+
+	// loader reads the compose files, with their variables interpolated and their extends resolved.
+	loader struct {
+		env     Environment
+		files   map[string]map[string]any
+		loading map[string]bool
+	}
+)
+
+var (
+	Log = log.New()
+
+	// DefaultFiles are looked for in the current directory when no file is given.
+	DefaultFiles = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+	// appendedKeys are the sequences of the services that are merged, instead of being overridden.
+	appendedKeys = map[string]bool{
+		"ports": true, "expose": true, "external_links": true, "dns": true, "dns_search": true, "tmpfs": true,
+		"volumes": true, "devices": true, "cap_add": true, "cap_drop": true, "security_opt": true, "links": true,
+		"volumes_from": true,
+	}
+
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9_-]`)
+)
+
+// Load reads and merges the compose files of a project.
+func Load(opts Options) (*Project, error) {
+	files, err := findFiles(opts.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	projectDir := opts.ProjectDir
+	if projectDir == "" {
+		projectDir = filepath.Dir(files[0])
+	}
+	if projectDir, err = filepath.Abs(projectDir); err != nil {
+		return nil, err
+	}
+
+	env := make(Environment)
+	if opts.Environment == nil {
+		opts.Environment = OSEnvironment()
+	}
+	for name, value := range opts.Environment {
+		env[name] = value
+	}
+	envFile := opts.EnvFile
+	if envFile == "" {
+		envFile = filepath.Join(projectDir, ".env")
+	}
+	if err := env.LoadEnvFile(envFile); err != nil {
+		return nil, err
+	}
+
+	l := &loader{env, make(map[string]map[string]any), make(map[string]bool)}
+	merged := map[string]any{}
+	for _, file := range files {
+		doc, err := l.load(file)
+		if err != nil {
+			return nil, err
+		}
+		merged = merge(merged, doc, "").(map[string]any)
+	}
+
+	// The merged document is decoded again, to use the typed structures
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	project := &Project{}
+	if err := yaml.Unmarshal(data, project); err != nil {
+		return nil, err
+	}
+	project.WorkingDir = projectDir
+
+	switch {
+	case opts.ProjectName != "":
+		project.Name = opts.ProjectName
+	case env["COMPOSE_PROJECT_NAME"] != "":
+		project.Name = env["COMPOSE_PROJECT_NAME"]
+	case project.Name == "":
+		project.Name = filepath.Base(projectDir)
+	}
+	project.Name = invalidNameChars.ReplaceAllString(strings.ToLower(project.Name), "")
+
+	profiles := opts.Profiles
+	if len(profiles) == 0 && env["COMPOSE_PROFILES"] != "" {
+		profiles = strings.Split(env["COMPOSE_PROFILES"], ",")
+	}
+	project.applyProfiles(profiles)
+
+	for name, service := range project.Services {
+		service.Name = name
+		service.Volumes = uniqueTargets(service.Volumes)
+	}
+	return project, nil
+}
+
+// findFiles returns the absolute paths of the files, or of the default files and their override.
+func findFiles(files []string) ([]string, error) {
+	if len(files) == 0 {
+		for _, name := range DefaultFiles {
+			if _, err := os.Stat(name); err != nil {
+				continue
+			}
+			files = append(files, name)
+			ext := filepath.Ext(name)
+			override := strings.TrimSuffix(name, ext) + ".override" + ext
+			if _, err := os.Stat(override); err == nil {
+				files = append(files, override)
+			}
+			break
+		}
+		if len(files) == 0 {
+			return nil, errors.New("no compose file found")
+		}
+	}
+	paths := make([]string, len(files))
+	for i, file := range files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+// applyProfiles removes the services that have profiles, none of which is active.
+func (p *Project) applyProfiles(active []string) {
+	enabled := make(map[string]bool, len(active))
+	for _, profile := range active {
+		enabled[strings.TrimSpace(profile)] = true
+	}
+	for name, service := range p.Services {
+		if len(service.Profiles) == 0 || enabled["*"] {
+			continue
+		}
+		found := false
+		for _, profile := range service.Profiles {
+			found = found || enabled[profile]
+		}
+		if !found {
+			delete(p.Services, name)
+			p.Disabled = append(p.Disabled, name)
+		}
+	}
+	sort.Strings(p.Disabled)
+}
+
+// load reads a compose file, interpolates its variables and resolves the extends of its services.
+func (l *loader) load(path string) (map[string]any, error) {
+	if doc, found := l.files[path]; found {
+		return doc, nil
+	}
+	if l.loading[path] {
+		return nil, fmt.Errorf("%s: circular extends", path)
+	}
+	l.loading[path] = true
+	defer delete(l.loading, path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]any{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	interpolated, err := l.interpolate(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	doc = interpolated.(map[string]any)
+	if err := normalize(doc, filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if services, ok := doc["services"].(map[string]any); ok {
+		for name := range services {
+			if _, err := l.extend(path, services, name, map[string]bool{}); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	l.files[path] = doc
+	return doc, nil
+}
+
+// extend merges a service with the one it extends, if any.
+func (l *loader) extend(path string, services map[string]any, name string, visiting map[string]bool) (map[string]any, error) {
+	service, ok := services[name].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("service %s: not found", name)
+	}
+	extends, found := service["extends"]
+	if !found {
+		return service, nil
+	}
+	if visiting[name] {
+		return nil, fmt.Errorf("service %s: circular extends", name)
+	}
+	visiting[name] = true
+
+	var baseName, baseFile string
+	switch value := extends.(type) {
+	case string:
+		baseName = value
+	case map[string]any:
+		baseName, _ = value["service"].(string)
+		baseFile, _ = value["file"].(string)
+	}
+	if baseName == "" {
+		return nil, fmt.Errorf("service %s: invalid extends", name)
+	}
+
+	var base map[string]any
+	var err error
+	if baseFile == "" {
+		base, err = l.extend(path, services, baseName, visiting)
+	} else {
+		if !filepath.IsAbs(baseFile) {
+			baseFile = filepath.Join(filepath.Dir(path), baseFile)
+		}
+		var doc map[string]any
+		if doc, err = l.load(baseFile); err == nil {
+			baseServices, _ := doc["services"].(map[string]any)
+			if base, ok = baseServices[baseName].(map[string]any); !ok {
+				err = fmt.Errorf("%s: service %s: not found", baseFile, baseName)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", name, err)
+	}
+
+	override := make(map[string]any, len(service))
+	for key, value := range service {
+		if key != "extends" {
+			override[key] = value
+		}
+	}
+	extended := merge(base, override, "").(map[string]any)
+	services[name] = extended
+	return extended, nil
+}
+
+// interpolate replaces the variables in all the values of the document.
+func (l *loader) interpolate(value any) (any, error) {
+	switch value := value.(type) {
+	case string:
+		return l.env.Interpolate(value)
+	case map[string]any:
+		result := make(map[string]any, len(value))
+		for key, item := range value {
+			interpolated, err := l.interpolate(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = interpolated
+		}
+		return result, nil
+	case []any:
+		result := make([]any, len(value))
+		for i, item := range value {
+			interpolated, err := l.interpolate(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = interpolated
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// normalize converts the lists that can also be written as mappings, so they can be merged,
+// and makes the paths of the bind mounts absolute, as they are relative to the file that declares them.
+func normalize(doc map[string]any, dir string) error {
+	services, _ := doc["services"].(map[string]any)
+	for name, value := range services {
+		service, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("service %s: invalid definition", name)
+		}
+		for _, key := range []string{"labels", "environment"} {
+			if list, ok := service[key].([]any); ok {
+				service[key] = listToMapping(list)
+			}
+		}
+		if list, ok := service["networks"].([]any); ok {
+			networks := make(map[string]any, len(list))
+			for _, network := range list {
+				networks[fmt.Sprint(network)] = nil
+			}
+			service["networks"] = networks
+		}
+		if list, ok := service["depends_on"].([]any); ok {
+			dependencies := make(map[string]any, len(list))
+			for _, dependency := range list {
+				dependencies[fmt.Sprint(dependency)] = map[string]any{"condition": "service_started"}
+			}
+			service["depends_on"] = dependencies
+		}
+		if volumes, ok := service["volumes"].([]any); ok {
+			for i, volume := range volumes {
+				volumes[i] = absoluteSource(volume, dir)
+			}
+		}
+	}
+
+	for _, key := range []string{"networks", "volumes"} {
+		resources, _ := doc[key].(map[string]any)
+		for _, value := range resources {
+			if resource, ok := value.(map[string]any); ok {
+				if list, ok := resource["labels"].([]any); ok {
+					resource["labels"] = listToMapping(list)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// listToMapping converts a list of "key=value" strings.
+func listToMapping(list []any) map[string]any {
+	mapping := make(map[string]any, len(list))
+	for _, item := range list {
+		key, value, _ := strings.Cut(fmt.Sprint(item), "=")
+		mapping[key] = value
+	}
+	return mapping
+}
+
+// absoluteSource makes the source of a bind mount absolute, in the short or the long syntax.
+func absoluteSource(volume any, dir string) any {
+	switch volume := volume.(type) {
+	case string:
+		source, rest, found := strings.Cut(volume, ":")
+		if found && isPath(source) {
+			return resolvePath(source, dir) + ":" + rest
+		}
+	case map[string]any:
+		if source, ok := volume["source"].(string); ok && volume["type"] == "bind" {
+			volume["source"] = resolvePath(source, dir)
+		}
+	}
+	return volume
+}
+
+func resolvePath(path, dir string) string {
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+		return path
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(dir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// merge returns the result of overriding base, without modifying them.
+func merge(base, override any, key string) any {
+	switch overrideValue := override.(type) {
+	case map[string]any:
+		baseValue, ok := base.(map[string]any)
+		if !ok {
+			return overrideValue
+		}
+		result := make(map[string]any, len(baseValue)+len(overrideValue))
+		for k, v := range baseValue {
+			result[k] = v
+		}
+		for k, v := range overrideValue {
+			if previous, found := result[k]; found {
+				result[k] = merge(previous, v, k)
+			} else {
+				result[k] = v
+			}
+		}
+		return result
+	case []any:
+		baseValue, ok := base.([]any)
+		if !ok || !appendedKeys[key] {
+			return overrideValue
+		}
+		result := make([]any, 0, len(baseValue)+len(overrideValue))
+		seen := make(map[string]bool, cap(result))
+		for _, item := range append(append([]any{}, baseValue...), overrideValue...) {
+			// Only dedupe the simple values ; the volumes are deduplicated by target later
+			if text, ok := item.(string); ok {
+				if seen[text] {
+					continue
+				}
+				seen[text] = true
+			}
+			result = append(result, item)
+		}
+		return result
+	}
+	return override
+}
+
+// uniqueTargets keeps the last volume mounted on each target, at the position of the first one.
+func uniqueTargets(volumes []ServiceVolume) []ServiceVolume {
+	index := make(map[string]int, len(volumes))
+	result := make([]ServiceVolume, 0, len(volumes))
+	for _, volume := range volumes {
+		if i, found := index[volume.Target]; found {
+			result[i] = volume
+			continue
+		}
+		index[volume.Target] = len(result)
+		result = append(result, volume)
+	}
+	return result
+}
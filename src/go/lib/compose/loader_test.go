@@ -0,0 +1,206 @@
+package compose
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+func load(t *testing.T, env Environment, profiles []string, files ...string) *Project {
+	t.Helper()
+	project, err := Load(Options{Files: files, Environment: env, Profiles: profiles})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return project
+}
+
+func TestLoadExtends(t *testing.T) {
+	project := load(t, Environment{}, nil, "testdata/extends/compose.yaml")
+	dir, _ := filepath.Abs("testdata/extends")
+
+	if project.Name != "extends_project" {
+		t.Errorf("unexpected project name: %q", project.Name)
+	}
+	if project.WorkingDir != dir {
+		t.Errorf("unexpected working directory: %q", project.WorkingDir)
+	}
+
+	tests := []struct {
+		service string
+		image   string
+		labels  map[string]string
+		ports   []ServicePort
+	}{
+		{
+			service: "web",
+			image:   "web:latest",
+			labels:  map[string]string{"tier": "backend", "app": "web"},
+			ports:   []ServicePort{{Published: "8080", Target: "80"}},
+		},
+		{
+			service: "worker",
+			image:   "web:latest",
+			labels:  map[string]string{"tier": "backend", "app": "web", "price": "$5"},
+			ports:   []ServicePort{{Published: "8080", Target: "80"}, {Published: "9090", Target: "90"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			service := project.Services[tt.service]
+			if service == nil {
+				t.Fatal("service not found")
+			}
+			if service.Name != tt.service {
+				t.Errorf("unexpected name: %q", service.Name)
+			}
+			if service.Image != tt.image {
+				t.Errorf("unexpected image: %q", service.Image)
+			}
+			if !reflect.DeepEqual(service.Labels, tt.labels) {
+				t.Errorf("unexpected labels: %v", service.Labels)
+			}
+			if !reflect.DeepEqual(service.Ports, tt.ports) {
+				t.Errorf("unexpected ports: %+v", service.Ports)
+			}
+			// The bind mounts are relative to the file that declares them
+			want := []ServiceVolume{{Type: "bind", Source: filepath.Join(dir, "base", "data"), Target: "/data"}}
+			if !reflect.DeepEqual(service.Volumes, want) {
+				t.Errorf("unexpected volumes: %+v", service.Volumes)
+			}
+		})
+	}
+}
+
+func TestLoadInterpolation(t *testing.T) {
+	project := load(t, Environment{"TAG": "1.2"}, nil, "testdata/extends/compose.yaml")
+	if image := project.Services["web"].Image; image != "web:1.2" {
+		t.Errorf("unexpected image: %q", image)
+	}
+
+	project = load(t, Environment{"TAG": "2.0"}, nil, "testdata/required/compose.yaml")
+	if image := project.Services["app"].Image; image != "app:2.0" {
+		t.Errorf("unexpected image: %q", image)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		err   string
+	}{
+		{"circular extends", []string{"testdata/circular/compose.yaml"}, "circular extends"},
+		{"circular extends across files", []string{"testdata/circular/first.yaml"}, "circular extends"},
+		{"missing variable", []string{"testdata/required/compose.yaml"}, "required variable TAG is missing a value: the tag must be set"},
+		{"missing file", []string{"testdata/missing.yaml"}, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(Options{Files: tt.files, Environment: Environment{}})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadMerge(t *testing.T) {
+	project := load(t, Environment{}, []string{"db"}, "testdata/override/compose.yaml", "testdata/override/compose.override.yaml")
+	dir, _ := filepath.Abs("testdata/override")
+	app := project.Services["app"]
+
+	if project.Name != "override" {
+		t.Errorf("unexpected project name: %q", project.Name)
+	}
+	if app.Image != "app:2" {
+		t.Errorf("unexpected image: %q", app.Image)
+	}
+
+	// The lists are converted to mappings, so they can be merged
+	if keys := utils.SortedKeys(app.Networks); !reflect.DeepEqual(keys, []string{"back", "front"}) {
+		t.Errorf("unexpected networks: %v", keys)
+	}
+	if labels := project.Networks["front"].Labels; !reflect.DeepEqual(labels, map[string]string{"tier": "front"}) {
+		t.Errorf("unexpected network labels: %v", labels)
+	}
+	if !project.Networks["back"].External.External {
+		t.Error("the back network should be external")
+	}
+	if dep := app.DependsOn["db"]; dep == nil || dep.Condition != "service_healthy" {
+		t.Errorf("unexpected dependency: %+v", dep)
+	}
+
+	// The ports are appended without duplicates, the volumes are replaced by target
+	wantPorts := []ServicePort{{Published: "80", Target: "80"}, {Published: "443", Target: "443"}}
+	if !reflect.DeepEqual(app.Ports, wantPorts) {
+		t.Errorf("unexpected ports: %+v", app.Ports)
+	}
+	wantVolumes := []ServiceVolume{
+		{Type: "volume", Source: "other", Target: "/data"},
+		{Type: "bind", Source: filepath.Join(dir, "conf"), Target: "/conf", ReadOnly: true},
+	}
+	if !reflect.DeepEqual(app.Volumes, wantVolumes) {
+		t.Errorf("unexpected volumes: %+v", app.Volumes)
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	files := []string{"testdata/override/compose.yaml"}
+	tests := []struct {
+		name     string
+		env      Environment
+		profiles []string
+		enabled  []string
+		disabled []string
+	}{
+		{"no profile", Environment{}, nil, []string{"app"}, []string{"db", "debug"}},
+		{"one profile", Environment{}, []string{"db"}, []string{"app", "db"}, []string{"debug"}},
+		{"any profile of the service", Environment{}, []string{"tools"}, []string{"app", "debug"}, []string{"db"}},
+		{"all profiles", Environment{}, []string{"*"}, []string{"app", "db", "debug"}, nil},
+		{"from the environment", Environment{"COMPOSE_PROFILES": "db,debug"}, nil, []string{"app", "db", "debug"}, nil},
+		{"options before the environment", Environment{"COMPOSE_PROFILES": "db"}, []string{"debug"}, []string{"app", "debug"}, []string{"db"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := load(t, tt.env, tt.profiles, files...)
+			if enabled := utils.SortedKeys(project.Services); !reflect.DeepEqual(enabled, tt.enabled) {
+				t.Errorf("unexpected enabled services: %v", enabled)
+			}
+			if !reflect.DeepEqual(project.Disabled, tt.disabled) {
+				t.Errorf("unexpected disabled services: %v", project.Disabled)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     any
+		override any
+		key      string
+		want     any
+	}{
+		{"scalar", "a", "b", "image", "b"},
+		{"mapping", map[string]any{"a": "1", "b": "2"}, map[string]any{"b": "3", "c": "4"}, "labels",
+			map[string]any{"a": "1", "b": "3", "c": "4"}},
+		{"nested mapping", map[string]any{"x": map[string]any{"a": "1"}}, map[string]any{"x": map[string]any{"b": "2"}}, "",
+			map[string]any{"x": map[string]any{"a": "1", "b": "2"}}},
+		{"appended list", []any{"a", "b"}, []any{"b", "c"}, "ports", []any{"a", "b", "c"}},
+		{"appended mappings are not deduplicated", []any{map[string]any{"a": "1"}}, []any{map[string]any{"a": "1"}}, "volumes",
+			[]any{map[string]any{"a": "1"}, map[string]any{"a": "1"}}},
+		{"overridden list", []any{"a", "b"}, []any{"c"}, "command", []any{"c"}},
+		{"list over a mapping", map[string]any{"a": "1"}, []any{"c"}, "ports", []any{"c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := merge(tt.base, tt.override, tt.key); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package compose
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/networks"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/volumes"
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+type (
+	// Diff compares the containers declared by a project with the ones of the hosts, in the same working directory.
+	Diff struct {
+		Project    string
+		WorkingDir string
+		// Running are the declared containers that are running.
+		Running []containers.Container
+		// NotRunning are the declared containers that are stopped or do not exist.
+		NotRunning []containers.Container
+		// NotDeclared are the running containers of the project that are not declared, e.g. orphans
+		// or services of inactive profiles.
+		NotDeclared []containers.Container
+	}
+)
+
+const (
+	// DeclaredStatus is the status of the containers built from the compose files.
+	DeclaredStatus containers.Status = "declared"
+
+	// DefaultNetwork is the network of the services that do not declare any.
+	DefaultNetwork = "default"
+)
+
+// Graph builds the containers, networks and volumes that "docker compose up" would create, tagged with the host.
+// The containers and the networks use their names as IDs, and the anonymous volumes are left out.
+func (p *Project) Graph(host string) (g graph.Graph, err error) {
+	project := &containers.Project{Name: p.Name, WorkingDir: p.WorkingDir}
+	g.Hosts = []string{host}
+	g.Containers = []containers.Container{}
+	g.Networks = []networks.Network{}
+	g.Volumes = []volumes.Volume{}
+
+	usedNetworks := make(map[string]bool)
+	usedVolumes := make(map[string]bool)
+	for _, name := range utils.SortedKeys(p.Services) {
+		service := p.Services[name]
+		ctns, err := p.containers(service, host, project)
+		if err != nil {
+			return g, fmt.Errorf("service %s: %w", name, err)
+		}
+		for _, ctn := range ctns {
+			for network := range ctn.Networks {
+				usedNetworks[network] = true
+			}
+			for _, mount := range ctn.Mounts {
+				if mount.Type == "volume" {
+					usedVolumes[mount.Name] = true
+				}
+			}
+		}
+		g.Containers = append(g.Containers, ctns...)
+	}
+
+	for _, key := range utils.SortedKeys(p.Networks) {
+		config := p.network(key)
+		name := p.networkName(key)
+		if config.External.External && !usedNetworks[name] {
+			continue
+		}
+		delete(usedNetworks, name)
+		network := networks.Network{ID: networks.ID(name), Host: host, Name: name, Driver: config.Driver, Scope: "local", Labels: config.Labels}
+		if !config.External.External {
+			network.Project = project
+		}
+		if network.Driver == "" {
+			network.Driver = "bridge"
+		}
+		g.Networks = append(g.Networks, network)
+	}
+	if usedNetworks[p.networkName(DefaultNetwork)] {
+		name := p.networkName(DefaultNetwork)
+		g.Networks = append(g.Networks, networks.Network{ID: networks.ID(name), Host: host, Name: name, Driver: "bridge", Scope: "local", Project: project})
+	}
+
+	for _, key := range utils.SortedKeys(p.Volumes) {
+		config := p.volume(key)
+		name := p.volumeName(key)
+		if config.External.External && !usedVolumes[name] {
+			continue
+		}
+		volume := volumes.Volume{Name: volumes.ID(name), Host: host, Driver: config.Driver, Scope: "local", Labels: config.Labels}
+		if !config.External.External {
+			volume.Project = project
+		}
+		if volume.Driver == "" {
+			volume.Driver = "local"
+		}
+		g.Volumes = append(g.Volumes, volume)
+	}
+	return g, nil
+}
+
+// containers builds the containers of a service.
+func (p *Project) containers(service *Service, host string, project *containers.Project) ([]containers.Container, error) {
+	// The labels that compose adds
+	labels := map[string]string{"com.docker.compose.project": p.Name, "com.docker.compose.service": service.Name}
+	for name, value := range service.Labels {
+		labels[name] = value
+	}
+	template := containers.Container{
+		Host:    host,
+		Image:   service.Image,
+		Status:  DeclaredStatus,
+		Service: service.Name,
+		Project: project,
+		Labels:  labels,
+		Groups:  containers.ActiveGroupings.GroupsOf(labels),
+		Mounts:  []containers.Mount{},
+		Ports:   map[string]containers.Port{},
+	}
+	if template.Image == "" {
+		// The name of the image built by "docker compose build"
+		template.Image = p.Name + "-" + service.Name
+	}
+
+	switch mode := service.NetworkMode; mode {
+	case "":
+		keys := utils.SortedKeys(service.Networks)
+		if len(keys) == 0 {
+			keys = []string{DefaultNetwork}
+		}
+		template.Networks = make(map[string]*containers.Network, len(keys))
+		for _, key := range keys {
+			name := p.networkName(key)
+			template.Networks[name] = &containers.Network{ID: name, Name: name}
+		}
+	case "host", "bridge", "none":
+		template.Networks = map[string]*containers.Network{mode: {ID: mode, Name: mode}}
+	}
+	template.Dependencies = dependencies(service)
+
+	for _, volume := range service.Volumes {
+		mount := containers.Mount{Type: volume.Type, Destination: volume.Target, ReadWrite: !volume.ReadOnly}
+		switch volume.Type {
+		case "volume":
+			if volume.Source == "" {
+				continue
+			}
+			mount.Name = p.volumeName(volume.Source)
+		case "bind":
+			mount.Source = volume.Source
+		default:
+			continue
+		}
+		template.Mounts = append(template.Mounts, mount)
+	}
+
+	for _, port := range service.Ports {
+		bindings, err := port.Bindings()
+		if err != nil {
+			return nil, err
+		}
+		for inner, binding := range bindings {
+			template.Ports[inner] = containers.Port{HostIp: binding.HostIP, HostPort: binding.HostPort}
+		}
+	}
+
+	replicas := service.Replicas()
+	ctns := make([]containers.Container, replicas)
+	for i := range ctns {
+		ctn := template
+		ctn.Name = p.Name + "-" + service.Name + "-" + strconv.Itoa(i+1)
+		if service.ContainerName != "" && replicas == 1 {
+			ctn.Name = service.ContainerName
+		}
+		ctn.ID = containers.ID(ctn.Name)
+		ctns[i] = ctn
+	}
+	return ctns, nil
+}
+
+// dependencies lists the services and containers that the service needs, in the same way as the labels
+// and options of the containers created by compose.
+func dependencies(service *Service) (deps []containers.Dependency) {
+	for _, name := range utils.SortedKeys(service.DependsOn) {
+		condition := "service_started"
+		if dep := service.DependsOn[name]; dep != nil && dep.Condition != "" {
+			condition = dep.Condition
+		}
+		deps = append(deps, containers.Dependency{Kind: containers.DependsOn, Service: name, Condition: condition})
+	}
+	for _, link := range service.Links {
+		name, alias, found := strings.Cut(link, ":")
+		if !found {
+			alias = name
+		}
+		deps = append(deps, containers.Dependency{Kind: containers.Link, Service: name, Alias: alias})
+	}
+	if dep, found := serviceOrContainer(service.NetworkMode); found {
+		dep.Kind = containers.NetworkMode
+		deps = append(deps, dep)
+	}
+	for _, from := range service.VolumesFrom {
+		if !strings.HasPrefix(from, "service:") && !strings.HasPrefix(from, "container:") {
+			from = "service:" + from
+		}
+		// Strip the access mode
+		if i := strings.LastIndex(from, ":"); i > strings.Index(from, ":") {
+			from = from[:i]
+		}
+		if dep, found := serviceOrContainer(from); found {
+			dep.Kind = containers.VolumesFrom
+			deps = append(deps, dep)
+		}
+	}
+	return
+}
+
+// serviceOrContainer parses the "service:name" and "container:name" references.
+func serviceOrContainer(ref string) (containers.Dependency, bool) {
+	kind, name, _ := strings.Cut(ref, ":")
+	switch kind {
+	case "service":
+		return containers.Dependency{Service: name}, true
+	case "container":
+		return containers.Dependency{Container: name}, true
+	}
+	return containers.Dependency{}, false
+}
+
+func (p *Project) network(key string) *NetworkConfig {
+	if config := p.Networks[key]; config != nil {
+		return config
+	}
+	return &NetworkConfig{}
+}
+
+func (p *Project) volume(key string) *VolumeConfig {
+	if config := p.Volumes[key]; config != nil {
+		return config
+	}
+	return &VolumeConfig{}
+}
+
+// networkName returns the name of the network created by Docker for a network of the project.
+func (p *Project) networkName(key string) string {
+	config := p.network(key)
+	return resourceName(p.Name, key, config.Name, config.External)
+}
+
+// volumeName returns the name of the volume created by Docker for a volume of the project.
+func (p *Project) volumeName(key string) string {
+	config := p.volume(key)
+	return resourceName(p.Name, key, config.Name, config.External)
+}
+
+func resourceName(project, key, name string, external External) string {
+	switch {
+	case external.Name != "":
+		return external.Name
+	case name != "":
+		return name
+	case external.External:
+		return key
+	}
+	return project + "_" + key
+}
+
+// Diff compares the declared containers of the project with the existing ones of the same working directory.
+// The project is compared on each host where it has containers, or only on the given host if it is not empty.
+func (p *Project) Diff(existing []containers.Container, host string) (Diff, error) {
+	diff := Diff{
+		Project:     p.Name,
+		WorkingDir:  p.WorkingDir,
+		Running:     []containers.Container{},
+		NotRunning:  []containers.Container{},
+		NotDeclared: []containers.Container{},
+	}
+
+	// The same names can be used on several hosts
+	type key struct{ host, name string }
+	actual := make(map[key]containers.Container)
+	hosts := make(map[string]bool)
+	for _, ctn := range existing {
+		if ctn.Project != nil && ctn.Project.WorkingDir == p.WorkingDir && (host == "" || ctn.Host == host) {
+			actual[key{ctn.Host, ctn.Name}] = ctn
+			hosts[ctn.Host] = true
+		}
+	}
+	if host != "" || len(hosts) == 0 {
+		hosts = map[string]bool{host: true}
+	}
+
+	for _, host := range utils.SortedKeys(hosts) {
+		declared, err := p.Graph(host)
+		if err != nil {
+			return diff, err
+		}
+		for _, ctn := range declared.Containers {
+			k := key{host, ctn.Name}
+			found, exists := actual[k]
+			delete(actual, k)
+			switch {
+			case !exists:
+				diff.NotRunning = append(diff.NotRunning, ctn)
+			case found.Status.IsRunning():
+				diff.Running = append(diff.Running, found)
+			default:
+				diff.NotRunning = append(diff.NotRunning, found)
+			}
+		}
+	}
+	for _, ctn := range actual {
+		if ctn.Status.IsRunning() {
+			diff.NotDeclared = append(diff.NotDeclared, ctn)
+		}
+	}
+
+	for _, list := range [][]containers.Container{diff.Running, diff.NotRunning, diff.NotDeclared} {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Host != list[j].Host {
+				return list[i].Host < list[j].Host
+			}
+			return list[i].Name < list[j].Name
+		})
+	}
+	return diff, nil
+}
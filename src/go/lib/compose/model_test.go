@@ -0,0 +1,136 @@
+package compose
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+func TestGraph(t *testing.T) {
+	project := load(t, Environment{}, []string{"db"}, "testdata/override/compose.yaml", "testdata/override/compose.override.yaml")
+	g, err := project.Graph("local")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var names []string
+	for _, ctn := range g.Containers {
+		names = append(names, ctn.Name)
+		if ctn.Host != "local" || ctn.Status != DeclaredStatus || ctn.Project.Name != "override" {
+			t.Errorf("%s: unexpected container: %+v", ctn.Name, ctn)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"override-app-1", "override-db-1"}) {
+		t.Errorf("unexpected containers: %v", names)
+	}
+
+	app := g.Containers[0]
+	if keys := utils.SortedKeys(app.Networks); !reflect.DeepEqual(keys, []string{"back", "override_front"}) {
+		t.Errorf("unexpected networks of the container: %v", keys)
+	}
+	wantDeps := []containers.Dependency{{Kind: containers.DependsOn, Service: "db", Condition: "service_healthy"}}
+	if !reflect.DeepEqual(app.Dependencies, wantDeps) {
+		t.Errorf("unexpected dependencies: %+v", app.Dependencies)
+	}
+	if port := app.Ports["443/tcp"]; port.HostPort != 443 {
+		t.Errorf("unexpected ports: %+v", app.Ports)
+	}
+
+	// The external network is included as it is used, and the default network as db does not declare any
+	var networks []string
+	for _, network := range g.Networks {
+		networks = append(networks, network.Name)
+	}
+	if !reflect.DeepEqual(networks, []string{"back", "override_front", "override_default"}) {
+		t.Errorf("unexpected networks: %v", networks)
+	}
+	var volumes []string
+	for _, volume := range g.Volumes {
+		volumes = append(volumes, string(volume.Name))
+	}
+	if !reflect.DeepEqual(volumes, []string{"override_data", "override_other"}) {
+		t.Errorf("unexpected volumes: %v", volumes)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	project := &Project{
+		Name:       "p",
+		WorkingDir: "/src/p",
+		Services: map[string]*Service{
+			"web": {Name: "web", Image: "nginx"},
+			"db":  {Name: "db", Image: "postgres"},
+		},
+	}
+	declared := &containers.Project{Name: "p", WorkingDir: "/src/p"}
+	other := &containers.Project{Name: "p", WorkingDir: "/src/other"}
+	existing := []containers.Container{
+		{Host: "h1", Name: "p-web-1", Status: "running", Project: declared},
+		{Host: "h1", Name: "p-db-1", Status: "exited", Project: declared},
+		{Host: "h2", Name: "p-web-1", Status: "running", Project: declared},
+		{Host: "h2", Name: "p-orphan-1", Status: "running", Project: declared},
+		{Host: "h2", Name: "p-stopped-1", Status: "exited", Project: declared},
+		{Host: "h3", Name: "p-db-1", Status: "running", Project: other},
+		{Host: "h3", Name: "unrelated", Status: "running"},
+	}
+
+	type entry struct{ host, name, status string }
+	tests := []struct {
+		name        string
+		existing    []containers.Container
+		host        string
+		running     []entry
+		notRunning  []entry
+		notDeclared []entry
+	}{
+		{
+			name:        "all hosts",
+			existing:    existing,
+			running:     []entry{{"h1", "p-web-1", "running"}, {"h2", "p-web-1", "running"}},
+			notRunning:  []entry{{"h1", "p-db-1", "exited"}, {"h2", "p-db-1", "declared"}},
+			notDeclared: []entry{{"h2", "p-orphan-1", "running"}},
+		},
+		{
+			name:       "one host",
+			existing:   existing,
+			host:       "h1",
+			running:    []entry{{"h1", "p-web-1", "running"}},
+			notRunning: []entry{{"h1", "p-db-1", "exited"}},
+		},
+		{
+			name:       "host without the project",
+			existing:   existing,
+			host:       "h3",
+			notRunning: []entry{{"h3", "p-db-1", "declared"}, {"h3", "p-web-1", "declared"}},
+		},
+		{
+			name:       "no container",
+			notRunning: []entry{{"", "p-db-1", "declared"}, {"", "p-web-1", "declared"}},
+		},
+	}
+	entries := func(list []containers.Container) (result []entry) {
+		for _, ctn := range list {
+			result = append(result, entry{ctn.Host, ctn.Name, string(ctn.Status)})
+		}
+		return
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := project.Diff(tt.existing, tt.host)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := entries(diff.Running); !reflect.DeepEqual(got, tt.running) {
+				t.Errorf("unexpected running containers: %v", got)
+			}
+			if got := entries(diff.NotRunning); !reflect.DeepEqual(got, tt.notRunning) {
+				t.Errorf("unexpected not running containers: %v", got)
+			}
+			if got := entries(diff.NotDeclared); !reflect.DeepEqual(got, tt.notDeclared) {
+				t.Errorf("unexpected not declared containers: %v", got)
+			}
+		})
+	}
+}
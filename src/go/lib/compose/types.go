@@ -0,0 +1,244 @@
+package compose
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Project is the merged content of the compose files of a project.
+	Project struct {
+		Name       string                    `yaml:"name"`
+		WorkingDir string                    `yaml:"-"`
+		Services   map[string]*Service       `yaml:"services"`
+		Networks   map[string]*NetworkConfig `yaml:"networks"`
+		Volumes    map[string]*VolumeConfig  `yaml:"volumes"`
+		// Disabled lists the services that are not enabled by the active profiles.
+		Disabled []string `yaml:"-"`
+	}
+
+	// Service holds the settings of a service that are relevant to the graph.
+	Service struct {
+		Name          string                     `yaml:"-"`
+		Image         string                     `yaml:"image"`
+		Build         any                        `yaml:"build"`
+		ContainerName string                     `yaml:"container_name"`
+		Profiles      []string                   `yaml:"profiles"`
+		NetworkMode   string                     `yaml:"network_mode"`
+		Networks      map[string]*ServiceNetwork `yaml:"networks"`
+		Volumes       []ServiceVolume            `yaml:"volumes"`
+		Ports         []ServicePort              `yaml:"ports"`
+		Labels        map[string]string          `yaml:"labels"`
+		DependsOn     map[string]*Dependency     `yaml:"depends_on"`
+		Links         []string                   `yaml:"links"`
+		VolumesFrom   []string                   `yaml:"volumes_from"`
+		Scale         *int                       `yaml:"scale"`
+		Deploy        struct {
+			Replicas *int `yaml:"replicas"`
+		} `yaml:"deploy"`
+	}
+
+	ServiceNetwork struct {
+		Aliases []string `yaml:"aliases"`
+	}
+
+	// ServiceVolume is a mount of a service, in the long syntax.
+	ServiceVolume struct {
+		Type     string `yaml:"type"`
+		Source   string `yaml:"source"`
+		Target   string `yaml:"target"`
+		ReadOnly bool   `yaml:"read_only"`
+	}
+
+	// ServicePort is a port of a service, in the long syntax ; the ports can be ranges like "8000-8010".
+	ServicePort struct {
+		Target    string `yaml:"target"`
+		Published string `yaml:"published"`
+		HostIP    string `yaml:"host_ip"`
+		Protocol  string `yaml:"protocol"`
+	}
+
+	// Binding is a published port.
+	Binding struct {
+		HostIP   string
+		HostPort int
+	}
+
+	Dependency struct {
+		Condition string `yaml:"condition"`
+	}
+
+	NetworkConfig struct {
+		Name     string            `yaml:"name"`
+		Driver   string            `yaml:"driver"`
+		External External          `yaml:"external"`
+		Labels   map[string]string `yaml:"labels"`
+	}
+
+	VolumeConfig struct {
+		Name     string            `yaml:"name"`
+		Driver   string            `yaml:"driver"`
+		External External          `yaml:"external"`
+		Labels   map[string]string `yaml:"labels"`
+	}
+
+	// External tells whether a network or a volume is created outside of the project.
+	// It also accepts the legacy syntax, "external: {name: foo}".
+	External struct {
+		External bool
+		Name     string
+	}
+)
+
+var (
+	_ yaml.Unmarshaler = (*ServiceVolume)(nil)
+	_ yaml.Unmarshaler = (*ServicePort)(nil)
+	_ yaml.Unmarshaler = (*External)(nil)
+)
+
+// UnmarshalYAML parses the short syntax, "[source:]target[:mode]", as well as the long one.
+func (v *ServiceVolume) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		type long ServiceVolume
+		return node.Decode((*long)(v))
+	}
+	parts := strings.Split(node.Value, ":")
+	switch len(parts) {
+	case 1:
+		*v = ServiceVolume{Type: "volume", Target: parts[0]}
+		return nil
+	case 2, 3:
+		*v = ServiceVolume{Type: "volume", Source: parts[0], Target: parts[1]}
+		if isPath(v.Source) {
+			v.Type = "bind"
+		}
+		if len(parts) == 3 {
+			for _, option := range strings.Split(parts[2], ",") {
+				if option == "ro" {
+					v.ReadOnly = true
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: invalid volume: %q", node.Line, node.Value)
+}
+
+// UnmarshalYAML parses the short syntax, "[[host_ip:]published:]target[/protocol]", as well as the long one.
+func (p *ServicePort) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		type long ServicePort
+		return node.Decode((*long)(p))
+	}
+	value := node.Value
+	*p = ServicePort{}
+	if spec, protocol, found := strings.Cut(value, "/"); found {
+		value, p.Protocol = spec, protocol
+	}
+	// IPv6 addresses are enclosed in brackets
+	if strings.HasPrefix(value, "[") {
+		end := strings.Index(value, "]:")
+		if end < 0 {
+			return fmt.Errorf("line %d: invalid port: %q", node.Line, node.Value)
+		}
+		p.HostIP, value = value[1:end], value[end+2:]
+	}
+	parts := strings.Split(value, ":")
+	switch len(parts) {
+	case 1:
+		p.Target = parts[0]
+	case 2:
+		p.Published, p.Target = parts[0], parts[1]
+	case 3:
+		if p.HostIP != "" {
+			return fmt.Errorf("line %d: invalid port: %q", node.Line, node.Value)
+		}
+		p.HostIP, p.Published, p.Target = parts[0], parts[1], parts[2]
+	default:
+		return fmt.Errorf("line %d: invalid port: %q", node.Line, node.Value)
+	}
+	return nil
+}
+
+func (e *External) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var legacy struct {
+			Name string `yaml:"name"`
+		}
+		e.External = true
+		if err := node.Decode(&legacy); err != nil {
+			return err
+		}
+		e.Name = legacy.Name
+		return nil
+	}
+	return node.Decode(&e.External)
+}
+
+// Replicas returns the number of containers of the service.
+func (s *Service) Replicas() int {
+	switch {
+	case s.Deploy.Replicas != nil:
+		return *s.Deploy.Replicas
+	case s.Scale != nil:
+		return *s.Scale
+	}
+	return 1
+}
+
+// Bindings expands the port ranges ; it returns the bindings of the published ports, by "port/protocol".
+func (p ServicePort) Bindings() (map[string]Binding, error) {
+	if p.Published == "" {
+		return nil, nil
+	}
+	targets, err := portRange(p.Target)
+	if err != nil {
+		return nil, err
+	}
+	published, err := portRange(p.Published)
+	if err != nil {
+		return nil, err
+	}
+	protocol := p.Protocol
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	bindings := make(map[string]Binding, len(targets))
+	for i, target := range targets {
+		// A published range with a single target lets the engine pick one of the ports ; show the first one
+		hostPort := published[0]
+		if len(published) == len(targets) {
+			hostPort = published[i]
+		}
+		bindings[strconv.Itoa(target)+"/"+protocol] = Binding{p.HostIP, hostPort}
+	}
+	return bindings, nil
+}
+
+func portRange(spec string) ([]int, error) {
+	first, last, isRange := strings.Cut(spec, "-")
+	start, err := strconv.Atoi(first)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %q", spec)
+	}
+	if !isRange {
+		return []int{start}, nil
+	}
+	end, err := strconv.Atoi(last)
+	if err != nil || end < start {
+		return nil, fmt.Errorf("invalid port range: %q", spec)
+	}
+	ports := make([]int, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// isPath tells whether the source of a volume is a host path, rather than the name of a volume.
+func isPath(source string) bool {
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~")
+}
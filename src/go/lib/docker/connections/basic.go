@@ -23,13 +23,14 @@ func MakeBasicFactory(opts ...client.Opt) BasicFactory {
 	return BasicFactory(opts)
 }
 
-func (f BasicFactory) CreateConn() (Connection, error) {
+func (f BasicFactory) CreateConn(ctx context.Context) (Connection, error) {
 	client, err := client.NewClientWithOpts(f...)
 	if err != nil {
 		return nil, err
 	}
-	ping, err := client.Ping(context.Background())
+	ping, err := client.Ping(ctx)
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
 	Log.Info("opened connection", log.Ctx{
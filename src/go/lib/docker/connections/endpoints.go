@@ -0,0 +1,113 @@
+package connections
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+type (
+	// Endpoint is a named Docker daemon address.
+	Endpoint struct {
+		Name string
+		URL  *url.URL
+	}
+
+	// Endpoints is a list of endpoints that can be set from the command line, using "name=url" values.
+	Endpoints []Endpoint
+)
+
+const (
+	// DefaultEndpointName is the name of the endpoint used when none is declared.
+	DefaultEndpointName = "local"
+)
+
+var (
+	_ flag.Value = (*Endpoints)(nil)
+
+	ErrUnsupportedScheme = errors.New("unsupported endpoint scheme")
+)
+
+// ParseEndpoint parses endpoint definitions like "name=url".
+//
+// Supported URLs are unix:///path/to/docker.sock, tcp://host:port and ssh://user@host:port.
+// TCP endpoints use TLS when the certPath query parameter points to a directory containing ca.pem, cert.pem and key.pem.
+// See NewSSHFactory for the options of SSH endpoints.
+func ParseEndpoint(value string) (e Endpoint, err error) {
+	name, rawURL, found := strings.Cut(value, "=")
+	if !found || name == "" {
+		return e, fmt.Errorf("invalid endpoint %q, expected name=url", value)
+	}
+	e.Name = name
+	if e.URL, err = url.Parse(rawURL); err != nil {
+		return e, fmt.Errorf("invalid endpoint URL %q: %w", rawURL, err)
+	}
+	switch e.URL.Scheme {
+	case "unix", "tcp", "ssh":
+		return e, nil
+	default:
+		return e, fmt.Errorf("%w: %q", ErrUnsupportedScheme, e.URL.Scheme)
+	}
+}
+
+// Factory returns a connection factory for the endpoint, using the environment settings if it has no URL.
+func (e Endpoint) Factory() (Factory, error) {
+	if e.URL == nil {
+		return MakeBasicFactory(client.FromEnv), nil
+	}
+
+	if e.URL.Scheme == "ssh" {
+		return NewSSHFactory(e.URL)
+	}
+
+	query := e.URL.Query()
+	host := *e.URL
+	host.RawQuery = ""
+
+	opts := []client.Opt{client.WithHost(host.String()), client.WithAPIVersionNegotiation()}
+	if certPath := query.Get("certPath"); certPath != "" {
+		opts = append(opts, client.WithTLSClientConfig(
+			filepath.Join(certPath, "ca.pem"),
+			filepath.Join(certPath, "cert.pem"),
+			filepath.Join(certPath, "key.pem"),
+		))
+	}
+	return MakeBasicFactory(opts...), nil
+}
+
+func (e Endpoint) String() string {
+	if e.URL == nil {
+		return e.Name
+	}
+	return fmt.Sprintf("%s=%s", e.Name, e.URL)
+}
+
+func (l *Endpoints) String() string {
+	if l == nil {
+		return ""
+	}
+	parts := make([]string, len(*l))
+	for i, endpoint := range *l {
+		parts[i] = endpoint.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *Endpoints) Set(value string) error {
+	endpoint, err := ParseEndpoint(value)
+	if err != nil {
+		return err
+	}
+	for _, other := range *l {
+		if other.Name == endpoint.Name {
+			return fmt.Errorf("duplicate endpoint name: %q", endpoint.Name)
+		}
+	}
+	*l = append(*l, endpoint)
+	return nil
+}
@@ -0,0 +1,244 @@
+package connections
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/thejerf/suture/v4"
+)
+
+type (
+	// Manager owns a connection shared by the services of a Docker host.
+	// It pings the daemon periodically and retries with a jittered exponential backoff when it is unreachable.
+	Manager struct {
+		Factory      Factory
+		PingInterval time.Duration
+		PingTimeout  time.Duration
+		Backoff      Backoff
+
+		conn      Connection
+		dropped   chan struct{}
+		status    Status
+		connected chan struct{}
+		mu        sync.RWMutex
+	}
+
+	// Status describes the state of the connection managed by a Manager.
+	Status struct {
+		State         State
+		Since         time.Time
+		APIVersion    string     `json:",omitempty"`
+		LastError     string     `json:",omitempty"`
+		LastErrorTime *time.Time `json:",omitempty"`
+		Reconnects    int
+	}
+
+	State string
+
+	// Backoff computes the delays between connection attempts.
+	Backoff struct {
+		Min    time.Duration
+		Max    time.Duration
+		Factor float64
+		// Jitter is the maximum fraction of the delay that is randomly added or removed.
+		Jitter float64
+	}
+
+	sharedConnection struct {
+		Connection
+		dropped <-chan struct{}
+	}
+)
+
+const (
+	StateConnecting   State = "connecting"
+	StateConnected    State = "connected"
+	StateReconnecting State = "reconnecting"
+)
+
+var (
+	_ Factory        = (*Manager)(nil)
+	_ suture.Service = (*Manager)(nil)
+	_ fmt.GoStringer = (*Manager)(nil)
+
+	DefaultPingInterval = 10 * time.Second
+	DefaultPingTimeout  = 5 * time.Second
+	DefaultBackoff      = Backoff{Min: 500 * time.Millisecond, Max: 30 * time.Second, Factor: 2, Jitter: 0.2}
+
+	ErrConnectionDropped = errors.New("connection dropped")
+)
+
+func NewManager(factory Factory) *Manager {
+	return &Manager{
+		Factory:      factory,
+		PingInterval: DefaultPingInterval,
+		PingTimeout:  DefaultPingTimeout,
+		Backoff:      DefaultBackoff,
+		status:       Status{State: StateConnecting, Since: time.Now()},
+		connected:    make(chan struct{}),
+	}
+}
+
+func (m *Manager) GoString() string {
+	status := m.Status()
+	return fmt.Sprintf("connections.Manager(%s)", status.State)
+}
+
+// Status returns the current state of the connection.
+func (m *Manager) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// CreateConn waits for the daemon to be reachable and returns the shared connection.
+// Closing the returned connection has no effect ; it is closed by the manager when the daemon becomes unreachable,
+// so the services should watch Dropped and restart with a new one.
+func (m *Manager) CreateConn(ctx context.Context) (Connection, error) {
+	m.mu.RLock()
+	connected := m.connected
+	m.mu.RUnlock()
+
+	select {
+	case <-connected:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return sharedConnection{m.conn, m.dropped}, nil
+}
+
+// Dropped returns a channel which is closed when a connection returned by a Manager is dropped ;
+// it is nil, so never ready, for the other connections.
+func Dropped(conn Connection) <-chan struct{} {
+	if shared, ok := conn.(sharedConnection); ok {
+		return shared.dropped
+	}
+	return nil
+}
+
+func (m *Manager) Serve(ctx context.Context) error {
+	defer func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.drop(m.conn)
+		m.setState(StateConnecting, nil)
+	}()
+
+	attempt := 0
+	for {
+		var delay time.Duration
+		if err := m.check(ctx); err == nil {
+			attempt = 0
+			delay = m.PingInterval
+		} else {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			Log.Warn("docker daemon unreachable", "attempt", attempt, "error", err)
+			delay = m.Backoff.Delay(attempt)
+			attempt++
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// check opens the connection if need be, then pings the daemon ; the connection is dropped when the ping fails.
+func (m *Manager) check(ctx context.Context) (err error) {
+	m.mu.RLock()
+	conn := m.conn
+	m.mu.RUnlock()
+
+	if conn == nil {
+		if conn, err = m.Factory.CreateConn(ctx); err != nil {
+			m.mu.Lock()
+			m.setState(m.status.State, err)
+			m.mu.Unlock()
+			return
+		}
+		m.mu.Lock()
+		m.conn = conn
+		m.dropped = make(chan struct{})
+		m.mu.Unlock()
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, m.PingTimeout)
+	defer cancel()
+	ping, err := conn.Ping(pingCtx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		// The connection may be broken for good, e.g. when a SSH tunnel is down, so the next check creates a new one
+		m.drop(conn)
+		m.setState(StateReconnecting, err)
+		return
+	}
+	m.status.APIVersion = ping.APIVersion
+	m.setState(StateConnected, nil)
+	return
+}
+
+// drop closes the connection and notifies its users, if it is still the current one ; it must be called with the lock held.
+func (m *Manager) drop(conn Connection) {
+	if conn == nil || conn != m.conn {
+		return
+	}
+	_ = conn.Close()
+	close(m.dropped)
+	m.conn = nil
+	m.dropped = nil
+}
+
+// setState updates the status ; it must be called with the lock held.
+func (m *Manager) setState(state State, err error) {
+	now := time.Now()
+	if err != nil {
+		m.status.LastError = err.Error()
+		m.status.LastErrorTime = &now
+	}
+	if state == m.status.State {
+		return
+	}
+	Log.Info("connection state changed", "from", m.status.State, "to", state)
+	if state == StateConnected {
+		if m.status.State == StateReconnecting {
+			m.status.Reconnects++
+		}
+		close(m.connected)
+	} else if m.status.State == StateConnected {
+		m.connected = make(chan struct{})
+	}
+	m.status.State = state
+	m.status.Since = now
+}
+
+// Delay returns the delay to wait before the given attempt, starting at zero.
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := float64(b.Min)
+	for i := 0; i < attempt && delay < float64(b.Max); i++ {
+		delay *= b.Factor
+	}
+	if delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+func (c sharedConnection) Close() error {
+	return nil
+}
@@ -0,0 +1,241 @@
+package connections
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/thejerf/suture/v4"
+)
+
+type (
+	fakeFactory struct {
+		conns []*fakeConnection
+		err   error
+	}
+
+	fakeConnection struct {
+		Connection
+		pingErr error
+		closed  bool
+		calls   int
+		mu      sync.Mutex
+	}
+
+	// infoService gets the information of the daemon on request, like the repositories inspect the resources.
+	infoService struct {
+		factory  Factory
+		requests chan chan error
+	}
+)
+
+func (f *fakeFactory) CreateConn(ctx context.Context) (Connection, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	conn := &fakeConnection{}
+	f.conns = append(f.conns, conn)
+	return conn, nil
+}
+
+func (c *fakeConnection) Ping(ctx context.Context) (types.Ping, error) {
+	return types.Ping{APIVersion: "1.41"}, c.pingErr
+}
+
+func (c *fakeConnection) Info(ctx context.Context) (types.Info, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return types.Info{}, errors.New("use of closed connection")
+	}
+	c.calls++
+	return types.Info{}, nil
+}
+
+func (c *fakeConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConnection) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (s *infoService) Serve(ctx context.Context) error {
+	conn, err := s.factory.CreateConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	dropped := Dropped(conn)
+	for {
+		select {
+		case reply := <-s.requests:
+			_, err := conn.Info(ctx)
+			reply <- err
+		case <-dropped:
+			return ErrConnectionDropped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// request asks the service for the information, and returns its error.
+func (s *infoService) request(t *testing.T) error {
+	t.Helper()
+	reply := make(chan error)
+	select {
+	case s.requests <- reply:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the service does not answer")
+	}
+	return <-reply
+}
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Min: time.Second, Max: 10 * time.Second, Factor: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoff.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffDelayJitter(t *testing.T) {
+	backoff := Backoff{Min: time.Second, Max: 10 * time.Second, Factor: 2, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := backoff.Delay(1); got < time.Second || got > 3*time.Second {
+			t.Fatalf("Delay(1) = %s, want between 1s and 3s", got)
+		}
+	}
+}
+
+func TestManagerCheck(t *testing.T) {
+	ctx := context.Background()
+	factory := &fakeFactory{}
+	m := NewManager(factory)
+
+	// The daemon is unreachable at startup
+	factory.err = errors.New("no daemon")
+	if err := m.check(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	if status := m.Status(); status.State != StateConnecting || status.LastError != "no daemon" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	// It becomes reachable
+	factory.err = nil
+	if err := m.check(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status := m.Status(); status.State != StateConnected || status.APIVersion != "1.41" || status.Reconnects != 0 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	select {
+	case <-m.connected:
+	default:
+		t.Error("the connected channel should be closed")
+	}
+
+	// The ping fails: the connection is dropped
+	factory.conns[0].pingErr = errors.New("broken pipe")
+	if err := m.check(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	if status := m.Status(); status.State != StateReconnecting || status.LastError != "broken pipe" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if !factory.conns[0].isClosed() || m.conn != nil {
+		t.Error("the broken connection should be closed and dropped")
+	}
+	select {
+	case <-m.connected:
+		t.Error("the connected channel should be reset")
+	default:
+	}
+
+	// The next check uses a new connection
+	if err := m.check(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(factory.conns) != 2 {
+		t.Errorf("expected a new connection, got %d connections", len(factory.conns))
+	}
+	if status := m.Status(); status.State != StateConnected || status.Reconnects != 1 {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	conn, err := m.CreateConn(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if conn.(sharedConnection).Connection != factory.conns[1] {
+		t.Error("CreateConn should return the new connection")
+	}
+	_ = conn.Close()
+	if factory.conns[1].isClosed() {
+		t.Error("closing the shared connection should not close the managed one")
+	}
+}
+
+func TestManagerRestartsTheServicesOnReconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	factory := &fakeFactory{}
+	m := NewManager(factory)
+	if err := m.check(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	service := &infoService{factory: m, requests: make(chan chan error)}
+	supervisor := suture.New("test", suture.Spec{})
+	supervisor.Add(service)
+	go supervisor.Serve(ctx)
+
+	if err := service.request(t); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The ping fails, then a new connection is opened
+	factory.conns[0].pingErr = errors.New("broken pipe")
+	if err := m.check(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := m.check(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The service may still answer with the old connection before it notices the drop, but not for long
+	deadline := time.Now().Add(5 * time.Second)
+	for service.request(t) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the service still uses the dropped connection")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	factory.conns[1].mu.Lock()
+	defer factory.conns[1].mu.Unlock()
+	if factory.conns[1].calls == 0 {
+		t.Error("the service should use the new connection")
+	}
+}
@@ -0,0 +1,241 @@
+package connections
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	log "github.com/inconshreveable/log15"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type (
+	// SSHFactory creates connections to a remote Docker daemon by forwarding its unix socket through SSH,
+	// like the "ssh://" hosts of the docker CLI, without requiring the docker CLI on the remote host.
+	SSHFactory struct {
+		Address    string
+		SocketPath string
+		Config     *ssh.ClientConfig
+		// Signers are the keys read from the identity files ; they are offered along with the keys of the agent.
+		Signers []ssh.Signer
+		Opts    []client.Opt
+	}
+
+	sshConnection struct {
+		*client.Client
+		factory   *SSHFactory
+		sshClient *ssh.Client
+		mu        sync.Mutex
+	}
+)
+
+const (
+	DefaultSSHPort        = "22"
+	DefaultDockerSocket   = "/var/run/docker.sock"
+	DefaultSSHDialTimeout = 10 * time.Second
+)
+
+var (
+	_ Factory    = (*SSHFactory)(nil)
+	_ Connection = (*sshConnection)(nil)
+
+	ErrNoSSHAuth = errors.New("no SSH authentication method available")
+
+	// DefaultIdentityFiles are the private keys looked for in ~/.ssh when none is given.
+	DefaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+)
+
+// NewSSHFactory creates a factory from an URL like ssh://user@host:port.
+//
+// The following query parameters are supported:
+//   - identity: path to a private key, can be repeated; defaults to the usual keys in ~/.ssh,
+//   - knownHosts: path to a known_hosts file, can be repeated; defaults to ~/.ssh/known_hosts,
+//   - socket: path to the Docker socket on the remote host; defaults to /var/run/docker.sock.
+//
+// Keys provided by the SSH agent pointed by SSH_AUTH_SOCK are also used.
+func NewSSHFactory(u *url.URL, opts ...client.Opt) (f *SSHFactory, err error) {
+	query := u.Query()
+	f = &SSHFactory{
+		Address:    u.Host,
+		SocketPath: query.Get("socket"),
+		Opts:       opts,
+	}
+	if u.Port() == "" {
+		f.Address = net.JoinHostPort(u.Hostname(), DefaultSSHPort)
+	}
+	if f.SocketPath == "" {
+		f.SocketPath = DefaultDockerSocket
+	}
+
+	username := u.User.Username()
+	if username == "" {
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		}
+	}
+
+	homeDir, _ := os.UserHomeDir()
+
+	knownHostsFiles := query["knownHosts"]
+	if len(knownHostsFiles) == 0 {
+		knownHostsFiles = []string{filepath.Join(homeDir, ".ssh", "known_hosts")}
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("could not read known hosts: %w", err)
+	}
+
+	if f.Signers, err = loadSigners(query["identity"], homeDir); err != nil {
+		return nil, err
+	}
+
+	f.Config = &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(f.Signers...)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         DefaultSSHDialTimeout,
+	}
+	if len(f.Signers) == 0 && os.Getenv("SSH_AUTH_SOCK") == "" {
+		return nil, ErrNoSSHAuth
+	}
+	return f, nil
+}
+
+func loadSigners(identityFiles []string, homeDir string) (signers []ssh.Signer, err error) {
+	explicit := len(identityFiles) > 0
+	if !explicit {
+		for _, name := range DefaultIdentityFiles {
+			identityFiles = append(identityFiles, filepath.Join(homeDir, ".ssh", name))
+		}
+	}
+	for _, path := range identityFiles {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			if !explicit && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("could not read identity file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			if !explicit {
+				Log.Warn("ignoring identity file", "path", path, "error", err)
+				continue
+			}
+			return nil, fmt.Errorf("could not parse identity file %s: %w", path, err)
+		}
+		signers = append(signers, signer)
+	}
+	return
+}
+
+func (f *SSHFactory) CreateConn(ctx context.Context) (Connection, error) {
+	// Connect to the SSH server first, as the Docker client would hide the reason of a failure
+	sshClient, err := f.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn := &sshConnection{factory: f, sshClient: sshClient}
+	opts := append([]client.Opt{
+		// The host is not used to connect, but the client requires a valid one
+		client.WithHost("http://docker"),
+		client.WithDialContext(conn.dialDocker),
+		client.WithAPIVersionNegotiation(),
+	}, f.Opts...)
+	dockerClient, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+	conn.Client = dockerClient
+
+	ping, err := dockerClient.Ping(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	Log.Info("opened SSH connection", log.Ctx{
+		"address":         f.Address,
+		"socket":          f.SocketPath,
+		"api_version":     ping.APIVersion,
+		"builder_version": ping.BuilderVersion,
+		"os_type":         ping.OSType,
+	})
+	return conn, nil
+}
+
+func (f *SSHFactory) dial(ctx context.Context) (*ssh.Client, error) {
+	config := *f.Config
+	if agentSocket := os.Getenv("SSH_AUTH_SOCK"); agentSocket != "" {
+		if agentConn, err := net.Dial("unix", agentSocket); err == nil {
+			// The agent is only required during the handshake
+			defer agentConn.Close()
+			// The client does not try the same method twice, so all the keys must be offered at once
+			agentClient := agent.NewClient(agentConn)
+			config.Auth = []ssh.AuthMethod{ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				signers, err := agentClient.Signers()
+				if err != nil {
+					Log.Warn("could not list the keys of the SSH agent", "error", err)
+				}
+				return append(append([]ssh.Signer(nil), f.Signers...), signers...), nil
+			})}
+		} else {
+			Log.Warn("could not connect to SSH agent", "error", err)
+		}
+	}
+
+	dialer := net.Dialer{Timeout: config.Timeout}
+	tcpConn, err := dialer.DialContext(ctx, "tcp", f.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", f.Address, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(tcpConn, f.Address, &config)
+	if err != nil {
+		tcpConn.Close()
+		return nil, fmt.Errorf("could not connect to %s: %w", f.Address, err)
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// dialDocker opens a connection to the remote Docker socket, (re)connecting to the SSH server as needed.
+func (c *sshConnection) dialDocker(ctx context.Context, _, _ string) (net.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sshClient != nil {
+		if conn, err := c.sshClient.Dial("unix", c.factory.SocketPath); err == nil {
+			return conn, nil
+		}
+		// The SSH connection is probably broken, open a new one
+		c.sshClient.Close()
+		c.sshClient = nil
+	}
+	sshClient, err := c.factory.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.sshClient = sshClient
+	return sshClient.Dial("unix", c.factory.SocketPath)
+}
+
+func (c *sshConnection) Close() error {
+	err := c.Client.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sshClient != nil {
+		if sshErr := c.sshClient.Close(); err == nil {
+			err = sshErr
+		}
+		c.sshClient = nil
+	}
+	return err
+}
@@ -0,0 +1,388 @@
+package connections
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type (
+	// sshServer is a stand-in for sshd, which forwards the unix sockets to a fake Docker daemon.
+	sshServer struct {
+		Addr    string
+		HostKey ssh.Signer
+		// Sockets are the paths of the sockets requested by the clients.
+		Sockets []string
+
+		config   *ssh.ServerConfig
+		listener net.Listener
+		daemon   string
+		mu       sync.Mutex
+	}
+
+	// streamLocalChannel is the payload of a direct-streamlocal@openssh.com channel.
+	streamLocalChannel struct {
+		SocketPath string
+		Reserved0  string
+		Reserved1  uint32
+	}
+)
+
+func newSigner(t *testing.T) (ssh.Signer, ed25519.PrivateKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return signer, key
+}
+
+// startSSHServer starts a SSH server accepting the given client key.
+func startSSHServer(t *testing.T, authorized ssh.PublicKey) *sshServer {
+	t.Helper()
+	hostKey, _ := newSigner(t)
+	s := &sshServer{HostKey: hostKey, daemon: startDaemon(t)}
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, errors.New("unauthorized key")
+			}
+			return nil, nil
+		},
+	}
+	s.config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s.listener = listener
+	s.Addr = listener.Addr().String()
+	go s.serve()
+	return s
+}
+
+func (s *sshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *sshServer) handle(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		var payload streamLocalChannel
+		if newChannel.ChannelType() != "direct-streamlocal@openssh.com" || ssh.Unmarshal(newChannel.ExtraData(), &payload) != nil {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+		s.mu.Lock()
+		s.Sockets = append(s.Sockets, payload.SocketPath)
+		s.mu.Unlock()
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go forward(channel, s.daemon)
+	}
+}
+
+func (s *sshServer) sockets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.Sockets...)
+}
+
+func forward(channel ssh.Channel, socket string) {
+	defer channel.Close()
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	go func() {
+		_, _ = io.Copy(conn, channel)
+		conn.(*net.UnixConn).CloseWrite()
+	}()
+	_, _ = io.Copy(channel, conn)
+}
+
+// startDaemon starts a fake Docker daemon that only answers to pings.
+func startDaemon(t *testing.T) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.41")
+		w.Header().Set("OSType", "linux")
+		w.WriteHeader(http.StatusOK)
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socket
+}
+
+// writeFile writes a file in the temporary directory of the test.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return path
+}
+
+func writeIdentity(t *testing.T, dir string, key ed25519.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return writeFile(t, dir, "id_ed25519", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+}
+
+func writeKnownHosts(t *testing.T, dir, addr string, key ssh.PublicKey) string {
+	t.Helper()
+	return writeFile(t, dir, "known_hosts", knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)+"\n")
+}
+
+// sshURL builds the URL of the SSH host ; the empty parameters are omitted.
+func sshURL(addr string, params ...string) *url.URL {
+	query := url.Values{}
+	for i := 0; i < len(params); i += 2 {
+		if params[i+1] != "" {
+			query.Set(params[i], params[i+1])
+		}
+	}
+	return &url.URL{Scheme: "ssh", User: url.User("docker"), Host: addr, RawQuery: query.Encode()}
+}
+
+// isolate prevents the test from using the keys and the agent of the user.
+func isolate(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	return home
+}
+
+func connect(t *testing.T, factory *SSHFactory) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := factory.CreateConn(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestSSHFactoryWithKey(t *testing.T) {
+	dir := isolate(t)
+	signer, key := newSigner(t)
+	server := startSSHServer(t, signer.PublicKey())
+
+	factory, err := NewSSHFactory(sshURL(server.Addr,
+		"identity", writeIdentity(t, dir, key),
+		"knownHosts", writeKnownHosts(t, dir, server.Addr, server.HostKey.PublicKey()),
+		"socket", "/run/user/docker.sock",
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if factory.Config.User != "docker" {
+		t.Errorf("unexpected user: %s", factory.Config.User)
+	}
+	if err := connect(t, factory); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if sockets := server.sockets(); len(sockets) == 0 || sockets[0] != "/run/user/docker.sock" {
+		t.Errorf("unexpected forwarded sockets: %v", sockets)
+	}
+}
+
+func TestSSHFactoryWithDefaultKey(t *testing.T) {
+	home := isolate(t)
+	signer, key := newSigner(t)
+	server := startSSHServer(t, signer.PublicKey())
+
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.Mkdir(sshDir, 0700); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	writeIdentity(t, sshDir, key)
+	writeKnownHosts(t, sshDir, server.Addr, server.HostKey.PublicKey())
+
+	factory, err := NewSSHFactory(sshURL(server.Addr))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if factory.SocketPath != DefaultDockerSocket {
+		t.Errorf("unexpected socket: %s", factory.SocketPath)
+	}
+	if err := connect(t, factory); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestSSHFactoryWithAgent(t *testing.T) {
+	dir := isolate(t)
+	signer, key := newSigner(t)
+	server := startSSHServer(t, signer.PublicKey())
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	agentSocket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", agentSocket)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", agentSocket)
+
+	knownHosts := writeKnownHosts(t, dir, server.Addr, server.HostKey.PublicKey())
+	_, otherKey := newSigner(t)
+	tests := []struct {
+		name     string
+		identity string
+	}{
+		{"agent only", ""},
+		// The keys of the agent are still tried after the rejected ones
+		{"unauthorized identity file", writeIdentity(t, t.TempDir(), otherKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory, err := NewSSHFactory(sshURL(server.Addr, "identity", tt.identity, "knownHosts", knownHosts))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := connect(t, factory); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestSSHFactoryErrors(t *testing.T) {
+	dir := isolate(t)
+	signer, key := newSigner(t)
+	server := startSSHServer(t, signer.PublicKey())
+	identity := writeIdentity(t, dir, key)
+	knownHosts := writeKnownHosts(t, dir, server.Addr, server.HostKey.PublicKey())
+
+	otherSigner, otherKey := newSigner(t)
+	otherDir := t.TempDir()
+	otherIdentity := writeIdentity(t, otherDir, otherKey)
+	otherKnownHosts := writeKnownHosts(t, otherDir, server.Addr, otherSigner.PublicKey())
+	unknownHosts := writeFile(t, otherDir, "empty_known_hosts", "")
+
+	// A port where nothing listens
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	t.Run("no authentication", func(t *testing.T) {
+		_, err := NewSSHFactory(sshURL(server.Addr, "knownHosts", knownHosts))
+		if err != ErrNoSSHAuth {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("missing identity file", func(t *testing.T) {
+		_, err := NewSSHFactory(sshURL(server.Addr, "identity", filepath.Join(dir, "missing"), "knownHosts", knownHosts))
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("invalid identity file", func(t *testing.T) {
+		_, err := NewSSHFactory(sshURL(server.Addr, "identity", knownHosts, "knownHosts", knownHosts))
+		if err == nil || !strings.Contains(err.Error(), "could not parse identity file") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("missing known hosts", func(t *testing.T) {
+		_, err := NewSSHFactory(sshURL(server.Addr, "identity", identity, "knownHosts", filepath.Join(dir, "missing")))
+		if err == nil || !strings.Contains(err.Error(), "could not read known hosts") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		addr       string
+		identity   string
+		knownHosts string
+		want       string
+	}{
+		{"unknown host", server.Addr, identity, unknownHosts, "key is unknown"},
+		{"changed host key", server.Addr, identity, otherKnownHosts, "key mismatch"},
+		{"unauthorized key", server.Addr, otherIdentity, knownHosts, "unable to authenticate"},
+		{"unreachable host", closedAddr, identity, knownHosts, "connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory, err := NewSSHFactory(sshURL(tt.addr, "identity", tt.identity, "knownHosts", tt.knownHosts))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			err = connect(t, factory)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), "could not connect to "+tt.addr) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
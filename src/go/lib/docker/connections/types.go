@@ -1,6 +1,7 @@
 package connections
 
 import (
+	"context"
 	"io"
 
 	"github.com/docker/docker/client"
@@ -8,14 +9,19 @@ import (
 
 type (
 	Connection interface {
+		client.ConfigAPIClient
 		client.ContainerAPIClient
+		client.ImageAPIClient
 		client.NetworkAPIClient
+		client.NodeAPIClient
+		client.SecretAPIClient
+		client.ServiceAPIClient
 		client.VolumeAPIClient
 		client.SystemAPIClient
 		io.Closer
 	}
 
 	Factory interface {
-		CreateConn() (Connection, error)
+		CreateConn(ctx context.Context) (Connection, error)
 	}
 )
@@ -0,0 +1,99 @@
+package containers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+)
+
+type (
+	// Change is the change of a field between two versions of a container ; the values are strings,
+	// or sorted lists of strings for the networks, mounts and ports.
+	Change struct {
+		Field string
+		From  any
+		To    any
+	}
+)
+
+// Compare lists the fields that differ between two versions of a container:
+// ID, image, status, health, networks, mounts and ports.
+//
+// Unlike the JSON patches of the events (see api.Diff), which follow the whole document, it leaves out the fields
+// that change all the time, like the times and the restart count, and it compares the networks, mounts and ports as
+// sorted specs, so a reordered list is not a change and each change reads like the options of docker run.
+func Compare(old, new *Container) (changes []Change) {
+	compare := func(field string, from, to string) {
+		if from != to {
+			changes = append(changes, Change{field, from, to})
+		}
+	}
+	compareLists := func(field string, from, to []string) {
+		if !equalLists(from, to) {
+			changes = append(changes, Change{field, from, to})
+		}
+	}
+	compare("ID", string(old.ID), string(new.ID))
+	compare("Image", old.Image, new.Image)
+	compare("ImageID", old.ImageID, new.ImageID)
+	compare("Status", string(old.Status), string(new.Status))
+	compare("Healthy", old.Healthy, new.Healthy)
+	compareLists("Networks", old.networkNames(), new.networkNames())
+	compareLists("Mounts", old.mountSpecs(), new.mountSpecs())
+	compareLists("Ports", old.portSpecs(), new.portSpecs())
+	return
+}
+
+func (c *Container) networkNames() []string {
+	names := make([]string, 0, len(c.Networks))
+	for name := range c.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mountSpecs describes the mounts like the -v option of docker run.
+func (c *Container) mountSpecs() []string {
+	specs := make([]string, 0, len(c.Mounts))
+	for _, mount := range c.Mounts {
+		source := mount.Source
+		if mount.Type == "volume" {
+			source = mount.Name
+		}
+		spec := source + ":" + mount.Destination
+		if !mount.ReadWrite {
+			spec += ":ro"
+		}
+		specs = append(specs, spec)
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+// portSpecs describes the published ports like "0.0.0.0:8080->80/tcp".
+func (c *Container) portSpecs() []string {
+	specs := make([]string, 0, len(c.Ports))
+	for inner, port := range c.Ports {
+		ip := port.HostIp
+		if ip == "" {
+			ip = "0.0.0.0"
+		}
+		specs = append(specs, fmt.Sprintf("%s->%s", net.JoinHostPort(ip, strconv.Itoa(port.HostPort)), inner))
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+func equalLists(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
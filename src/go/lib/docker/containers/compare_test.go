@@ -0,0 +1,87 @@
+package containers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	base := func() *Container {
+		return &Container{
+			ID: "a1", Name: "web", Image: "nginx:1.23", ImageID: "sha256:1", Status: "running",
+			UpdatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Networks:  map[string]*Network{"front": {ID: "n1"}, "back": {ID: "n2"}},
+			Mounts: []Mount{
+				{Type: "volume", Name: "data", Destination: "/data", ReadWrite: true},
+				{Type: "bind", Source: "/etc/app", Destination: "/config"},
+			},
+			Ports: map[string]Port{"80/tcp": {HostPort: 8080}},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(*Container)
+		want   []Change
+	}{
+		{
+			name:   "same container",
+			change: func(c *Container) {},
+		},
+		{
+			name: "other fields",
+			change: func(c *Container) {
+				c.UpdatedAt = c.UpdatedAt.Add(time.Hour)
+				c.RestartCount = 2
+				c.Labels = map[string]string{"a": "b"}
+			},
+		},
+		{
+			name:   "scalar",
+			change: func(c *Container) { c.Image = "nginx:1.24" },
+			want:   []Change{{"Image", "nginx:1.23", "nginx:1.24"}},
+		},
+		{
+			name:   "status",
+			change: func(c *Container) { c.Status, c.Healthy = "exited", "unhealthy" },
+			want:   []Change{{"Status", "running", "exited"}, {"Healthy", "", "unhealthy"}},
+		},
+		{
+			name: "recreated",
+			change: func(c *Container) {
+				c.ID, c.ImageID = "b2", "sha256:2"
+				// The order of the networks and mounts does not matter
+				c.Networks = map[string]*Network{"back": {ID: "n2"}, "front": {ID: "n1"}}
+				c.Mounts[0], c.Mounts[1] = c.Mounts[1], c.Mounts[0]
+			},
+			want: []Change{{"ID", "a1", "b2"}, {"ImageID", "sha256:1", "sha256:2"}},
+		},
+		{
+			name:   "networks",
+			change: func(c *Container) { delete(c.Networks, "back"); c.Networks["admin"] = &Network{ID: "n3"} },
+			want:   []Change{{"Networks", []string{"back", "front"}, []string{"admin", "front"}}},
+		},
+		{
+			name:   "mounts",
+			change: func(c *Container) { c.Mounts[0].ReadWrite = false },
+			want: []Change{{"Mounts",
+				[]string{"/etc/app:/config:ro", "data:/data"},
+				[]string{"/etc/app:/config:ro", "data:/data:ro"},
+			}},
+		},
+		{
+			name:   "ports",
+			change: func(c *Container) { c.Ports["80/tcp"] = Port{HostIp: "127.0.0.1", HostPort: 8080} },
+			want:   []Change{{"Ports", []string{"0.0.0.0:8080->80/tcp"}, []string{"127.0.0.1:8080->80/tcp"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, new := base(), base()
+			tt.change(new)
+			if got := Compare(old, new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
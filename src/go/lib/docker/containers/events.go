@@ -8,22 +8,16 @@ import (
 
 type (
 	ContainerUpdated struct {
-		when time.Time
-		data *Container
+		when    time.Time
+		data    *Container
+		changes []api.PatchOperation
 	}
 
 	ContainerRemoved struct {
 		when time.Time
+		host string
 		id   string
 	}
-
-	eventDTO struct {
-		TargetType string
-		TargetID   string
-		Type       string
-		Time       time.Time
-		Details    any
-	}
 )
 
 var (
@@ -40,12 +34,14 @@ func (c *ContainerUpdated) ID() string {
 }
 
 func (c *ContainerUpdated) Data() any {
-	return eventDTO{
+	return api.EventDTO{
 		TargetType: "container",
+		Host:       c.data.Host,
 		TargetID:   string(c.data.ID),
 		Type:       "updated",
 		Time:       c.when,
 		Details:    c.data,
+		Changes:    c.changes,
 	}
 }
 
@@ -54,8 +50,9 @@ func (c *ContainerRemoved) ID() string {
 }
 
 func (c *ContainerRemoved) Data() any {
-	return eventDTO{
+	return api.EventDTO{
 		TargetType: "container",
+		Host:       c.host,
 		TargetID:   c.id,
 		Type:       "removed",
 		Time:       c.when,
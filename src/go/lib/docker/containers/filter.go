@@ -0,0 +1,216 @@
+package containers
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+)
+
+type (
+	// Filter selects containers ; each criterion matches if any of its values matches, and all the criteria
+	// must match. The empty filter matches all containers.
+	Filter struct {
+		Projects []string
+		Services []string
+		// Names are glob patterns, like "web-*".
+		Names    []string
+		Statuses []string
+		// Networks are names or IDs of networks.
+		Networks []string
+		// Labels must all match.
+		Labels []LabelSelector
+	}
+
+	// LabelSelector matches the labels of a container, with the syntax "key", "!key", "key=value" or "key!=value".
+	LabelSelector struct {
+		Key    string
+		Value  string
+		Exists bool
+		Negate bool
+	}
+
+	// eventFilter filters the events of a stream ; it remembers which containers matched,
+	// to send "removed" events when they stop matching.
+	eventFilter struct {
+		filter  Filter
+		matched map[string]bool
+		// resumed tells whether the client could know containers that the filter has not seen.
+		resumed bool
+	}
+)
+
+var (
+	_ fmt.Stringer    = LabelSelector{}
+	_ api.EventFilter = (*eventFilter)(nil)
+)
+
+// ParseFilter reads the criteria from query parameters, which can be repeated ; the label parameters can hold
+// several comma-separated selectors.
+func ParseFilter(query url.Values) (f Filter, err error) {
+	f.Projects = query["project"]
+	f.Services = query["service"]
+	f.Statuses = query["status"]
+	f.Networks = query["network"]
+	for _, pattern := range query["name"] {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return f, fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+		}
+		f.Names = append(f.Names, pattern)
+	}
+	for _, value := range query["label"] {
+		for _, term := range strings.Split(value, ",") {
+			selector, err := ParseLabelSelector(term)
+			if err != nil {
+				return f, err
+			}
+			f.Labels = append(f.Labels, selector)
+		}
+	}
+	return
+}
+
+// ParseEventFilter builds the filter of an event stream ; the streams are only filtered when there are criteria.
+// The events about the other resources are not filtered. The "lastEventId" parameter tells whether the stream
+// is resumed.
+func ParseEventFilter(query url.Values) (api.EventFilter, error) {
+	f, err := ParseFilter(query)
+	if err != nil || f.IsEmpty() {
+		return nil, err
+	}
+	return &eventFilter{f, make(map[string]bool), query.Get("lastEventId") != ""}, nil
+}
+
+func ParseLabelSelector(term string) (LabelSelector, error) {
+	term = strings.TrimSpace(term)
+	var s LabelSelector
+	switch {
+	case strings.HasPrefix(term, "!"):
+		s = LabelSelector{Key: term[1:], Exists: true, Negate: true}
+	case strings.Contains(term, "!="):
+		key, value, _ := strings.Cut(term, "!=")
+		s = LabelSelector{Key: key, Value: value, Negate: true}
+	case strings.Contains(term, "="):
+		key, value, _ := strings.Cut(term, "=")
+		s = LabelSelector{Key: key, Value: value}
+	default:
+		s = LabelSelector{Key: term, Exists: true}
+	}
+	s.Key = strings.TrimSpace(s.Key)
+	s.Value = strings.TrimSpace(s.Value)
+	if s.Key == "" {
+		return s, fmt.Errorf("invalid label selector: %q", term)
+	}
+	return s, nil
+}
+
+func (f *Filter) IsEmpty() bool {
+	return len(f.Projects)+len(f.Services)+len(f.Names)+len(f.Statuses)+len(f.Networks)+len(f.Labels) == 0
+}
+
+func (f *Filter) Match(ctn *Container) bool {
+	project := ""
+	if ctn.Project != nil {
+		project = ctn.Project.Name
+	}
+	return matchAny(f.Projects, func(name string) bool { return name == project }) &&
+		matchAny(f.Services, func(name string) bool { return name == ctn.Service }) &&
+		matchAny(f.Names, func(pattern string) bool {
+			matched, _ := path.Match(pattern, ctn.Name)
+			return matched
+		}) &&
+		matchAny(f.Statuses, func(status string) bool { return status == string(ctn.Status) }) &&
+		matchAny(f.Networks, func(network string) bool {
+			for name, net := range ctn.Networks {
+				if network == name || network == net.ID {
+					return true
+				}
+			}
+			return false
+		}) &&
+		f.matchLabels(ctn.Labels)
+}
+
+func (f *Filter) matchLabels(labels map[string]string) bool {
+	for _, selector := range f.Labels {
+		if !selector.Match(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s LabelSelector) Match(labels map[string]string) bool {
+	value, found := labels[s.Key]
+	if s.Exists {
+		return found != s.Negate
+	}
+	return (found && value == s.Value) != s.Negate
+}
+
+func (s LabelSelector) String() string {
+	switch {
+	case s.Exists && s.Negate:
+		return "!" + s.Key
+	case s.Exists:
+		return s.Key
+	case s.Negate:
+		return s.Key + "!=" + s.Value
+	}
+	return s.Key + "=" + s.Value
+}
+
+// Filter passes the events of the matching containers. When a container stops matching, its update is
+// replaced by its removal. The events of the containers that did not match are dropped ; the ones of unknown
+// containers are also dropped, unless the stream has been resumed, as the client could know them.
+func (f *eventFilter) Filter(dto api.EventDTO) (api.EventDTO, bool) {
+	if dto.TargetType == "stream" && dto.Type == "resync" {
+		// The client is going to receive the whole state again
+		f.matched = make(map[string]bool)
+		f.resumed = false
+	}
+	if dto.TargetType != "container" {
+		return dto, true
+	}
+
+	key := dto.Host + "/" + dto.TargetID
+	matched, known := f.matched[key]
+	mayBeKnown := matched || (!known && f.resumed)
+	switch dto.Type {
+	case "removed":
+		delete(f.matched, key)
+		return dto, mayBeKnown
+	case "updated":
+		ctn, ok := dto.Details.(*Container)
+		if !ok {
+			return dto, true
+		}
+		f.matched[key] = f.filter.Match(ctn)
+		if f.matched[key] {
+			if !matched {
+				// The client does not know the previous state of the container
+				dto.Changes = nil
+			}
+			return dto, true
+		}
+		removed := api.EventDTO{TargetType: dto.TargetType, Host: dto.Host, TargetID: dto.TargetID, Type: "removed", Time: dto.Time}
+		return removed, mayBeKnown
+	case "stats":
+		return dto, matched
+	}
+	return dto, true
+}
+
+func matchAny(values []string, match func(string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package containers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+)
+
+func TestEventFilter(t *testing.T) {
+	web := func(status Status) api.EventDTO {
+		return api.EventDTO{
+			TargetType: "container", Host: "h", TargetID: "web", Type: "updated",
+			Details: &Container{ID: "web", Host: "h", Name: "web", Status: status},
+			Changes: []api.PatchOperation{{Op: "replace", Path: "/Status", Value: string(status)}},
+		}
+	}
+	removed := api.EventDTO{TargetType: "container", Host: "h", TargetID: "web", Type: "removed"}
+	stats := api.EventDTO{TargetType: "container", Host: "h", TargetID: "web", Type: "stats"}
+	resync := api.EventDTO{TargetType: "stream", Type: "resync"}
+	network := api.EventDTO{TargetType: "network", Host: "h", TargetID: "net", Type: "updated"}
+
+	type step struct {
+		event api.EventDTO
+		// want is the type of the event that is sent, or "" if it is dropped.
+		want        string
+		wantChanges bool
+	}
+	tests := []struct {
+		name    string
+		resumed bool
+		steps   []step
+	}{
+		{
+			name: "matching container",
+			steps: []step{
+				{web("running"), "updated", false},
+				{web("running"), "updated", true},
+				{stats, "stats", false},
+				{removed, "removed", false},
+			},
+		},
+		{
+			name: "stops matching",
+			steps: []step{
+				{web("running"), "updated", false},
+				{web("exited"), "removed", false},
+				{web("exited"), "", false},
+				{stats, "", false},
+				{removed, "", false},
+			},
+		},
+		{
+			name: "starts matching",
+			steps: []step{
+				{web("exited"), "", false},
+				{web("running"), "updated", false},
+			},
+		},
+		{
+			name: "unknown container of a fresh stream",
+			steps: []step{
+				{web("exited"), "", false},
+				{removed, "", false},
+			},
+		},
+		{
+			name:    "unknown container of a resumed stream",
+			resumed: true,
+			steps: []step{
+				{web("exited"), "removed", false},
+				{web("exited"), "", false},
+			},
+		},
+		{
+			name:    "removed unknown container of a resumed stream",
+			resumed: true,
+			steps: []step{
+				{removed, "removed", false},
+			},
+		},
+		{
+			name:    "resync",
+			resumed: true,
+			steps: []step{
+				{web("running"), "updated", false},
+				{resync, "resync", false},
+				// The client has forgotten the container
+				{web("exited"), "", false},
+				{web("running"), "updated", false},
+			},
+		},
+		{
+			name: "other resources",
+			steps: []step{
+				{network, "updated", false},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"status": {"running"}}
+			if tt.resumed {
+				query.Set("lastEventId", "1-1")
+			}
+			filter, err := ParseEventFilter(query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for i, step := range tt.steps {
+				got, ok := filter.Filter(step.event)
+				switch {
+				case step.want == "" && ok:
+					t.Errorf("step #%d: expected the event to be dropped, got a %s event", i, got.Type)
+				case step.want != "" && !ok:
+					t.Errorf("step #%d: expected a %s event, got none", i, step.want)
+				case ok && got.Type != step.want:
+					t.Errorf("step #%d: expected a %s event, got a %s event", i, step.want, got.Type)
+				case ok && (len(got.Changes) > 0) != step.wantChanges:
+					t.Errorf("step #%d: unexpected changes: %v", i, got.Changes)
+				}
+			}
+		})
+	}
+}
+
+func TestParseEventFilter(t *testing.T) {
+	filter, err := ParseEventFilter(url.Values{"lastEventId": {"1-1"}})
+	if err != nil || filter != nil {
+		t.Errorf("expected no filter without criteria, got %v, %v", filter, err)
+	}
+	if _, err := ParseEventFilter(url.Values{"name": {"["}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+	if _, err := ParseEventFilter(url.Values{"label": {"a=b,=c"}}); err == nil {
+		t.Error("expected an error for an invalid label selector")
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	ctn := &Container{
+		Name:     "web-1",
+		Service:  "web",
+		Status:   "running",
+		Project:  &Project{Name: "shop"},
+		Labels:   map[string]string{"team": "a", "tier": "front"},
+		Networks: map[string]*Network{"shop_default": {ID: "n1"}},
+	}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"project=shop", true},
+		{"project=other&project=shop", true},
+		{"project=other", false},
+		{"service=web&status=running", true},
+		{"service=web&status=exited", false},
+		{"name=web-*", true},
+		{"name=db-*", false},
+		{"network=shop_default", true},
+		{"network=n1", true},
+		{"network=n2", false},
+		{"label=team", true},
+		{"label=!team", false},
+		{"label=team=a,tier!=back", true},
+		{"label=team=b", false},
+		{"label=team!=a", false},
+		{"label=owner", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			filter, err := ParseFilter(query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := filter.Match(ctn); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
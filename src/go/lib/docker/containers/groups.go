@@ -0,0 +1,117 @@
+package containers
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+type (
+	// Grouping is a hierarchy of labels, e.g. "team" then "app", used to cluster the containers.
+	Grouping []string
+
+	// Groupings is a list of groupings that can be set from the command line, using comma-separated label names.
+	Groupings []Grouping
+
+	// Group is the membership of a container in a grouping.
+	Group struct {
+		// Grouping is the name of the grouping, its comma-separated labels.
+		Grouping string
+		// Path holds the values of the labels, from the top of the hierarchy ; it stops at the first missing label.
+		Path []string
+	}
+
+	// GroupingsFlag sets groupings from the command line ; the first value replaces the default groupings,
+	// and the next ones are added to it.
+	GroupingsFlag struct {
+		Target   *Groupings
+		replaced bool
+	}
+)
+
+var (
+	_ flag.Value   = (*Groupings)(nil)
+	_ flag.Value   = (*GroupingsFlag)(nil)
+	_ fmt.Stringer = Grouping{}
+
+	// ActiveGroupings are the groupings of the containers ; they must be set before the repositories are started.
+	ActiveGroupings = Groupings{{"com.docker.compose.project", "com.docker.compose.service"}}
+)
+
+func ParseGrouping(value string) (Grouping, error) {
+	var g Grouping
+	for _, label := range strings.Split(value, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			return nil, fmt.Errorf("invalid grouping %q, expected comma-separated label names", value)
+		}
+		g = append(g, label)
+	}
+	return g, nil
+}
+
+// GroupOf returns the group of the labels ; it returns false when the first label is missing.
+func (g Grouping) GroupOf(labels map[string]string) (Group, bool) {
+	group := Group{Grouping: g.String()}
+	for _, label := range g {
+		value, found := labels[label]
+		if !found {
+			break
+		}
+		group.Path = append(group.Path, value)
+	}
+	return group, len(group.Path) > 0
+}
+
+func (g Grouping) String() string {
+	return strings.Join(g, ",")
+}
+
+// GroupsOf returns the groups of the labels, for each grouping.
+func (l Groupings) GroupsOf(labels map[string]string) (groups []Group) {
+	for _, grouping := range l {
+		if group, found := grouping.GroupOf(labels); found {
+			groups = append(groups, group)
+		}
+	}
+	return
+}
+
+func (l *Groupings) String() string {
+	if l == nil {
+		return ""
+	}
+	parts := make([]string, len(*l))
+	for i, grouping := range *l {
+		parts[i] = grouping.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l *Groupings) Set(value string) error {
+	grouping, err := ParseGrouping(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, grouping)
+	return nil
+}
+
+func (f *GroupingsFlag) String() string {
+	if f == nil || f.Target == nil {
+		return ""
+	}
+	return f.Target.String()
+}
+
+func (f *GroupingsFlag) Set(value string) error {
+	grouping, err := ParseGrouping(value)
+	if err != nil {
+		return err
+	}
+	if !f.replaced {
+		*f.Target, f.replaced = nil, true
+	}
+	*f.Target = append(*f.Target, grouping)
+	return nil
+}
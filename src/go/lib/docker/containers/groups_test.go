@@ -0,0 +1,117 @@
+package containers
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseGrouping(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Grouping
+		wantErr bool
+	}{
+		{"team", Grouping{"team"}, false},
+		{"team,app", Grouping{"team", "app"}, false},
+		{" team , app ", Grouping{"team", "app"}, false},
+		{"", nil, true},
+		{"team,", nil, true},
+		{"team,,app", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseGrouping(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupOf(t *testing.T) {
+	grouping := Grouping{"team", "app", "tier"}
+	tests := []struct {
+		name      string
+		labels    map[string]string
+		wantPath  []string
+		wantFound bool
+	}{
+		{"all labels", map[string]string{"team": "a", "app": "shop", "tier": "front"}, []string{"a", "shop", "front"}, true},
+		{"last label missing", map[string]string{"team": "a", "app": "shop"}, []string{"a", "shop"}, true},
+		// The path stops at the first missing label, even if the next ones are there
+		{"middle label missing", map[string]string{"team": "a", "tier": "front"}, []string{"a"}, true},
+		{"empty value", map[string]string{"team": "", "app": "shop"}, []string{"", "shop"}, true},
+		{"first label missing", map[string]string{"app": "shop", "tier": "front"}, nil, false},
+		{"no labels", nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group, found := grouping.GroupOf(tt.labels)
+			if found != tt.wantFound {
+				t.Errorf("got found=%t, want %t", found, tt.wantFound)
+			}
+			if group.Grouping != "team,app,tier" || !reflect.DeepEqual(group.Path, tt.wantPath) {
+				t.Errorf("unexpected group: %+v", group)
+			}
+		})
+	}
+}
+
+func TestGroupsOf(t *testing.T) {
+	groupings := Groupings{{"team", "app"}, {"com.docker.compose.project"}, {"env"}}
+	got := groupings.GroupsOf(map[string]string{"team": "a", "app": "shop", "com.docker.compose.project": "shop"})
+	want := []Group{{"team,app", []string{"a", "shop"}}, {"com.docker.compose.project", []string{"shop"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGroupingsSet(t *testing.T) {
+	var groupings Groupings
+	for _, value := range []string{"team,app", "env"} {
+		if err := groupings.Set(value); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := groupings.Set("env,"); err == nil {
+		t.Error("expected an error")
+	}
+	if got := groupings.String(); got != "team,app env" {
+		t.Errorf("unexpected groupings: %s", got)
+	}
+}
+
+func TestGroupingsFlag(t *testing.T) {
+	defaults := Groupings{{"com.docker.compose.project", "com.docker.compose.service"}}
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{"defaults", nil, "com.docker.compose.project,com.docker.compose.service", false},
+		{"replaced", []string{"-group", "team,app"}, "team,app", false},
+		{"repeated", []string{"-group", "team,app", "-group", "com.docker.compose.project"}, "team,app com.docker.compose.project", false},
+		// The defaults are kept when the value is invalid
+		{"invalid", []string{"-group", "team,"}, "com.docker.compose.project,com.docker.compose.service", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groupings := append(Groupings(nil), defaults...)
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.SetOutput(io.Discard)
+			flags.Var(&GroupingsFlag{Target: &groupings}, "group", "")
+			if err := flags.Parse(tt.args); (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := groupings.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,11 +3,15 @@ package containers
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/adirelle/docker-graph/src/go/lib/api"
 	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/listeners"
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/client"
 	log "github.com/inconshreveable/log15"
@@ -22,22 +26,27 @@ var (
 type (
 	Repository struct {
 		ConnFactory connections.Factory
+		// Host is the name of the Docker host, used to tag the resources.
+		Host string
 
 		conn       connections.Connection
 		dispatcher Dispatcher
 		messages   chan events.Message
 		containers map[ID]*Container
+		mu         sync.RWMutex
+		sync       *listeners.SyncTracker[ID]
 	}
 
 	Dispatcher interface {
 		Dispatch(value api.Event, ctx context.Context) error
-		OnNewSubscriber(hook func(chan<- api.Event))
+		OnNewSubscriber(hook func() []api.Event)
 	}
 )
 
 var (
-	_ suture.Service = (*Repository)(nil)
-	_ fmt.GoStringer = (*Repository)(nil)
+	_ suture.Service         = (*Repository)(nil)
+	_ fmt.GoStringer         = (*Repository)(nil)
+	_ listeners.Synchronizer = (*Repository)(nil)
 
 	InspectTimeout = 200 * time.Millisecond
 )
@@ -48,6 +57,7 @@ func NewRepository(dispatcher Dispatcher, connFactory connections.Factory) (r *R
 		ConnFactory: connFactory,
 		messages:    make(chan events.Message, 50),
 		containers:  make(map[ID]*Container, 10),
+		sync:        listeners.NewSyncTracker[ID](),
 	}
 	dispatcher.OnNewSubscriber(r.primeNewSubscriber)
 	return r
@@ -57,8 +67,20 @@ func (r *Repository) GoString() string {
 	return fmt.Sprintf("containers.Repository(%d, %d/%d)", len(r.containers), len(r.messages), cap(r.messages))
 }
 
+// Len returns the number of known containers.
+func (r *Repository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.containers)
+}
+
+// Pending returns the number of messages waiting to be handled.
+func (r *Repository) Pending() int {
+	return len(r.messages)
+}
+
 func (r *Repository) Serve(ctx context.Context) (err error) {
-	r.conn, err = r.ConnFactory.CreateConn()
+	r.conn, err = r.ConnFactory.CreateConn(ctx)
 	if err != nil {
 		return
 	}
@@ -67,10 +89,13 @@ func (r *Repository) Serve(ctx context.Context) (err error) {
 		r.conn = nil
 	}()
 
+	dropped := connections.Dropped(r.conn)
 	for err == nil {
 		select {
 		case msg := <-r.messages:
 			err = r.handleMessage(msg, ctx)
+		case <-dropped:
+			return connections.ErrConnectionDropped
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -82,19 +107,71 @@ func (r *Repository) Process(msg events.Message) {
 	r.messages <- msg
 }
 
-func (r *Repository) primeNewSubscriber(c chan<- api.Event) {
-	Log.Debug("new subscriber", "c", c, "#ctn", len(r.containers))
+// List returns copies of all known containers, sorted by name.
+func (r *Repository) List() []Container {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Container, 0, len(r.containers))
+	for _, ctn := range r.containers {
+		list = append(list, *ctn)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Get returns a copy of the container with the given ID or name.
+func (r *Repository) Get(idOrName string) (Container, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if ctn, found := r.containers[ID(idOrName)]; found {
+		return *ctn, true
+	}
 	for _, ctn := range r.containers {
-		Log.Debug("sending container", "ctn", ctn)
-		c <- &ContainerUpdated{ctn.LastUpdateTime(), ctn}
+		if ctn.Name == idOrName {
+			return *ctn, true
+		}
+	}
+	return Container{}, false
+}
+
+func (r *Repository) primeNewSubscriber() []api.Event {
+	list := r.List()
+	Log.Debug("new subscriber", "#ctn", len(list))
+	events := make([]api.Event, len(list))
+	for i := range list {
+		events[i] = &ContainerUpdated{list[i].LastUpdateTime(), &list[i], nil}
+	}
+	return events
+}
+
+func (r *Repository) Synced() <-chan struct{} {
+	return r.sync.Synced()
+}
+
+func (r *Repository) handleSync(action string, when time.Time, ctx context.Context) {
+	switch action {
+	case listeners.SyncStartAction:
+		r.sync.Start()
+	case listeners.SyncEndAction:
+		r.mu.RLock()
+		known := make([]ID, 0, len(r.containers))
+		for id := range r.containers {
+			known = append(known, id)
+		}
+		r.mu.RUnlock()
+		for _, id := range r.sync.End(known) {
+			r.removeContainer(id, when, ctx)
+		}
 	}
 }
 
 func (r *Repository) handleMessage(msg events.Message, ctx context.Context) error {
-	logger := Log.New(log.Ctx{"id": msg.ID})
+	logger := Log.New(log.Ctx{"host": r.Host, "id": msg.ID})
 	ctx = context.WithValue(ctx, LoggerKey, logger)
 	when := time.Unix(0, msg.TimeNano)
 	switch msg.Type {
+	case listeners.SyncMessageType:
+		r.handleSync(msg.Action, when, ctx)
 	case "container":
 		if msg.Action == "destroy" {
 			r.removeContainer(ID(msg.ID), when, ctx)
@@ -105,7 +182,7 @@ func (r *Repository) handleMessage(msg events.Message, ctx context.Context) erro
 		}
 	case "network":
 		if msg.Action == "connect" || msg.Action == "disconnect" {
-			r.updateContainer(ID(msg.Actor.Attributes["containers"]), when, ctx)
+			r.updateContainer(ID(msg.Actor.Attributes["container"]), when, ctx)
 		}
 	}
 	return nil
@@ -117,39 +194,66 @@ func (r *Repository) updateContainer(id ID, when time.Time, ctx context.Context)
 	}
 
 	logger := ctx.Value(LoggerKey).(log.Logger)
+	data, err := r.conn.ContainerInspect(ctx, string(id))
+	if err != nil {
+		if !client.IsErrNotFound(err) {
+			logger.Error("errror inspecting container", "error", err)
+			metrics.InspectErrors.Inc(r.Host, "container")
+			// It may still exist, so it must not be removed at the end of the synchronization
+			r.sync.Mark(id)
+		}
+		return
+	}
+
+	r.mu.Lock()
 	ctn, found := r.containers[id]
+	var previous Container
 	if !found {
 		ctn = &Container{ID: id, CreatedAt: when}
 		r.containers[id] = ctn
 		logger.Debug("added container")
 	} else {
+		// UpdateFrom builds new maps and slices, so the copy is not affected
+		previous = *ctn
 		logger.Debug("updating container")
 	}
+	ctn.UpdateFrom(data)
+	ctn.Host = r.Host
+	r.sync.Mark(id)
+	removed := ctn.Status.IsRemoved()
 
-	data, err := r.conn.ContainerInspect(ctx, string(id))
-	if err != nil {
-		if !client.IsErrNotFound(err) {
-			logger.Error("errror inspecting container", "error", err)
+	var changes []api.PatchOperation
+	if found && !removed {
+		if changes, err = api.Diff(&previous, ctn); err != nil {
+			logger.Error("error comparing container", "error", err)
+		} else if len(changes) == 0 {
+			r.mu.Unlock()
+			logger.Debug("unchanged container")
+			return
 		}
-		return
 	}
+	if !removed {
+		ctn.UpdatedAt = when
+	}
+	snapshot := *ctn
+	r.mu.Unlock()
 
-	ctn.UpdateFrom(data)
-	if ctn.Status.IsRemoved() {
+	if removed {
 		r.removeContainer(id, when, ctx)
 	} else {
-		ctn.UpdatedAt = when
-		r.dispatcher.Dispatch(&ContainerUpdated{when, ctn}, ctx)
+		r.dispatcher.Dispatch(&ContainerUpdated{when, &snapshot, changes}, ctx)
 	}
 }
 
 func (r *Repository) removeContainer(id ID, when time.Time, ctx context.Context) {
+	r.mu.Lock()
 	_, found := r.containers[id]
+	delete(r.containers, id)
+	r.mu.Unlock()
 	if !found {
 		return
 	}
-	delete(r.containers, id)
 	logger := ctx.Value(LoggerKey).(log.Logger)
 	logger.Debug("removed container")
-	r.dispatcher.Dispatch(&ContainerRemoved{when, string(id)}, ctx)
+	r.dispatcher.Dispatch(&ContainerRemoved{when, r.Host, string(id)}, ctx)
 }
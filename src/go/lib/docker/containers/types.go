@@ -1,8 +1,12 @@
 package containers
 
 import (
+	"flag"
 	"fmt"
+	"path"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -11,15 +15,22 @@ import (
 )
 
 type (
-	ID     string
-	Status string
+	ID             string
+	Status         string
+	DependencyKind string
+
+	// EnvPatterns is a list of glob patterns of environment variables ; as a flag, each value is added to the list,
+	// and an empty one clears it.
+	EnvPatterns []string
 
 	Container struct {
 		ID        ID
+		Host      string
 		CreatedAt time.Time
 		UpdatedAt time.Time
 		Name      string
 		Image     string
+		ImageID   string
 		Status    Status
 		Healthy   string   `json:",omitempty"`
 		Service   string   `json:",omitempty"`
@@ -27,6 +38,24 @@ type (
 		Networks  map[string]*Network
 		Mounts    []Mount
 		Ports     map[string]Port
+		Labels    map[string]string `json:",omitempty"`
+		// Env holds the environment variables ; the values that are not allowed by EnvAllowList are null.
+		Env        map[string]*string `json:",omitempty"`
+		Entrypoint []string           `json:",omitempty"`
+		Cmd        []string           `json:",omitempty"`
+		WorkingDir string             `json:",omitempty"`
+		User       string             `json:",omitempty"`
+		// RestartPolicy is formatted like the --restart option, e.g. "on-failure:3".
+		RestartPolicy string     `json:",omitempty"`
+		RestartCount  int        `json:",omitempty"`
+		ExitCode      int        `json:",omitempty"`
+		OOMKilled     bool       `json:",omitempty"`
+		StartedAt     *time.Time `json:",omitempty"`
+		FinishedAt    *time.Time `json:",omitempty"`
+		// Groups are the groups of the container, for each of the active groupings.
+		Groups []Group `json:",omitempty"`
+		// Dependencies are the containers and services that the container needs.
+		Dependencies []Dependency `json:",omitempty"`
 	}
 
 	Project struct {
@@ -51,26 +80,56 @@ type (
 		HostIp   string
 		HostPort int
 	}
+
+	// Dependency is declared by compose or by the options of the container ; it refers either to a service
+	// of the same project or to a container, by name or ID.
+	Dependency struct {
+		Kind      DependencyKind
+		Service   string `json:",omitempty"`
+		Container string `json:",omitempty"`
+		// Condition is the condition of depends_on, e.g. "service_healthy".
+		Condition string `json:",omitempty"`
+		// Alias is the hostname of a link.
+		Alias string `json:",omitempty"`
+	}
+)
+
+const (
+	DependsOn   DependencyKind = "depends_on"
+	Link        DependencyKind = "link"
+	NetworkMode DependencyKind = "network_mode"
+	VolumesFrom DependencyKind = "volumes_from"
 )
 
 var (
+	// EnvAllowList holds the glob patterns of the environment variables whose values are exposed.
+	EnvAllowList = EnvPatterns{"PATH", "HOME", "HOSTNAME", "LANG", "LC_*", "TZ", "TERM"}
+
+	// shortIDPattern matches the IDs that can be abbreviated, as the names can also be made of hexadecimal digits.
+	shortIDPattern = regexp.MustCompile(`^[0-9a-f]{12,64}$`)
+
 	_ fmt.Stringer = (*ID)(nil)
 	_ fmt.Stringer = (*Status)(nil)
+	_ fmt.Stringer = (*Dependency)(nil)
+	_ flag.Value   = (*EnvPatterns)(nil)
 )
 
 func (c *Container) UpdateFrom(data types.ContainerJSON) {
 	c.ID = ID(data.ID)
 	c.Name = data.Name[1:]
 	c.Image = data.Config.Image
+	c.ImageID = data.Image
 
-	if project, ok := data.Config.Labels["com.docker.compose.project"]; ok {
-		c.Project = &Project{
-			Name:       project,
-			WorkingDir: data.Config.Labels["com.docker.compose.project.working_dir"],
-		}
-	} else {
-		c.Project = nil
-	}
+	c.Labels = data.Config.Labels
+	c.Project = ProjectFromLabels(data.Config.Labels)
+	c.Service = data.Config.Labels["com.docker.compose.service"]
+	c.Groups = ActiveGroupings.GroupsOf(data.Config.Labels)
+
+	c.Entrypoint = data.Config.Entrypoint
+	c.Cmd = data.Config.Cmd
+	c.WorkingDir = data.Config.WorkingDir
+	c.User = data.Config.User
+	c.mapEnv(data.Config.Env)
 
 	c.Status = Status(data.State.Status)
 	if c.Status.IsRunning() && data.State.Health != nil {
@@ -78,19 +137,102 @@ func (c *Container) UpdateFrom(data types.ContainerJSON) {
 	} else {
 		c.Healthy = ""
 	}
+	c.ExitCode = data.State.ExitCode
+	c.OOMKilled = data.State.OOMKilled
+	c.StartedAt = parseStateTime(data.State.StartedAt)
+	c.FinishedAt = parseStateTime(data.State.FinishedAt)
+	c.RestartCount = data.RestartCount
+	c.RestartPolicy = ""
+	if data.HostConfig != nil {
+		switch policy := data.HostConfig.RestartPolicy; {
+		case policy.Name == "" || policy.Name == "no":
+		case policy.MaximumRetryCount > 0:
+			c.RestartPolicy = fmt.Sprintf("%s:%d", policy.Name, policy.MaximumRetryCount)
+		default:
+			c.RestartPolicy = policy.Name
+		}
+	}
 	c.mapMounts(data.Mounts)
 	c.mapPorts(data.NetworkSettings.Ports)
 	c.mapNetworks(data.NetworkSettings.Networks)
+	c.mapDependencies(data)
+}
+
+func ProjectFromLabels(labels map[string]string) *Project {
+	if project, ok := labels["com.docker.compose.project"]; ok {
+		return &Project{
+			Name:       project,
+			WorkingDir: labels["com.docker.compose.project.working_dir"],
+		}
+	}
+	return nil
 }
 
 func (c *Container) LastUpdateTime() time.Time {
-	if c.UpdatedAt.IsZero() {
+	if !c.UpdatedAt.IsZero() {
 		return c.UpdatedAt
 	}
 	return c.CreatedAt
 }
 
+// mapEnv keeps the names of the environment variables, and the values of the allowed ones.
+func (c *Container) mapEnv(env []string) {
+	if len(env) == 0 {
+		c.Env = nil
+		return
+	}
+	c.Env = make(map[string]*string, len(env))
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		if IsEnvAllowed(name) {
+			c.Env[name] = &value
+		} else {
+			c.Env[name] = nil
+		}
+	}
+}
+
+func (l *EnvPatterns) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *EnvPatterns) Set(value string) error {
+	if value == "" {
+		*l = nil
+		return nil
+	}
+	if _, err := path.Match(value, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", value, err)
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// IsEnvAllowed tells whether the value of an environment variable can be exposed.
+func IsEnvAllowed(name string) bool {
+	for _, pattern := range EnvAllowList {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStateTime parses the times of the state of a container ; Docker uses the zero time for the events that
+// did not happen.
+func parseStateTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 func (c *Container) mapMounts(mounts []types.MountPoint) {
+	c.Mounts = make([]Mount, 0, len(mounts))
 	for _, mount := range mounts {
 		c.Mounts = append(c.Mounts, Mount{
 			Type:        string(mount.Type),
@@ -133,26 +275,81 @@ func getPortBinding(something interface{}) (*nat.PortBinding, bool) {
 }
 
 func (c *Container) mapNetworks(networks map[string]*network.EndpointSettings) {
-	if c.Networks == nil && len(networks) > 0 {
-		c.Networks = make(map[string]*Network, len(networks))
-	} else if len(networks) == 0 {
+	// Always build a new map, so copies of the container are not affected
+	if len(networks) == 0 {
 		c.Networks = nil
 		return
 	}
+	c.Networks = make(map[string]*Network, len(networks))
 	for key, netData := range networks {
-		dest, found := c.Networks[key]
-		if !found {
-			dest = &Network{}
-			c.Networks[key] = dest
-			dest.Name = key
+		c.Networks[key] = &Network{ID: netData.NetworkID, Name: key}
+	}
+}
+
+// mapDependencies reads the depends_on label of compose, and the links, network mode and volumes_from options.
+func (c *Container) mapDependencies(data types.ContainerJSON) {
+	c.Dependencies = nil
+	// The label looks like "db:service_healthy:true,cache:service_started:false"
+	if label := data.Config.Labels["com.docker.compose.depends_on"]; label != "" {
+		for _, entry := range strings.Split(label, ",") {
+			service, rest, _ := strings.Cut(strings.TrimSpace(entry), ":")
+			condition, _, _ := strings.Cut(rest, ":")
+			if service != "" {
+				c.Dependencies = append(c.Dependencies, Dependency{Kind: DependsOn, Service: service, Condition: condition})
+			}
 		}
-		dest.ID = netData.NetworkID
 	}
-	for key := range c.Networks {
-		if _, found := networks[key]; !found {
-			delete(c.Networks, key)
+	if data.HostConfig == nil {
+		return
+	}
+	// The links look like "/db-1:/web-1/db"
+	for _, link := range data.HostConfig.Links {
+		target, alias, _ := strings.Cut(link, ":")
+		if slash := strings.LastIndex(alias, "/"); slash >= 0 {
+			alias = alias[slash+1:]
 		}
+		c.Dependencies = append(c.Dependencies, Dependency{Kind: Link, Container: strings.TrimPrefix(target, "/"), Alias: alias})
+	}
+	if mode := data.HostConfig.NetworkMode; mode.IsContainer() {
+		c.Dependencies = append(c.Dependencies, Dependency{Kind: NetworkMode, Container: mode.ConnectedContainer()})
+	}
+	// The entries look like "name[:ro]"
+	for _, from := range data.HostConfig.VolumesFrom {
+		target, _, _ := strings.Cut(from, ":")
+		c.Dependencies = append(c.Dependencies, Dependency{Kind: VolumesFrom, Container: target})
+	}
+}
+
+// DependsOn tells whether the other container satisfies the dependency ; they must be on the same host and,
+// for the services, in the same project.
+func (c *Container) DependsOn(dep Dependency, other *Container) bool {
+	switch {
+	case c.Host != other.Host || c.ID == other.ID:
+		return false
+	case dep.Service != "":
+		return other.Service == dep.Service && c.Project != nil && other.Project != nil && *c.Project == *other.Project
+	case dep.Container != "":
+		// Docker accepts short IDs, of at least 12 digits so they cannot be mistaken for names like "db"
+		if other.Name == dep.Container {
+			return true
+		}
+		return shortIDPattern.MatchString(dep.Container) && strings.HasPrefix(string(other.ID), dep.Container)
+	}
+	return false
+}
+
+func (d Dependency) String() string {
+	target := d.Container
+	if d.Service != "" {
+		target = "service " + d.Service
+	}
+	switch {
+	case d.Condition != "":
+		return fmt.Sprintf("%s %s (%s)", d.Kind, target, d.Condition)
+	case d.Alias != "":
+		return fmt.Sprintf("%s %s as %s", d.Kind, target, d.Alias)
 	}
+	return fmt.Sprintf("%s %s", d.Kind, target)
 }
 
 func (i ID) String() string {
@@ -0,0 +1,207 @@
+package containers
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestDependsOn(t *testing.T) {
+	project := &Project{Name: "p", WorkingDir: "/src/p"}
+	ctn := &Container{Host: "h", ID: "1111", Name: "app", Project: project}
+	db := &Container{
+		Host:    "h",
+		ID:      "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+		Name:    "db",
+		Service: "db",
+		Project: &Project{Name: "p", WorkingDir: "/src/p"},
+	}
+	// The name of this one is a prefix of the ID of db
+	abc := &Container{Host: "h", ID: "2222", Name: "abc"}
+
+	tests := []struct {
+		name  string
+		dep   Dependency
+		other *Container
+		want  bool
+	}{
+		{"service", Dependency{Service: "db"}, db, true},
+		{"other service", Dependency{Service: "web"}, db, false},
+		{"service of another project", Dependency{Service: "db"}, &Container{Host: "h", ID: "3333", Service: "db", Project: &Project{Name: "q"}}, false},
+		{"name", Dependency{Container: "db"}, db, true},
+		{"full ID", Dependency{Container: string(db.ID)}, db, true},
+		{"short ID", Dependency{Container: "abcdef012345"}, db, true},
+		{"too short ID", Dependency{Container: "abcdef"}, db, false},
+		{"name that looks like an ID prefix", Dependency{Container: "abc"}, db, false},
+		{"name that is an ID prefix", Dependency{Container: "abc"}, abc, true},
+		{"uppercase ID", Dependency{Container: "ABCDEF012345"}, db, false},
+		{"other host", Dependency{Container: "db"}, &Container{Host: "other", ID: db.ID, Name: "db"}, false},
+		{"itself", Dependency{Container: "app"}, ctn, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ctn.DependsOn(tt.dep, tt.other); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// withEnvAllowList replaces the allow-list during a test.
+func withEnvAllowList(t *testing.T, patterns ...string) {
+	t.Helper()
+	saved := EnvAllowList
+	EnvAllowList = patterns
+	t.Cleanup(func() { EnvAllowList = saved })
+}
+
+func TestIsEnvAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"PATH", true},
+		{"HOSTNAME", true},
+		{"LC_ALL", true},
+		{"LC_", true},
+		{"LCALL", false},
+		{"path", false},
+		{"PATHS", false},
+		{"DB_PASSWORD", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEnvAllowed(tt.name); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapEnv(t *testing.T) {
+	withEnvAllowList(t, "PATH", "LC_*", "APP_*")
+	value := func(s string) *string { return &s }
+
+	tests := []struct {
+		name string
+		env  []string
+		want map[string]*string
+	}{
+		{"no environment", nil, nil},
+		{"empty environment", []string{}, nil},
+		{
+			"allowed and hidden values",
+			[]string{"PATH=/bin", "LC_ALL=C", "DB_PASSWORD=secret", "HOSTNAME=web"},
+			map[string]*string{"PATH": value("/bin"), "LC_ALL": value("C"), "DB_PASSWORD": nil, "HOSTNAME": nil},
+		},
+		{
+			"values with equal signs and no value",
+			[]string{"APP_OPTS=a=b", "APP_EMPTY=", "APP_UNSET", "TOKEN=a=b"},
+			map[string]*string{"APP_OPTS": value("a=b"), "APP_EMPTY": value(""), "APP_UNSET": value(""), "TOKEN": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Container
+			c.mapEnv(tt.env)
+			if !reflect.DeepEqual(c.Env, tt.want) {
+				t.Errorf("unexpected env: %s, want %s", formatEnv(c.Env), formatEnv(tt.want))
+			}
+		})
+	}
+}
+
+func formatEnv(env map[string]*string) map[string]any {
+	if env == nil {
+		return nil
+	}
+	formatted := make(map[string]any, len(env))
+	for name, value := range env {
+		if value == nil {
+			formatted[name] = nil
+		} else {
+			formatted[name] = *value
+		}
+	}
+	return formatted
+}
+
+func TestEnvPatternsFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    EnvPatterns
+		wantErr bool
+	}{
+		{"defaults", nil, EnvPatterns{"PATH", "LC_*"}, false},
+		{"added", []string{"-envAllow", "APP_*", "-envAllow", "NODE_ENV"}, EnvPatterns{"PATH", "LC_*", "APP_*", "NODE_ENV"}, false},
+		{"cleared", []string{"-envAllow", ""}, nil, false},
+		{"replaced", []string{"-envAllow", "", "-envAllow", "PATH"}, EnvPatterns{"PATH"}, false},
+		{"cleared after", []string{"-envAllow", "APP_*", "-envAllow", ""}, nil, false},
+		{"invalid pattern", []string{"-envAllow", "APP_["}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns := EnvPatterns{"PATH", "LC_*"}
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.SetOutput(io.Discard)
+			flags.Var(&patterns, "envAllow", "")
+			err := flags.Parse(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", patterns)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(patterns, tt.want) {
+				t.Errorf("unexpected patterns: %#v, want %#v", patterns, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *container.RestartPolicy
+		want   string
+	}{
+		{"no host config", nil, ""},
+		{"default", &container.RestartPolicy{}, ""},
+		{"no", &container.RestartPolicy{Name: "no"}, ""},
+		{"always", &container.RestartPolicy{Name: "always"}, "always"},
+		{"unless stopped", &container.RestartPolicy{Name: "unless-stopped"}, "unless-stopped"},
+		{"on failure", &container.RestartPolicy{Name: "on-failure"}, "on-failure"},
+		{"on failure with retries", &container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}, "on-failure:3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{
+					ID:    "1111",
+					Name:  "/app",
+					State: &types.ContainerState{Status: "running"},
+				},
+				Config:          &container.Config{Image: "app"},
+				NetworkSettings: &types.NetworkSettings{},
+			}
+			if tt.policy != nil {
+				data.HostConfig = &container.HostConfig{RestartPolicy: *tt.policy}
+			}
+			// A previous policy must not be kept
+			c := Container{RestartPolicy: "always"}
+			c.UpdateFrom(data)
+			if c.RestartPolicy != tt.want {
+				t.Errorf("got %q, want %q", c.RestartPolicy, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package hosts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/images"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/listeners"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/networks"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/stats"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/swarm"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/volumes"
+	log "github.com/inconshreveable/log15"
+	"github.com/thejerf/suture/v4"
+)
+
+type (
+	// Host groups the listener and the repositories of a Docker host, under their own supervisor.
+	Host struct {
+		*suture.Supervisor
+
+		Name       string
+		Connection *connections.Manager
+		Listener   *listeners.Listener
+		Containers *containers.Repository
+		Networks   *networks.Repository
+		Volumes    *volumes.Repository
+		Images     *images.Repository
+		// Swarm is only set when EnableSwarm has been called.
+		Swarm *swarm.Repository
+		// Stats is only set when EnableStats has been called.
+		Stats *stats.Collector
+	}
+
+	Dispatcher interface {
+		containers.Dispatcher
+		listeners.Dispatcher
+	}
+)
+
+var (
+	_ suture.Service = (*Host)(nil)
+	_ fmt.GoStringer = (*Host)(nil)
+
+	Log = log.New()
+)
+
+// NewHost creates the services of a host, which share a connection created by connFactory.
+func NewHost(name string, connFactory connections.Factory, dispatcher Dispatcher) (h *Host) {
+	manager := connections.NewManager(connFactory)
+	h = &Host{
+		Name: name,
+		Supervisor: suture.New("host:"+name, suture.Spec{
+			EventHook: func(ev suture.Event) {
+				Log.Error(ev.String(), "host", name, "type", ev.Type(), "context", log.Ctx(ev.Map()))
+			},
+		}),
+		Connection: manager,
+		Containers: containers.NewRepository(dispatcher, manager),
+		Networks:   networks.NewRepository(dispatcher, manager),
+		Volumes:    volumes.NewRepository(dispatcher, manager),
+		Images:     images.NewRepository(dispatcher, manager),
+	}
+	h.Containers.Host = name
+	h.Networks.Host = name
+	h.Volumes.Host = name
+	h.Images.Host = name
+
+	h.Listener = listeners.NewListener(manager, dispatcher, h.Containers, h.Networks, h.Volumes, h.Images)
+	h.Listener.Host = name
+
+	h.Add(h.Connection)
+	h.Add(h.Containers)
+	h.Add(h.Networks)
+	h.Add(h.Volumes)
+	h.Add(h.Images)
+	h.Add(h.Listener)
+	return
+}
+
+// EnableSwarm adds the tracking of the swarm resources ; it must be called before the host is started.
+func (h *Host) EnableSwarm(dispatcher Dispatcher) {
+	h.Swarm = swarm.NewRepository(dispatcher, h.Connection)
+	h.Swarm.Host = h.Name
+	h.Listener.Swarm = true
+	h.Listener.AddProcessor(h.Swarm)
+	h.Add(h.Swarm)
+}
+
+// EnableStats adds the collection of the resource usage of the containers, which is dispatched separately from
+// the other events ; it must be called before the host is started.
+func (h *Host) EnableStats(dispatcher containers.Dispatcher, interval time.Duration) {
+	h.Stats = stats.NewCollector(dispatcher, h.Connection, h.Containers)
+	h.Stats.Host = h.Name
+	h.Stats.Interval = interval
+	h.Add(h.Stats)
+}
+
+func (h *Host) GoString() string {
+	return fmt.Sprintf("hosts.Host(%s)", h.Name)
+}
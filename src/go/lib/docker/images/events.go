@@ -0,0 +1,58 @@
+package images
+
+import (
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+)
+
+type (
+	ImageUpdated struct {
+		when time.Time
+		data *Image
+	}
+
+	ImageRemoved struct {
+		when time.Time
+		host string
+		id   string
+	}
+)
+
+var (
+	_ api.Event = (*ImageUpdated)(nil)
+	_ api.Event = (*ImageRemoved)(nil)
+)
+
+const (
+	IDFormat = time.RFC3339Nano
+)
+
+func (i *ImageUpdated) ID() string {
+	return i.when.Format(IDFormat)
+}
+
+func (i *ImageUpdated) Data() any {
+	return api.EventDTO{
+		TargetType: "image",
+		Host:       i.data.Host,
+		TargetID:   string(i.data.ID),
+		Type:       "updated",
+		Time:       i.when,
+		Details:    i.data,
+	}
+}
+
+func (i *ImageRemoved) ID() string {
+	return i.when.Format(IDFormat)
+}
+
+func (i *ImageRemoved) Data() any {
+	return api.EventDTO{
+		TargetType: "image",
+		Host:       i.host,
+		TargetID:   i.id,
+		Type:       "removed",
+		Time:       i.when,
+	}
+}
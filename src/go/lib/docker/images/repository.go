@@ -0,0 +1,260 @@
+package images
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/listeners"
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+	log "github.com/inconshreveable/log15"
+	"github.com/thejerf/suture/v4"
+)
+
+var (
+	Log       = log.New()
+	LoggerKey = struct{}{}
+)
+
+type (
+	Repository struct {
+		ConnFactory connections.Factory
+		// Host is the name of the Docker host, used to tag the resources.
+		Host string
+
+		conn       connections.Connection
+		dispatcher containers.Dispatcher
+		messages   chan events.Message
+		images     map[ID]*Image
+		mu         sync.RWMutex
+		sync       *listeners.SyncTracker[ID]
+	}
+)
+
+var (
+	_ suture.Service         = (*Repository)(nil)
+	_ fmt.GoStringer         = (*Repository)(nil)
+	_ listeners.Synchronizer = (*Repository)(nil)
+
+	// MaxParents limits the length of the parent chains.
+	MaxParents = 100
+)
+
+func NewRepository(dispatcher containers.Dispatcher, connFactory connections.Factory) (r *Repository) {
+	r = &Repository{
+		dispatcher:  dispatcher,
+		ConnFactory: connFactory,
+		messages:    make(chan events.Message, 50),
+		images:      make(map[ID]*Image, 10),
+		sync:        listeners.NewSyncTracker[ID](),
+	}
+	dispatcher.OnNewSubscriber(r.primeNewSubscriber)
+	return r
+}
+
+func (r *Repository) GoString() string {
+	return fmt.Sprintf("images.Repository(%d, %d/%d)", len(r.images), len(r.messages), cap(r.messages))
+}
+
+// Len returns the number of known images.
+func (r *Repository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.images)
+}
+
+// Pending returns the number of messages waiting to be handled.
+func (r *Repository) Pending() int {
+	return len(r.messages)
+}
+
+func (r *Repository) Serve(ctx context.Context) (err error) {
+	r.conn, err = r.ConnFactory.CreateConn(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = r.conn.Close()
+		r.conn = nil
+	}()
+
+	dropped := connections.Dropped(r.conn)
+	for err == nil {
+		select {
+		case msg := <-r.messages:
+			err = r.handleMessage(msg, ctx)
+		case <-dropped:
+			return connections.ErrConnectionDropped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return
+}
+
+func (r *Repository) Process(msg events.Message) {
+	if msg.Type == "image" || msg.Type == listeners.SyncMessageType {
+		r.messages <- msg
+	}
+}
+
+// List returns copies of all known images, sorted by ID.
+func (r *Repository) List() []Image {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Image, 0, len(r.images))
+	for _, img := range r.images {
+		list = append(list, *img)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (r *Repository) primeNewSubscriber() []api.Event {
+	list := r.List()
+	Log.Debug("new subscriber", "#img", len(list))
+	events := make([]api.Event, len(list))
+	for i := range list {
+		events[i] = &ImageUpdated{list[i].LastUpdateTime(), &list[i]}
+	}
+	return events
+}
+
+func (r *Repository) Synced() <-chan struct{} {
+	return r.sync.Synced()
+}
+
+func (r *Repository) handleSync(action string, when time.Time, ctx context.Context) {
+	switch action {
+	case listeners.SyncStartAction:
+		r.sync.Start()
+	case listeners.SyncEndAction:
+		r.mu.RLock()
+		known := make([]ID, 0, len(r.images))
+		for id := range r.images {
+			known = append(known, id)
+		}
+		r.mu.RUnlock()
+		for _, id := range r.sync.End(known) {
+			r.removeImage(id, when, ctx)
+		}
+	}
+}
+
+func (r *Repository) handleMessage(msg events.Message, ctx context.Context) error {
+	logger := Log.New(log.Ctx{"host": r.Host, "ref": msg.Actor.ID, "action": msg.Action})
+	ctx = context.WithValue(ctx, LoggerKey, logger)
+	when := time.Unix(0, msg.TimeNano)
+	if msg.Type == listeners.SyncMessageType {
+		r.handleSync(msg.Action, when, ctx)
+		return nil
+	}
+	switch msg.Action {
+	case "delete":
+		r.removeImage(ID(msg.Actor.ID), when, ctx)
+	case "pull", "tag", "untag", "import", "load", "create":
+		// Pull events are identified by the reference, not the image ID
+		id := r.updateImage(msg.Actor.ID, when, ctx)
+		tag := msg.Actor.Attributes["name"]
+		if msg.Action == "pull" {
+			tag = msg.Actor.ID
+		}
+		if tag != "" {
+			r.refreshTagged(tag, id, when, ctx)
+		}
+	}
+	return nil
+}
+
+// refreshTagged inspects again the images, but the one identified by except, that were known to have the given tag.
+func (r *Repository) refreshTagged(tag string, except ID, when time.Time, ctx context.Context) {
+	for _, img := range r.List() {
+		if img.ID != except && img.HasTag(tag) {
+			r.updateImage(string(img.ID), when, ctx)
+		}
+	}
+}
+
+func (r *Repository) updateImage(ref string, when time.Time, ctx context.Context) ID {
+	if ref == "" {
+		return ""
+	}
+
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	data, _, err := r.conn.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			r.removeImage(ID(ref), when, ctx)
+		} else {
+			logger.Error("error inspecting image", "error", err)
+			metrics.InspectErrors.Inc(r.Host, "image")
+			// It may still exist, so it must not be removed at the end of the synchronization
+			r.sync.Mark(ID(ref))
+		}
+		return ""
+	}
+
+	id := ID(data.ID)
+	parents := r.resolveParents(ID(data.Parent), ctx)
+
+	r.mu.Lock()
+	img, found := r.images[id]
+	if !found {
+		img = &Image{ID: id}
+		r.images[id] = img
+		logger.Debug("added image")
+	} else {
+		logger.Debug("updating image")
+	}
+	img.UpdateFrom(data)
+	img.Host = r.Host
+	r.sync.Mark(id)
+	img.Parents = parents
+	img.UpdatedAt = when
+	snapshot := *img
+	r.mu.Unlock()
+
+	r.dispatcher.Dispatch(&ImageUpdated{when, &snapshot}, ctx)
+	return id
+}
+
+func (r *Repository) resolveParents(parent ID, ctx context.Context) (parents []ID) {
+	for parent != "" && len(parents) < MaxParents {
+		parents = append(parents, parent)
+		r.mu.RLock()
+		img, found := r.images[parent]
+		if found {
+			parents = append(parents, img.Parents...)
+		}
+		r.mu.RUnlock()
+		if found {
+			return
+		}
+		data, _, err := r.conn.ImageInspectWithRaw(ctx, string(parent))
+		if err != nil {
+			break
+		}
+		parent = ID(data.Parent)
+	}
+	return
+}
+
+func (r *Repository) removeImage(id ID, when time.Time, ctx context.Context) {
+	r.mu.Lock()
+	_, found := r.images[id]
+	delete(r.images, id)
+	r.mu.Unlock()
+	if !found {
+		return
+	}
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	logger.Debug("removed image")
+	r.dispatcher.Dispatch(&ImageRemoved{when, r.Host, string(id)}, ctx)
+}
@@ -0,0 +1,58 @@
+package images
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+type (
+	ID string
+
+	Image struct {
+		ID          ID
+		Host        string
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+		RepoTags    []string `json:",omitempty"`
+		RepoDigests []string `json:",omitempty"`
+		Size        int64
+		// Parents lists the ancestors of the image, starting from its direct parent.
+		Parents []ID `json:",omitempty"`
+	}
+)
+
+var (
+	_ fmt.Stringer = (*ID)(nil)
+)
+
+func (i *Image) UpdateFrom(data types.ImageInspect) {
+	i.ID = ID(data.ID)
+	i.RepoTags = data.RepoTags
+	i.RepoDigests = data.RepoDigests
+	i.Size = data.Size
+	if createdAt, err := time.Parse(time.RFC3339Nano, data.Created); err == nil {
+		i.CreatedAt = createdAt
+	}
+}
+
+func (i *Image) LastUpdateTime() time.Time {
+	if !i.UpdatedAt.IsZero() {
+		return i.UpdatedAt
+	}
+	return i.CreatedAt
+}
+
+func (i *Image) HasTag(tag string) bool {
+	for _, repoTag := range i.RepoTags {
+		if repoTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (i ID) String() string {
+	return string(i)
+}
@@ -5,10 +5,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/adirelle/docker-graph/src/go/lib/api"
 	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
-	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/thejerf/suture/v4"
 
 	log "github.com/inconshreveable/log15"
@@ -16,12 +17,40 @@ import (
 
 type (
 	Listener struct {
+		// Host is the name of the Docker host, used to tag the control events.
+		Host string
+		// Swarm enables the priming of the swarm resources, when the host is a swarm manager.
+		Swarm bool
+
 		connFactory     connections.Factory
-		repository      *containers.Repository
+		dispatcher      Dispatcher
+		processors      []Processor
 		lastMessageTime time.Time
+		primed          bool
+	}
+
+	Processor interface {
+		Process(events.Message)
+	}
+
+	// Synchronizer is implemented by the processors that can tell when they have handled a SyncEndAction message.
+	Synchronizer interface {
+		Synced() <-chan struct{}
+	}
+
+	Dispatcher interface {
+		Dispatch(value api.Event, ctx context.Context) error
 	}
 )
 
+const (
+	// SyncMessageType is the type of the messages that surround the messages sent to prime the processors.
+	// Processors should forget about the resources that have not been primed between SyncStartAction and SyncEndAction.
+	SyncMessageType = "docker-graph"
+	SyncStartAction = "sync-start"
+	SyncEndAction   = "sync-end"
+)
+
 var (
 	_ suture.Service = (*Listener)(nil)
 	_ fmt.GoStringer = (*Listener)(nil)
@@ -29,58 +58,183 @@ var (
 	Log = log.New()
 )
 
-func NewListener(connFactory connections.Factory, repository *containers.Repository) *Listener {
+func NewListener(connFactory connections.Factory, dispatcher Dispatcher, processors ...Processor) *Listener {
 	return &Listener{
 		connFactory: connFactory,
-		repository:  repository,
+		dispatcher:  dispatcher,
+		processors:  processors,
 	}
 }
 
+// AddProcessor registers a processor ; it must be called before the listener is started.
+func (m *Listener) AddProcessor(processor Processor) {
+	m.processors = append(m.processors, processor)
+}
+
 func (m *Listener) GoString() string {
-	return "Listener"
+	return fmt.Sprintf("Listener(%s)", m.Host)
 }
 
-func (m *Listener) Serve(ctx context.Context) error {
-	conn, err := m.connFactory.CreateConn()
+func (m *Listener) Serve(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil && ctx.Err() == nil {
+			m.dispatcher.Dispatch(&api.ControlEvent{Type: "daemon-disconnected", Host: m.Host, When: time.Now()}, ctx)
+		}
+	}()
+
+	conn, err := m.connFactory.CreateConn(ctx)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	// Prime with existing containers
-	if m.lastMessageTime.IsZero() {
-		if err := m.prime(ctx, conn); err != nil {
-			return err
-		}
+	// Listen for events before priming, so none is missed
+	since := time.Now()
+	if !m.lastMessageTime.IsZero() && m.lastMessageTime.Before(since) {
+		since = m.lastMessageTime
+	}
+	eventC, errC := conn.Events(ctx, types.EventsOptions{Since: since.Format(time.RFC3339)})
+
+	// Prime with existing resources ; after a reconnection, the daemon could have been restarted,
+	// so the processors must drop the resources that do not exist anymore.
+	if m.primed {
+		m.dispatcher.Dispatch(&api.ControlEvent{Type: "reset", Host: m.Host, When: time.Now()}, ctx)
+	}
+	m.process(events.Message{Type: SyncMessageType, Action: SyncStartAction, TimeNano: time.Now().UnixNano()})
+	if err := m.prime(ctx, conn); err != nil {
+		return err
 	}
+	m.process(events.Message{Type: SyncMessageType, Action: SyncEndAction, TimeNano: time.Now().UnixNano()})
+	m.primed = true
+	go m.waitSynced(ctx)
 
-	// Listen for events
-	eventC, errC := conn.Events(ctx, types.EventsOptions{Since: m.lastMessageTime.Format(time.RFC3339)})
+	dropped := connections.Dropped(conn)
 	for {
 		select {
 		case msg := <-eventC:
-			Log.Debug("received message", "type", msg.Type, "action", msg.Action, "actor_id", msg.Actor.ID)
+			Log.Debug("received message", "host", m.Host, "type", msg.Type, "action", msg.Action, "actor_id", msg.Actor.ID)
 			m.lastMessageTime = time.Unix(0, msg.TimeNano)
-			m.repository.Process(msg)
+			m.process(msg)
 		case err = <-errC:
 			return err
+		case <-dropped:
+			return connections.ErrConnectionDropped
 		case <-ctx.Done():
 			return ctx.Err()
 		}
 	}
 }
 
+func (m *Listener) process(msg events.Message) {
+	for _, processor := range m.processors {
+		processor.Process(msg)
+	}
+}
+
+// waitSynced waits for the processors to handle the priming messages, then dispatches a "synced" event.
+func (m *Listener) waitSynced(ctx context.Context) {
+	for _, processor := range m.processors {
+		if sync, ok := processor.(Synchronizer); ok {
+			select {
+			case <-sync.Synced():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	m.dispatcher.Dispatch(&api.ControlEvent{Type: "synced", Host: m.Host, When: time.Now()}, ctx)
+}
+
 func (m *Listener) prime(ctx context.Context, conn connections.Connection) error {
+	images, err := conn.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		m.primeWith("image", img.ID, time.Unix(img.Created, 0))
+	}
+
+	networks, err := conn.NetworkList(ctx, types.NetworkListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, net := range networks {
+		m.primeWith("network", net.ID, net.Created)
+	}
+
+	volumeList, err := conn.VolumeList(ctx, filters.Args{})
+	if err != nil {
+		return err
+	}
+	for _, vol := range volumeList.Volumes {
+		// The creation date is optional, primeWith handles the zero time
+		created, _ := time.Parse(time.RFC3339, vol.CreatedAt)
+		m.primeWith("volume", vol.Name, created)
+	}
+
 	containers, err := conn.ContainerList(ctx, types.ContainerListOptions{All: true})
 	if err != nil {
 		return err
 	}
-	for i, ctn := range containers {
-		created := time.Unix(ctn.Created, 0)
-		if i == 0 || created.After(m.lastMessageTime) {
-			m.lastMessageTime = created
-		}
-		m.repository.Process(events.Message{Type: "container", Action: "create", ID: ctn.ID, TimeNano: created.UnixNano()})
+	for _, ctn := range containers {
+		m.primeWith("container", ctn.ID, time.Unix(ctn.Created, 0))
+	}
+
+	if m.Swarm {
+		return m.primeSwarm(ctx, conn)
 	}
 	return nil
 }
+
+// primeSwarm primes the swarm resources ; only the managers can list them.
+func (m *Listener) primeSwarm(ctx context.Context, conn connections.Connection) error {
+	info, err := conn.Info(ctx)
+	if err != nil {
+		return err
+	}
+	if !info.Swarm.ControlAvailable {
+		return nil
+	}
+
+	nodes, err := conn.NodeList(ctx, types.NodeListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		m.primeWith("node", node.ID, node.CreatedAt)
+	}
+
+	configs, err := conn.ConfigList(ctx, types.ConfigListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		m.primeWith("config", config.ID, config.CreatedAt)
+	}
+
+	secrets, err := conn.SecretList(ctx, types.SecretListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		m.primeWith("secret", secret.ID, secret.CreatedAt)
+	}
+
+	services, err := conn.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		m.primeWith("service", service.ID, service.CreatedAt)
+	}
+
+	// The tasks are not primed: the repository lists them with their service
+	return nil
+}
+
+func (m *Listener) primeWith(typ, id string, created time.Time) {
+	if created.IsZero() {
+		created = time.Now()
+	}
+	m.process(events.Message{Type: typ, Action: "create", ID: id, Actor: events.Actor{ID: id}, TimeNano: created.UnixNano()})
+}
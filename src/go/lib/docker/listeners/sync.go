@@ -0,0 +1,48 @@
+package listeners
+
+type (
+	// SyncTracker helps processors to find out the resources that have not been primed during a synchronization.
+	// It is not safe for concurrent use, and should only be used from the goroutine processing the messages.
+	SyncTracker[K comparable] struct {
+		seen   map[K]bool
+		synced chan struct{}
+	}
+)
+
+func NewSyncTracker[K comparable]() *SyncTracker[K] {
+	return &SyncTracker[K]{synced: make(chan struct{}, 1)}
+}
+
+// Start begins a synchronization.
+func (t *SyncTracker[K]) Start() {
+	t.seen = make(map[K]bool)
+}
+
+// Mark records that the resource has been seen, if a synchronization is in progress.
+func (t *SyncTracker[K]) Mark(key K) {
+	if t.seen != nil {
+		t.seen[key] = true
+	}
+}
+
+// End ends the synchronization and returns the known resources that have not been seen.
+func (t *SyncTracker[K]) End(known []K) (stale []K) {
+	if t.seen != nil {
+		for _, key := range known {
+			if !t.seen[key] {
+				stale = append(stale, key)
+			}
+		}
+		t.seen = nil
+	}
+	select {
+	case t.synced <- struct{}{}:
+	default:
+	}
+	return
+}
+
+// Synced is signaled each time a synchronization ends.
+func (t *SyncTracker[K]) Synced() <-chan struct{} {
+	return t.synced
+}
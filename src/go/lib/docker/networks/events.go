@@ -0,0 +1,58 @@
+package networks
+
+import (
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+)
+
+type (
+	NetworkUpdated struct {
+		when time.Time
+		data *Network
+	}
+
+	NetworkRemoved struct {
+		when time.Time
+		host string
+		id   string
+	}
+)
+
+var (
+	_ api.Event = (*NetworkUpdated)(nil)
+	_ api.Event = (*NetworkRemoved)(nil)
+)
+
+const (
+	IDFormat = time.RFC3339Nano
+)
+
+func (n *NetworkUpdated) ID() string {
+	return n.when.Format(IDFormat)
+}
+
+func (n *NetworkUpdated) Data() any {
+	return api.EventDTO{
+		TargetType: "network",
+		Host:       n.data.Host,
+		TargetID:   string(n.data.ID),
+		Type:       "updated",
+		Time:       n.when,
+		Details:    n.data,
+	}
+}
+
+func (n *NetworkRemoved) ID() string {
+	return n.when.Format(IDFormat)
+}
+
+func (n *NetworkRemoved) Data() any {
+	return api.EventDTO{
+		TargetType: "network",
+		Host:       n.host,
+		TargetID:   n.id,
+		Type:       "removed",
+		Time:       n.when,
+	}
+}
@@ -0,0 +1,215 @@
+package networks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/listeners"
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+	log "github.com/inconshreveable/log15"
+	"github.com/thejerf/suture/v4"
+)
+
+var (
+	Log       = log.New()
+	LoggerKey = struct{}{}
+)
+
+type (
+	Repository struct {
+		ConnFactory connections.Factory
+		// Host is the name of the Docker host, used to tag the resources.
+		Host string
+
+		conn       connections.Connection
+		dispatcher containers.Dispatcher
+		messages   chan events.Message
+		networks   map[ID]*Network
+		mu         sync.RWMutex
+		sync       *listeners.SyncTracker[ID]
+	}
+)
+
+var (
+	_ suture.Service         = (*Repository)(nil)
+	_ fmt.GoStringer         = (*Repository)(nil)
+	_ listeners.Synchronizer = (*Repository)(nil)
+)
+
+func NewRepository(dispatcher containers.Dispatcher, connFactory connections.Factory) (r *Repository) {
+	r = &Repository{
+		dispatcher:  dispatcher,
+		ConnFactory: connFactory,
+		messages:    make(chan events.Message, 50),
+		networks:    make(map[ID]*Network, 10),
+		sync:        listeners.NewSyncTracker[ID](),
+	}
+	dispatcher.OnNewSubscriber(r.primeNewSubscriber)
+	return r
+}
+
+func (r *Repository) GoString() string {
+	return fmt.Sprintf("networks.Repository(%d, %d/%d)", len(r.networks), len(r.messages), cap(r.messages))
+}
+
+// Len returns the number of known networks.
+func (r *Repository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.networks)
+}
+
+// Pending returns the number of messages waiting to be handled.
+func (r *Repository) Pending() int {
+	return len(r.messages)
+}
+
+func (r *Repository) Serve(ctx context.Context) (err error) {
+	r.conn, err = r.ConnFactory.CreateConn(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = r.conn.Close()
+		r.conn = nil
+	}()
+
+	dropped := connections.Dropped(r.conn)
+	for err == nil {
+		select {
+		case msg := <-r.messages:
+			err = r.handleMessage(msg, ctx)
+		case <-dropped:
+			return connections.ErrConnectionDropped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return
+}
+
+func (r *Repository) Process(msg events.Message) {
+	if msg.Type == "network" || msg.Type == listeners.SyncMessageType {
+		r.messages <- msg
+	}
+}
+
+// List returns copies of all known networks, sorted by name.
+func (r *Repository) List() []Network {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Network, 0, len(r.networks))
+	for _, net := range r.networks {
+		list = append(list, *net)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (r *Repository) primeNewSubscriber() []api.Event {
+	list := r.List()
+	Log.Debug("new subscriber", "#net", len(list))
+	events := make([]api.Event, len(list))
+	for i := range list {
+		events[i] = &NetworkUpdated{list[i].LastUpdateTime(), &list[i]}
+	}
+	return events
+}
+
+func (r *Repository) Synced() <-chan struct{} {
+	return r.sync.Synced()
+}
+
+func (r *Repository) handleSync(action string, when time.Time, ctx context.Context) {
+	switch action {
+	case listeners.SyncStartAction:
+		r.sync.Start()
+	case listeners.SyncEndAction:
+		r.mu.RLock()
+		known := make([]ID, 0, len(r.networks))
+		for id := range r.networks {
+			known = append(known, id)
+		}
+		r.mu.RUnlock()
+		for _, id := range r.sync.End(known) {
+			r.removeNetwork(id, when, ctx)
+		}
+	}
+}
+
+func (r *Repository) handleMessage(msg events.Message, ctx context.Context) error {
+	logger := Log.New(log.Ctx{"host": r.Host, "id": msg.Actor.ID, "action": msg.Action})
+	ctx = context.WithValue(ctx, LoggerKey, logger)
+	when := time.Unix(0, msg.TimeNano)
+	if msg.Type == listeners.SyncMessageType {
+		r.handleSync(msg.Action, when, ctx)
+		return nil
+	}
+	switch msg.Action {
+	case "destroy", "remove":
+		r.removeNetwork(ID(msg.Actor.ID), when, ctx)
+	default:
+		r.updateNetwork(ID(msg.Actor.ID), when, ctx)
+	}
+	return nil
+}
+
+func (r *Repository) updateNetwork(id ID, when time.Time, ctx context.Context) {
+	if id == "" {
+		return
+	}
+
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	data, err := r.conn.NetworkInspect(ctx, string(id), types.NetworkInspectOptions{})
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			r.removeNetwork(id, when, ctx)
+		} else {
+			logger.Error("error inspecting network", "error", err)
+			metrics.InspectErrors.Inc(r.Host, "network")
+			// It may still exist, so it must not be removed at the end of the synchronization
+			r.sync.Mark(id)
+		}
+		return
+	}
+
+	r.mu.Lock()
+	net, found := r.networks[id]
+	if !found {
+		net = &Network{ID: id, CreatedAt: data.Created}
+		r.networks[id] = net
+		logger.Debug("added network")
+	} else {
+		logger.Debug("updating network")
+	}
+	net.UpdateFrom(data)
+	net.Host = r.Host
+	r.sync.Mark(id)
+	net.UpdatedAt = when
+	snapshot := *net
+	r.mu.Unlock()
+
+	r.dispatcher.Dispatch(&NetworkUpdated{when, &snapshot}, ctx)
+}
+
+func (r *Repository) removeNetwork(id ID, when time.Time, ctx context.Context) {
+	r.mu.Lock()
+	_, found := r.networks[id]
+	delete(r.networks, id)
+	r.mu.Unlock()
+	if !found {
+		return
+	}
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	logger.Debug("removed network")
+	r.dispatcher.Dispatch(&NetworkRemoved{when, r.Host, string(id)}, ctx)
+}
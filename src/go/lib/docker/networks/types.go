@@ -0,0 +1,66 @@
+package networks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/docker/docker/api/types"
+)
+
+type (
+	ID string
+
+	Network struct {
+		ID         ID
+		Host       string
+		CreatedAt  time.Time
+		UpdatedAt  time.Time
+		Name       string
+		Driver     string
+		Scope      string
+		Internal   bool
+		Attachable bool
+		Subnets    []Subnet            `json:",omitempty"`
+		Labels     map[string]string   `json:",omitempty"`
+		Project    *containers.Project `json:",omitempty"`
+	}
+
+	Subnet struct {
+		Subnet  string
+		Gateway string `json:",omitempty"`
+	}
+)
+
+var (
+	_ fmt.Stringer = (*ID)(nil)
+)
+
+func (n *Network) UpdateFrom(data types.NetworkResource) {
+	n.ID = ID(data.ID)
+	n.Name = data.Name
+	n.Driver = data.Driver
+	n.Scope = data.Scope
+	n.Internal = data.Internal
+	n.Attachable = data.Attachable
+	n.Labels = data.Labels
+	n.Project = containers.ProjectFromLabels(data.Labels)
+
+	n.Subnets = nil
+	for _, config := range data.IPAM.Config {
+		if config.Subnet != "" {
+			n.Subnets = append(n.Subnets, Subnet{config.Subnet, config.Gateway})
+		}
+	}
+}
+
+func (n *Network) LastUpdateTime() time.Time {
+	if !n.UpdatedAt.IsZero() {
+		return n.UpdatedAt
+	}
+	return n.CreatedAt
+}
+
+func (i ID) String() string {
+	return string(i)
+}
@@ -0,0 +1,236 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	log "github.com/inconshreveable/log15"
+	"github.com/thejerf/suture/v4"
+)
+
+var (
+	Log = log.New()
+
+	DefaultInterval = 5 * time.Second
+
+	// MaxStreamFailures is the number of streams that can fail in a row before the connection is recreated.
+	MaxStreamFailures = 5
+)
+
+type (
+	// Collector streams the resource usage of the running containers of a host, and dispatches it once per
+	// interval. The daemon samples the usage every second, so shorter intervals do not send more events.
+	Collector struct {
+		ConnFactory connections.Factory
+		// Host is the name of the Docker host, used to tag the stats.
+		Host string
+		// Interval is the delay between two dispatches of the stats of a container.
+		Interval time.Duration
+
+		conn       connections.Connection
+		containers Lister
+		dispatcher containers.Dispatcher
+		streams    map[containers.ID]*stream
+		latest     map[containers.ID]*StatsUpdated
+		// failures counts the streams that failed since the last sample, and lastError is the error of the last one.
+		failures  int
+		lastError error
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+	}
+
+	// Lister provides the containers whose usage is collected.
+	Lister interface {
+		List() []containers.Container
+	}
+
+	// stream holds the samples of a container ; current is written by the streaming goroutine while the
+	// collector lock is held.
+	stream struct {
+		cancel   func()
+		current  *types.StatsJSON
+		previous *types.StatsJSON
+		ended    bool
+	}
+)
+
+var (
+	_ suture.Service = (*Collector)(nil)
+	_ fmt.GoStringer = (*Collector)(nil)
+)
+
+func NewCollector(dispatcher containers.Dispatcher, connFactory connections.Factory, lister Lister) (c *Collector) {
+	c = &Collector{
+		ConnFactory: connFactory,
+		Interval:    DefaultInterval,
+		containers:  lister,
+		dispatcher:  dispatcher,
+		streams:     make(map[containers.ID]*stream, 10),
+		latest:      make(map[containers.ID]*StatsUpdated, 10),
+	}
+	dispatcher.OnNewSubscriber(c.primeNewSubscriber)
+	return c
+}
+
+func (c *Collector) GoString() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf("stats.Collector(%d)", len(c.streams))
+}
+
+func (c *Collector) Serve(ctx context.Context) (err error) {
+	c.conn, err = c.ConnFactory.CreateConn(ctx)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.failures, c.lastError = 0, nil
+	c.mu.Unlock()
+	defer func() {
+		c.stopStreams()
+		_ = c.conn.Close()
+		c.conn = nil
+	}()
+
+	dropped := connections.Dropped(c.conn)
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	// Start the streams right away, so the first stats are available at the first tick
+	if err := c.refresh(time.Now(), ctx); err != nil {
+		return err
+	}
+	for {
+		select {
+		case when := <-ticker.C:
+			if err := c.refresh(when, ctx); err != nil {
+				return err
+			}
+		case <-dropped:
+			return connections.ErrConnectionDropped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// refresh dispatches the stats of the containers that have a new sample, and starts or stops the streams
+// to follow the running containers. It fails when too many streams failed in a row, so the connection is recreated.
+func (c *Collector) refresh(when time.Time, ctx context.Context) error {
+	running := make(map[containers.ID]bool)
+	for _, ctn := range c.containers.List() {
+		if ctn.Status.IsRunning() {
+			running[ctn.ID] = true
+		}
+	}
+
+	var updates []*StatsUpdated
+	c.mu.Lock()
+	if c.failures >= MaxStreamFailures {
+		err := fmt.Errorf("%d container stats streams failed in a row: %w", c.failures, c.lastError)
+		c.mu.Unlock()
+		return err
+	}
+	for id, s := range c.streams {
+		if !running[id] || s.ended {
+			s.cancel()
+			delete(c.streams, id)
+			delete(c.latest, id)
+			continue
+		}
+		if s.current == nil || s.current == s.previous {
+			continue
+		}
+		event := &StatsUpdated{when, NewStats(c.Host, id, s.current, s.previous)}
+		s.previous = s.current
+		c.latest[id] = event
+		updates = append(updates, event)
+	}
+	for id := range running {
+		if _, found := c.streams[id]; !found {
+			c.startStream(id, ctx)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, event := range updates {
+		c.dispatcher.Dispatch(event, ctx)
+	}
+	return nil
+}
+
+// startStream must be called while holding the lock.
+func (c *Collector) startStream(id containers.ID, ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &stream{cancel: cancel}
+	c.streams[id] = s
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		err := c.readStream(id, s, ctx)
+		// The container may have been removed in the meantime
+		failed := err != nil && ctx.Err() == nil && !client.IsErrNotFound(err)
+		if failed {
+			Log.Warn("error streaming container stats", "host", c.Host, "id", id, "error", err)
+		}
+		c.mu.Lock()
+		s.ended = true
+		if failed {
+			c.failures++
+			c.lastError = err
+		}
+		c.mu.Unlock()
+	}()
+}
+
+func (c *Collector) readStream(id containers.ID, s *stream, ctx context.Context) error {
+	resp, err := c.conn.ContainerStats(ctx, string(id), true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var data types.StatsJSON
+		if err := dec.Decode(&data); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		s.current = &data
+		c.failures = 0
+		c.mu.Unlock()
+	}
+}
+
+func (c *Collector) stopStreams() {
+	c.mu.Lock()
+	for id, s := range c.streams {
+		s.cancel()
+		delete(c.streams, id)
+		delete(c.latest, id)
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+func (c *Collector) primeNewSubscriber() []api.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	events := make([]api.Event, 0, len(c.latest))
+	for _, event := range c.latest {
+		events = append(events, event)
+	}
+	return events
+}
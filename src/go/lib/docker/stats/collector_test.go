@@ -0,0 +1,83 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/docker/docker/api/types"
+)
+
+type (
+	fakeFactory struct {
+		conn *fakeConnection
+	}
+
+	fakeConnection struct {
+		connections.Connection
+		err error
+	}
+
+	fakeLister []containers.Container
+
+	fakeDispatcher struct{}
+)
+
+func (f fakeFactory) CreateConn(ctx context.Context) (connections.Connection, error) {
+	return f.conn, nil
+}
+
+func (c *fakeConnection) ContainerStats(ctx context.Context, id string, stream bool) (types.ContainerStats, error) {
+	if c.err != nil {
+		return types.ContainerStats{}, c.err
+	}
+	return types.ContainerStats{Body: io.NopCloser(strings.NewReader(`{"read":"2022-08-09T00:00:00Z"}`))}, nil
+}
+
+func (c *fakeConnection) Close() error {
+	return nil
+}
+
+func (l fakeLister) List() []containers.Container {
+	return l
+}
+
+func (fakeDispatcher) Dispatch(value api.Event, ctx context.Context) error {
+	return nil
+}
+
+func (fakeDispatcher) OnNewSubscriber(hook func() []api.Event) {}
+
+func TestCollectorFailsWhenTheStreamsFail(t *testing.T) {
+	conn := &fakeConnection{err: errors.New("connection reset")}
+	lister := fakeLister{{ID: "a", Status: "running"}, {ID: "b", Status: "running"}}
+	collector := NewCollector(fakeDispatcher{}, fakeFactory{conn}, lister)
+	collector.Interval = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := collector.Serve(ctx)
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCollectorKeepsServingWhenTheStreamsEnd(t *testing.T) {
+	conn := &fakeConnection{}
+	lister := fakeLister{{ID: "a", Status: "running"}}
+	collector := NewCollector(fakeDispatcher{}, fakeFactory{conn}, lister)
+	collector.Interval = time.Millisecond
+
+	// The stream ends after one sample, and is started again at each tick
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := collector.Serve(ctx); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+)
+
+type (
+	StatsUpdated struct {
+		when time.Time
+		data *Stats
+	}
+)
+
+var (
+	_ api.Event = (*StatsUpdated)(nil)
+)
+
+const (
+	IDFormat = time.RFC3339Nano
+)
+
+func (s *StatsUpdated) ID() string {
+	return s.when.Format(IDFormat)
+}
+
+func (s *StatsUpdated) Data() any {
+	return api.EventDTO{
+		TargetType: "container",
+		Host:       s.data.Host,
+		TargetID:   string(s.data.ID),
+		Type:       "stats",
+		Time:       s.when,
+		Details:    s.data,
+	}
+}
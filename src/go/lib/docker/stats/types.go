@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"strings"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/docker/docker/api/types"
+)
+
+type (
+	// Stats is the resource usage of a running container.
+	Stats struct {
+		Host string
+		ID   containers.ID
+		// CPUPercent is the average CPU usage over the interval ; 100 is a whole CPU.
+		CPUPercent float64
+		// MemoryUsage leaves out the page cache, like the docker stats command.
+		MemoryUsage uint64
+		MemoryLimit uint64
+		// The network and block IO counters are the bytes transferred since the container started.
+		NetworkRx  uint64
+		NetworkTx  uint64
+		BlockRead  uint64
+		BlockWrite uint64
+	}
+)
+
+// NewStats computes the usage of a container from a sample ; the CPU usage is averaged since the previous
+// sample, or since the one the daemon took before when previous is nil.
+func NewStats(host string, id containers.ID, data, previous *types.StatsJSON) *Stats {
+	s := &Stats{
+		Host:        host,
+		ID:          id,
+		MemoryUsage: memoryUsage(data.MemoryStats),
+		MemoryLimit: data.MemoryStats.Limit,
+	}
+
+	pre := data.PreCPUStats
+	if previous != nil {
+		pre = previous.CPUStats
+	}
+	s.CPUPercent = cpuPercent(data.CPUStats, pre)
+
+	for _, network := range data.Networks {
+		s.NetworkRx += network.RxBytes
+		s.NetworkTx += network.TxBytes
+	}
+	for _, entry := range data.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			s.BlockRead += entry.Value
+		case "write":
+			s.BlockWrite += entry.Value
+		}
+	}
+	return s
+}
+
+func cpuPercent(cpu, pre types.CPUStats) float64 {
+	cpuDelta := float64(cpu.CPUUsage.TotalUsage) - float64(pre.CPUUsage.TotalUsage)
+	systemDelta := float64(cpu.SystemUsage) - float64(pre.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	cpus := float64(cpu.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(cpu.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * cpus * 100
+}
+
+// memoryUsage subtracts the inactive page cache, whose name depends on the cgroup version.
+func memoryUsage(mem types.MemoryStats) uint64 {
+	if cache, found := mem.Stats["total_inactive_file"]; found && cache < mem.Usage {
+		return mem.Usage - cache
+	}
+	if cache := mem.Stats["inactive_file"]; cache < mem.Usage {
+		return mem.Usage - cache
+	}
+	return mem.Usage
+}
@@ -0,0 +1,59 @@
+package swarm
+
+import (
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+)
+
+type (
+	ObjectUpdated struct {
+		when time.Time
+		data object
+	}
+
+	ObjectRemoved struct {
+		when time.Time
+		host string
+		key  Key
+	}
+)
+
+var (
+	_ api.Event = (*ObjectUpdated)(nil)
+	_ api.Event = (*ObjectRemoved)(nil)
+)
+
+const (
+	IDFormat = time.RFC3339Nano
+)
+
+func (o *ObjectUpdated) ID() string {
+	return o.when.Format(IDFormat)
+}
+
+func (o *ObjectUpdated) Data() any {
+	key := o.data.key()
+	return api.EventDTO{
+		TargetType: string(key.Kind),
+		Host:       o.data.meta().Host,
+		TargetID:   string(key.ID),
+		Type:       "updated",
+		Time:       o.when,
+		Details:    o.data,
+	}
+}
+
+func (o *ObjectRemoved) ID() string {
+	return o.when.Format(IDFormat)
+}
+
+func (o *ObjectRemoved) Data() any {
+	return api.EventDTO{
+		TargetType: string(o.key.Kind),
+		Host:       o.host,
+		TargetID:   string(o.key.ID),
+		Type:       "removed",
+		Time:       o.when,
+	}
+}
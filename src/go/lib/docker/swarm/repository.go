@@ -0,0 +1,394 @@
+package swarm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/listeners"
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	log "github.com/inconshreveable/log15"
+	"github.com/thejerf/suture/v4"
+)
+
+var (
+	Log       = log.New()
+	LoggerKey = struct{}{}
+
+	DefaultTaskInterval = 10 * time.Second
+)
+
+const (
+	// ServiceIDLabel is the label set on the containers of the swarm tasks.
+	ServiceIDLabel = "com.docker.swarm.service.id"
+)
+
+type (
+	// Repository tracks the nodes, services, tasks, configs and secrets of a swarm.
+	// It requires the host to be a swarm manager ; on other hosts, it ignores the messages.
+	//
+	// The Docker daemon does not send events about tasks, so they are refreshed when their service or one of
+	// their local containers changes, and periodically to catch the changes on the other nodes.
+	Repository struct {
+		ConnFactory connections.Factory
+		// Host is the name of the Docker host, used to tag the resources.
+		Host string
+		// TaskInterval is the delay between two refreshes of all tasks ; zero disables them.
+		TaskInterval time.Duration
+
+		conn       connections.Connection
+		manager    bool
+		dispatcher containers.Dispatcher
+		messages   chan events.Message
+		objects    map[Key]object
+		mu         sync.RWMutex
+		sync       *listeners.SyncTracker[Key]
+	}
+)
+
+var (
+	_ suture.Service         = (*Repository)(nil)
+	_ fmt.GoStringer         = (*Repository)(nil)
+	_ listeners.Synchronizer = (*Repository)(nil)
+)
+
+func NewRepository(dispatcher containers.Dispatcher, connFactory connections.Factory) (r *Repository) {
+	r = &Repository{
+		dispatcher:   dispatcher,
+		ConnFactory:  connFactory,
+		TaskInterval: DefaultTaskInterval,
+		messages:     make(chan events.Message, 50),
+		objects:      make(map[Key]object, 10),
+		sync:         listeners.NewSyncTracker[Key](),
+	}
+	dispatcher.OnNewSubscriber(r.primeNewSubscriber)
+	return r
+}
+
+func (r *Repository) GoString() string {
+	return fmt.Sprintf("swarm.Repository(%d, %d/%d)", len(r.objects), len(r.messages), cap(r.messages))
+}
+
+// Len returns the number of known swarm objects.
+func (r *Repository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.objects)
+}
+
+// Pending returns the number of messages waiting to be handled.
+func (r *Repository) Pending() int {
+	return len(r.messages)
+}
+
+func (r *Repository) Serve(ctx context.Context) (err error) {
+	r.conn, err = r.ConnFactory.CreateConn(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = r.conn.Close()
+		r.conn = nil
+	}()
+
+	info, err := r.conn.Info(ctx)
+	if err != nil {
+		return
+	}
+	r.manager = info.Swarm.ControlAvailable
+	if !r.manager {
+		Log.Warn("not a swarm manager, ignoring swarm resources", "host", r.Host, "state", info.Swarm.LocalNodeState)
+	}
+
+	var refreshC <-chan time.Time
+	if r.manager && r.TaskInterval > 0 {
+		ticker := time.NewTicker(r.TaskInterval)
+		defer ticker.Stop()
+		refreshC = ticker.C
+	}
+
+	dropped := connections.Dropped(r.conn)
+	for err == nil {
+		select {
+		case msg := <-r.messages:
+			err = r.handleMessage(msg, ctx)
+		case <-dropped:
+			return connections.ErrConnectionDropped
+		case when := <-refreshC:
+			ctx := context.WithValue(ctx, LoggerKey, Log.New("host", r.Host))
+			err = r.refreshTasks("", when, ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return
+}
+
+func (r *Repository) Process(msg events.Message) {
+	switch Kind(msg.Type) {
+	case NodeKind, ServiceKind, ConfigKind, SecretKind, listeners.SyncMessageType:
+		r.messages <- msg
+	case "container":
+		// Task containers tell us that their task has changed
+		if msg.Actor.Attributes[ServiceIDLabel] != "" {
+			r.messages <- msg
+		}
+	}
+}
+
+// Nodes returns copies of all known nodes, sorted by hostname.
+func (r *Repository) Nodes() []Node {
+	return list[Node](r, NodeKind)
+}
+
+// Services returns copies of all known services, sorted by name.
+func (r *Repository) Services() []Service {
+	return list[Service](r, ServiceKind)
+}
+
+// Tasks returns copies of all known tasks, sorted by name.
+func (r *Repository) Tasks() []Task {
+	return list[Task](r, TaskKind)
+}
+
+// Configs returns copies of all known configs, sorted by name.
+func (r *Repository) Configs() []Config {
+	return list[Config](r, ConfigKind)
+}
+
+// Secrets returns copies of all known secrets, sorted by name.
+func (r *Repository) Secrets() []Secret {
+	return list[Secret](r, SecretKind)
+}
+
+func list[T any](r *Repository, kind Kind) []T {
+	objects := r.listObjects(kind)
+	list := make([]T, len(objects))
+	for i, obj := range objects {
+		list[i] = *any(obj).(*T)
+	}
+	return list
+}
+
+func (r *Repository) listObjects(kind Kind) []object {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]object, 0, len(r.objects))
+	for key, obj := range r.objects {
+		if key.Kind == kind {
+			list = append(list, obj)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name() < list[j].name() })
+	return list
+}
+
+func (r *Repository) primeNewSubscriber() []api.Event {
+	var events []api.Event
+	for _, kind := range Kinds {
+		for _, obj := range r.listObjects(kind) {
+			events = append(events, &ObjectUpdated{obj.meta().LastUpdateTime(), obj})
+		}
+	}
+	Log.Debug("new subscriber", "#obj", len(events))
+	return events
+}
+
+func (r *Repository) Synced() <-chan struct{} {
+	return r.sync.Synced()
+}
+
+func (r *Repository) handleSync(action string, when time.Time, ctx context.Context) {
+	switch action {
+	case listeners.SyncStartAction:
+		r.sync.Start()
+	case listeners.SyncEndAction:
+		r.mu.RLock()
+		known := make([]Key, 0, len(r.objects))
+		for key := range r.objects {
+			known = append(known, key)
+		}
+		r.mu.RUnlock()
+		for _, key := range r.sync.End(known) {
+			r.remove(key, when, ctx)
+		}
+	}
+}
+
+func (r *Repository) handleMessage(msg events.Message, ctx context.Context) error {
+	logger := Log.New(log.Ctx{"host": r.Host, "type": msg.Type, "id": msg.Actor.ID, "action": msg.Action})
+	ctx = context.WithValue(ctx, LoggerKey, logger)
+	when := time.Unix(0, msg.TimeNano)
+	if msg.Type == listeners.SyncMessageType {
+		r.handleSync(msg.Action, when, ctx)
+		return nil
+	}
+	if !r.manager {
+		return nil
+	}
+
+	kind, id := Kind(msg.Type), ID(msg.Actor.ID)
+	if kind == "container" {
+		return r.refreshTasks(ID(msg.Actor.Attributes[ServiceIDLabel]), when, ctx)
+	}
+	if msg.Action == "remove" {
+		r.remove(Key{kind, id}, when, ctx)
+		if kind == ServiceKind {
+			r.removeTasks(id, nil, when, ctx)
+		}
+		return nil
+	}
+
+	switch kind {
+	case NodeKind:
+		data, _, err := r.conn.NodeInspectWithRaw(ctx, string(id))
+		r.update(Key{kind, id}, func() object { return NewNode(data) }, err, when, ctx)
+	case ServiceKind:
+		data, _, err := r.conn.ServiceInspectWithRaw(ctx, string(id), types.ServiceInspectOptions{})
+		r.update(Key{kind, id}, func() object { return NewService(data) }, err, when, ctx)
+		return r.refreshTasks(id, when, ctx)
+	case ConfigKind:
+		data, _, err := r.conn.ConfigInspectWithRaw(ctx, string(id))
+		r.update(Key{kind, id}, func() object { return NewConfig(data) }, err, when, ctx)
+	case SecretKind:
+		data, _, err := r.conn.SecretInspectWithRaw(ctx, string(id))
+		r.update(Key{kind, id}, func() object { return NewSecret(data) }, err, when, ctx)
+	}
+	return nil
+}
+
+// update stores the object built by convert, unless the inspection failed.
+func (r *Repository) update(key Key, convert func() object, err error, when time.Time, ctx context.Context) {
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			r.remove(key, when, ctx)
+		} else {
+			logger.Error("error inspecting swarm object", "error", err)
+			metrics.InspectErrors.Inc(r.Host, string(key.Kind))
+			// It may still exist, so it must not be removed at the end of the synchronization
+			r.sync.Mark(key)
+		}
+		return
+	}
+	r.store(convert(), when, ctx)
+}
+
+func (r *Repository) store(obj object, when time.Time, ctx context.Context) {
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	key := obj.key()
+	meta := obj.meta()
+	meta.Host = r.Host
+	meta.UpdatedAt = when
+
+	r.mu.Lock()
+	if _, found := r.objects[key]; found {
+		logger.Debug("updating swarm object", "kind", key.Kind, "id", key.ID)
+	} else {
+		logger.Debug("added swarm object", "kind", key.Kind, "id", key.ID)
+	}
+	// Stored objects are never modified, so they can be shared with the event
+	r.objects[key] = obj
+	r.sync.Mark(key)
+	r.mu.Unlock()
+
+	r.dispatcher.Dispatch(&ObjectUpdated{when, obj}, ctx)
+}
+
+func (r *Repository) remove(key Key, when time.Time, ctx context.Context) {
+	r.mu.Lock()
+	_, found := r.objects[key]
+	delete(r.objects, key)
+	r.mu.Unlock()
+	if !found {
+		return
+	}
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	logger.Debug("removed swarm object", "kind", key.Kind, "id", key.ID)
+	r.dispatcher.Dispatch(&ObjectRemoved{when, r.Host, key}, ctx)
+}
+
+func (r *Repository) serviceName(id ID) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if obj, found := r.objects[Key{ServiceKind, id}]; found {
+		return obj.name()
+	}
+	return ""
+}
+
+// refreshTasks lists the current tasks of a service, or of all services if serviceID is empty,
+// and dispatches the ones that have changed.
+func (r *Repository) refreshTasks(serviceID ID, when time.Time, ctx context.Context) error {
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	args := filters.NewArgs()
+	if serviceID != "" {
+		args.Add("service", string(serviceID))
+	}
+	tasks, err := r.conn.TaskList(ctx, types.TaskListOptions{Filters: args})
+	if err != nil {
+		logger.Error("error listing tasks", "service", serviceID, "error", err)
+		metrics.InspectErrors.Inc(r.Host, string(TaskKind))
+		r.markTasks(serviceID)
+		return nil
+	}
+
+	current := make(map[ID]bool, len(tasks))
+	for _, data := range tasks {
+		task := NewTask(data, r.serviceName(ID(data.ServiceID)))
+		if !task.IsCurrent() {
+			continue
+		}
+		current[task.ID] = true
+
+		r.mu.RLock()
+		known, found := r.objects[task.key()].(*Task)
+		r.mu.RUnlock()
+		if found && known.version == task.version && known.Name == task.Name {
+			r.sync.Mark(task.key())
+			continue
+		}
+		r.store(task, when, ctx)
+	}
+
+	r.removeTasks(serviceID, current, when, ctx)
+	return nil
+}
+
+// markTasks keeps the known tasks of a service, or of all services if serviceID is empty, when they could not be listed.
+func (r *Repository) markTasks(serviceID ID) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for key, obj := range r.objects {
+		if key.Kind == TaskKind && (serviceID == "" || obj.(*Task).ServiceID == serviceID) {
+			r.sync.Mark(key)
+		}
+	}
+}
+
+// removeTasks removes the tasks of a service, or of all services if serviceID is empty, except the kept ones.
+func (r *Repository) removeTasks(serviceID ID, keep map[ID]bool, when time.Time, ctx context.Context) {
+	var stale []Key
+	r.mu.RLock()
+	for key, obj := range r.objects {
+		if key.Kind != TaskKind || keep[key.ID] {
+			continue
+		}
+		if serviceID == "" || obj.(*Task).ServiceID == serviceID {
+			stale = append(stale, key)
+		}
+	}
+	r.mu.RUnlock()
+	for _, key := range stale {
+		r.remove(key, when, ctx)
+	}
+}
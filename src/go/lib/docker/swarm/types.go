@@ -0,0 +1,291 @@
+package swarm
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	swarmtypes "github.com/docker/docker/api/types/swarm"
+)
+
+type (
+	ID   string
+	Kind string
+
+	// Key identifies a swarm object of any kind.
+	Key struct {
+		Kind Kind
+		ID   ID
+	}
+
+	Service struct {
+		Meta
+		Name     string
+		Image    string
+		Mode     string
+		Replicas *uint64             `json:",omitempty"`
+		Networks []ID                `json:",omitempty"`
+		Configs  []ID                `json:",omitempty"`
+		Secrets  []ID                `json:",omitempty"`
+		Ports    []Port              `json:",omitempty"`
+		Labels   map[string]string   `json:",omitempty"`
+		Project  *containers.Project `json:",omitempty"`
+	}
+
+	Port struct {
+		Protocol      string
+		TargetPort    uint32
+		PublishedPort uint32 `json:",omitempty"`
+		PublishMode   string
+	}
+
+	Task struct {
+		Meta
+		Name         string
+		ServiceID    ID
+		NodeID       ID  `json:",omitempty"`
+		Slot         int `json:",omitempty"`
+		State        string
+		DesiredState string
+		Message      string `json:",omitempty"`
+		Error        string `json:",omitempty"`
+		ContainerID  string `json:",omitempty"`
+		Networks     []ID   `json:",omitempty"`
+		version      uint64
+	}
+
+	Node struct {
+		Meta
+		Hostname      string
+		Role          string
+		Availability  string
+		State         string
+		Addr          string `json:",omitempty"`
+		Leader        bool
+		EngineVersion string            `json:",omitempty"`
+		Labels        map[string]string `json:",omitempty"`
+	}
+
+	Config struct {
+		Meta
+		Name   string
+		Labels map[string]string `json:",omitempty"`
+	}
+
+	Secret struct {
+		Meta
+		Name   string
+		Driver string            `json:",omitempty"`
+		Labels map[string]string `json:",omitempty"`
+	}
+
+	// Meta holds the fields common to all swarm objects.
+	Meta struct {
+		ID        ID
+		Host      string
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+
+	// object is implemented by pointers to the swarm objects.
+	object interface {
+		key() Key
+		name() string
+		meta() *Meta
+	}
+)
+
+// The kinds are the target types of the events ; except for tasks, they also are the types of the Docker events.
+const (
+	NodeKind    Kind = "node"
+	ServiceKind Kind = "service"
+	TaskKind    Kind = "task"
+	ConfigKind  Kind = "config"
+	SecretKind  Kind = "secret"
+
+	// StackLabel is the label set by "docker stack deploy" on the objects of a stack.
+	StackLabel = "com.docker.stack.namespace"
+)
+
+var (
+	_ fmt.Stringer = (*ID)(nil)
+
+	_ object = (*Service)(nil)
+	_ object = (*Task)(nil)
+	_ object = (*Node)(nil)
+	_ object = (*Config)(nil)
+	_ object = (*Secret)(nil)
+
+	// Kinds lists the kinds of objects, in the order they should be sent to new subscribers.
+	Kinds = []Kind{NodeKind, ConfigKind, SecretKind, ServiceKind, TaskKind}
+)
+
+// ProjectFromLabels returns the stack of an object, if any.
+func ProjectFromLabels(labels map[string]string) *containers.Project {
+	if name, found := labels[StackLabel]; found {
+		return &containers.Project{Name: name}
+	}
+	return containers.ProjectFromLabels(labels)
+}
+
+func NewService(data swarmtypes.Service) *Service {
+	s := &Service{
+		Meta:    Meta{ID: ID(data.ID), CreatedAt: data.CreatedAt},
+		Name:    data.Spec.Name,
+		Labels:  data.Spec.Labels,
+		Project: ProjectFromLabels(data.Spec.Labels),
+	}
+
+	switch mode := data.Spec.Mode; {
+	case mode.Replicated != nil:
+		s.Mode = "replicated"
+		s.Replicas = mode.Replicated.Replicas
+	case mode.Global != nil:
+		s.Mode = "global"
+	case mode.ReplicatedJob != nil:
+		s.Mode = "replicated-job"
+		s.Replicas = mode.ReplicatedJob.TotalCompletions
+	case mode.GlobalJob != nil:
+		s.Mode = "global-job"
+	}
+
+	template := data.Spec.TaskTemplate
+	if spec := template.ContainerSpec; spec != nil {
+		s.Image = spec.Image
+		for _, ref := range spec.Configs {
+			s.Configs = append(s.Configs, ID(ref.ConfigID))
+		}
+		for _, ref := range spec.Secrets {
+			s.Secrets = append(s.Secrets, ID(ref.SecretID))
+		}
+	}
+	networks := template.Networks
+	if len(networks) == 0 {
+		// Older daemons only fill the deprecated field
+		networks = data.Spec.Networks
+	}
+	for _, attachment := range networks {
+		s.Networks = append(s.Networks, ID(attachment.Target))
+	}
+
+	ports := data.Endpoint.Ports
+	if len(ports) == 0 && data.Spec.EndpointSpec != nil {
+		ports = data.Spec.EndpointSpec.Ports
+	}
+	for _, port := range ports {
+		s.Ports = append(s.Ports, Port{
+			Protocol:      string(port.Protocol),
+			TargetPort:    port.TargetPort,
+			PublishedPort: port.PublishedPort,
+			PublishMode:   string(port.PublishMode),
+		})
+	}
+	return s
+}
+
+// NewTask converts a task ; serviceName is used to build the name of the task, like "docker service ps" does.
+func NewTask(data swarmtypes.Task, serviceName string) *Task {
+	t := &Task{
+		Meta:         Meta{ID: ID(data.ID), CreatedAt: data.CreatedAt},
+		Name:         data.Name,
+		ServiceID:    ID(data.ServiceID),
+		NodeID:       ID(data.NodeID),
+		Slot:         data.Slot,
+		State:        string(data.Status.State),
+		DesiredState: string(data.DesiredState),
+		Message:      data.Status.Message,
+		Error:        data.Status.Err,
+		version:      data.Version.Index,
+	}
+	if t.Name == "" && serviceName != "" {
+		if t.Slot != 0 {
+			t.Name = serviceName + "." + strconv.Itoa(t.Slot)
+		} else {
+			t.Name = serviceName + "." + data.NodeID
+		}
+	}
+	if status := data.Status.ContainerStatus; status != nil {
+		t.ContainerID = status.ContainerID
+	}
+	for _, attachment := range data.NetworksAttachments {
+		t.Networks = append(t.Networks, ID(attachment.Network.ID))
+	}
+	return t
+}
+
+func NewNode(data swarmtypes.Node) *Node {
+	n := &Node{
+		Meta:          Meta{ID: ID(data.ID), CreatedAt: data.CreatedAt},
+		Hostname:      data.Description.Hostname,
+		Role:          string(data.Spec.Role),
+		Availability:  string(data.Spec.Availability),
+		State:         string(data.Status.State),
+		Addr:          data.Status.Addr,
+		EngineVersion: data.Description.Engine.EngineVersion,
+		Labels:        data.Spec.Labels,
+	}
+	if data.ManagerStatus != nil {
+		n.Leader = data.ManagerStatus.Leader
+	}
+	return n
+}
+
+func NewConfig(data swarmtypes.Config) *Config {
+	return &Config{
+		Meta:   Meta{ID: ID(data.ID), CreatedAt: data.CreatedAt},
+		Name:   data.Spec.Name,
+		Labels: data.Spec.Labels,
+	}
+}
+
+func NewSecret(data swarmtypes.Secret) *Secret {
+	s := &Secret{
+		Meta:   Meta{ID: ID(data.ID), CreatedAt: data.CreatedAt},
+		Name:   data.Spec.Name,
+		Labels: data.Spec.Labels,
+	}
+	if data.Spec.Driver != nil {
+		s.Driver = data.Spec.Driver.Name
+	}
+	return s
+}
+
+// IsCurrent tells whether the task is still part of its service, or is only kept in the task history.
+func (t *Task) IsCurrent() bool {
+	switch swarmtypes.TaskState(t.DesiredState) {
+	case swarmtypes.TaskStateShutdown, swarmtypes.TaskStateRemove:
+		return false
+	}
+	return true
+}
+
+func (s *Service) key() Key     { return Key{ServiceKind, s.ID} }
+func (s *Service) name() string { return s.Name }
+
+func (t *Task) key() Key     { return Key{TaskKind, t.ID} }
+func (t *Task) name() string { return t.Name }
+
+func (n *Node) key() Key     { return Key{NodeKind, n.ID} }
+func (n *Node) name() string { return n.Hostname }
+
+func (c *Config) key() Key     { return Key{ConfigKind, c.ID} }
+func (c *Config) name() string { return c.Name }
+
+func (s *Secret) key() Key     { return Key{SecretKind, s.ID} }
+func (s *Secret) name() string { return s.Name }
+
+func (m *Meta) meta() *Meta {
+	return m
+}
+
+func (m *Meta) LastUpdateTime() time.Time {
+	if !m.UpdatedAt.IsZero() {
+		return m.UpdatedAt
+	}
+	return m.CreatedAt
+}
+
+func (i ID) String() string {
+	return string(i)
+}
@@ -0,0 +1,58 @@
+package volumes
+
+import (
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+)
+
+type (
+	VolumeUpdated struct {
+		when time.Time
+		data *Volume
+	}
+
+	VolumeRemoved struct {
+		when time.Time
+		host string
+		id   string
+	}
+)
+
+var (
+	_ api.Event = (*VolumeUpdated)(nil)
+	_ api.Event = (*VolumeRemoved)(nil)
+)
+
+const (
+	IDFormat = time.RFC3339Nano
+)
+
+func (v *VolumeUpdated) ID() string {
+	return v.when.Format(IDFormat)
+}
+
+func (v *VolumeUpdated) Data() any {
+	return api.EventDTO{
+		TargetType: "volume",
+		Host:       v.data.Host,
+		TargetID:   string(v.data.Name),
+		Type:       "updated",
+		Time:       v.when,
+		Details:    v.data,
+	}
+}
+
+func (v *VolumeRemoved) ID() string {
+	return v.when.Format(IDFormat)
+}
+
+func (v *VolumeRemoved) Data() any {
+	return api.EventDTO{
+		TargetType: "volume",
+		Host:       v.host,
+		TargetID:   v.id,
+		Type:       "removed",
+		Time:       v.when,
+	}
+}
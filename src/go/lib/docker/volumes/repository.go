@@ -0,0 +1,248 @@
+package volumes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/listeners"
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+	log "github.com/inconshreveable/log15"
+	"github.com/thejerf/suture/v4"
+)
+
+var (
+	Log       = log.New()
+	LoggerKey = struct{}{}
+)
+
+type (
+	Repository struct {
+		ConnFactory connections.Factory
+		// Host is the name of the Docker host, used to tag the resources.
+		Host string
+		// UsageInterval is the delay between two refreshes of the volume sizes ; zero disables them.
+		UsageInterval time.Duration
+
+		conn       connections.Connection
+		dispatcher containers.Dispatcher
+		messages   chan events.Message
+		volumes    map[ID]*Volume
+		mu         sync.RWMutex
+		sync       *listeners.SyncTracker[ID]
+	}
+)
+
+var (
+	_ suture.Service         = (*Repository)(nil)
+	_ fmt.GoStringer         = (*Repository)(nil)
+	_ listeners.Synchronizer = (*Repository)(nil)
+)
+
+func NewRepository(dispatcher containers.Dispatcher, connFactory connections.Factory) (r *Repository) {
+	r = &Repository{
+		dispatcher:  dispatcher,
+		ConnFactory: connFactory,
+		messages:    make(chan events.Message, 50),
+		volumes:     make(map[ID]*Volume, 10),
+		sync:        listeners.NewSyncTracker[ID](),
+	}
+	dispatcher.OnNewSubscriber(r.primeNewSubscriber)
+	return r
+}
+
+func (r *Repository) GoString() string {
+	return fmt.Sprintf("volumes.Repository(%d, %d/%d)", len(r.volumes), len(r.messages), cap(r.messages))
+}
+
+// Len returns the number of known volumes.
+func (r *Repository) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.volumes)
+}
+
+// Pending returns the number of messages waiting to be handled.
+func (r *Repository) Pending() int {
+	return len(r.messages)
+}
+
+func (r *Repository) Serve(ctx context.Context) (err error) {
+	r.conn, err = r.ConnFactory.CreateConn(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = r.conn.Close()
+		r.conn = nil
+	}()
+
+	var usageC <-chan time.Time
+	if r.UsageInterval > 0 {
+		ticker := time.NewTicker(r.UsageInterval)
+		defer ticker.Stop()
+		usageC = ticker.C
+	}
+
+	dropped := connections.Dropped(r.conn)
+	for err == nil {
+		select {
+		case msg := <-r.messages:
+			err = r.handleMessage(msg, ctx)
+		case <-dropped:
+			return connections.ErrConnectionDropped
+		case when := <-usageC:
+			err = r.refreshUsage(when, ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return
+}
+
+func (r *Repository) Process(msg events.Message) {
+	if msg.Type == "volume" || msg.Type == listeners.SyncMessageType {
+		r.messages <- msg
+	}
+}
+
+// List returns copies of all known volumes, sorted by name.
+func (r *Repository) List() []Volume {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Volume, 0, len(r.volumes))
+	for _, vol := range r.volumes {
+		list = append(list, *vol)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (r *Repository) primeNewSubscriber() []api.Event {
+	list := r.List()
+	Log.Debug("new subscriber", "#vol", len(list))
+	events := make([]api.Event, len(list))
+	for i := range list {
+		events[i] = &VolumeUpdated{list[i].LastUpdateTime(), &list[i]}
+	}
+	return events
+}
+
+func (r *Repository) Synced() <-chan struct{} {
+	return r.sync.Synced()
+}
+
+func (r *Repository) handleSync(action string, when time.Time, ctx context.Context) {
+	switch action {
+	case listeners.SyncStartAction:
+		r.sync.Start()
+	case listeners.SyncEndAction:
+		r.mu.RLock()
+		known := make([]ID, 0, len(r.volumes))
+		for id := range r.volumes {
+			known = append(known, id)
+		}
+		r.mu.RUnlock()
+		for _, id := range r.sync.End(known) {
+			r.removeVolume(id, when, ctx)
+		}
+	}
+}
+
+func (r *Repository) handleMessage(msg events.Message, ctx context.Context) error {
+	logger := Log.New(log.Ctx{"host": r.Host, "name": msg.Actor.ID, "action": msg.Action})
+	ctx = context.WithValue(ctx, LoggerKey, logger)
+	when := time.Unix(0, msg.TimeNano)
+	if msg.Type == listeners.SyncMessageType {
+		r.handleSync(msg.Action, when, ctx)
+		return nil
+	}
+	switch msg.Action {
+	case "destroy":
+		r.removeVolume(ID(msg.Actor.ID), when, ctx)
+	case "create", "mount", "unmount":
+		r.updateVolume(ID(msg.Actor.ID), when, ctx)
+	}
+	return nil
+}
+
+func (r *Repository) updateVolume(name ID, when time.Time, ctx context.Context) {
+	if name == "" {
+		return
+	}
+
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	data, err := r.conn.VolumeInspect(ctx, string(name))
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			r.removeVolume(name, when, ctx)
+		} else {
+			logger.Error("error inspecting volume", "error", err)
+			metrics.InspectErrors.Inc(r.Host, "volume")
+			// It may still exist, so it must not be removed at the end of the synchronization
+			r.sync.Mark(name)
+		}
+		return
+	}
+
+	r.mu.Lock()
+	vol, found := r.volumes[name]
+	if !found {
+		vol = &Volume{Name: name, CreatedAt: ParseCreatedAt(data)}
+		r.volumes[name] = vol
+		logger.Debug("added volume")
+	} else {
+		logger.Debug("updating volume")
+	}
+	vol.UpdateFrom(data)
+	vol.Host = r.Host
+	r.sync.Mark(name)
+	vol.UpdatedAt = when
+	snapshot := *vol
+	r.mu.Unlock()
+
+	r.dispatcher.Dispatch(&VolumeUpdated{when, &snapshot}, ctx)
+}
+
+func (r *Repository) removeVolume(name ID, when time.Time, ctx context.Context) {
+	r.mu.Lock()
+	_, found := r.volumes[name]
+	delete(r.volumes, name)
+	r.mu.Unlock()
+	if !found {
+		return
+	}
+	logger := ctx.Value(LoggerKey).(log.Logger)
+	logger.Debug("removed volume")
+	r.dispatcher.Dispatch(&VolumeRemoved{when, r.Host, string(name)}, ctx)
+}
+
+func (r *Repository) refreshUsage(when time.Time, ctx context.Context) error {
+	usage, err := r.conn.DiskUsage(ctx)
+	if err != nil {
+		Log.Error("error fetching disk usage", "error", err)
+		return nil
+	}
+	var updated []Volume
+	r.mu.Lock()
+	for _, data := range usage.Volumes {
+		vol, found := r.volumes[ID(data.Name)]
+		if found && vol.UpdateUsage(data.UsageData) {
+			vol.UpdatedAt = when
+			updated = append(updated, *vol)
+		}
+	}
+	r.mu.Unlock()
+
+	for i := range updated {
+		r.dispatcher.Dispatch(&VolumeUpdated{when, &updated[i]}, ctx)
+	}
+	return nil
+}
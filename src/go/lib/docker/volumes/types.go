@@ -0,0 +1,81 @@
+package volumes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/docker/docker/api/types"
+)
+
+type (
+	ID string
+
+	Volume struct {
+		Name       ID
+		Host       string
+		CreatedAt  time.Time
+		UpdatedAt  time.Time
+		Driver     string
+		Mountpoint string
+		Scope      string
+		Labels     map[string]string   `json:",omitempty"`
+		Project    *containers.Project `json:",omitempty"`
+		Usage      *Usage              `json:",omitempty"`
+	}
+
+	Usage struct {
+		Size     int64
+		RefCount int64
+	}
+)
+
+var (
+	_ fmt.Stringer = (*ID)(nil)
+)
+
+func (v *Volume) UpdateFrom(data types.Volume) {
+	v.Name = ID(data.Name)
+	v.Driver = data.Driver
+	v.Mountpoint = data.Mountpoint
+	v.Scope = data.Scope
+	v.Labels = data.Labels
+	v.Project = containers.ProjectFromLabels(data.Labels)
+	if data.UsageData != nil {
+		v.UpdateUsage(data.UsageData)
+	}
+}
+
+// UpdateUsage sets the usage data, as reported by DiskUsage, and returns whether it has changed.
+func (v *Volume) UpdateUsage(data *types.VolumeUsageData) bool {
+	if data == nil || (data.Size < 0 && data.RefCount < 0) {
+		changed := v.Usage != nil
+		v.Usage = nil
+		return changed
+	}
+	usage := Usage{data.Size, data.RefCount}
+	if v.Usage != nil && *v.Usage == usage {
+		return false
+	}
+	v.Usage = &usage
+	return true
+}
+
+func (v *Volume) LastUpdateTime() time.Time {
+	if !v.UpdatedAt.IsZero() {
+		return v.UpdatedAt
+	}
+	return v.CreatedAt
+}
+
+// ParseCreatedAt parses the creation date reported by the daemon, which may be empty.
+func ParseCreatedAt(data types.Volume) time.Time {
+	if createdAt, err := time.Parse(time.RFC3339, data.CreatedAt); err == nil {
+		return createdAt
+	}
+	return time.Time{}
+}
+
+func (i ID) String() string {
+	return string(i)
+}
@@ -0,0 +1,41 @@
+package export
+
+import (
+	"strconv"
+
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+	"github.com/gofiber/fiber/v2"
+)
+
+type (
+	API struct {
+		source *graph.Source
+	}
+)
+
+func NewAPI(source *graph.Source) *API {
+	return &API{source}
+}
+
+func (a *API) MountInto(mnt fiber.Router) {
+	mnt.Get("/export/:format", a.export)
+}
+
+// export renders the current graph in the requested format ;
+// the "hideStopped" query parameter excludes the containers that are not running.
+func (a *API) export(ctx *fiber.Ctx) error {
+	format, found := Formats[ctx.Params("format")]
+	if !found {
+		return fiber.ErrNotFound
+	}
+	var opts Options
+	if value := ctx.Query("hideStopped"); value != "" {
+		hideStopped, err := strconv.ParseBool(value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid hideStopped parameter")
+		}
+		opts.HideStopped = hideStopped
+	}
+	ctx.Set(fiber.HeaderContentType, format.ContentType)
+	return format.Write(ctx, Build(a.source.Snapshot(), opts))
+}
@@ -0,0 +1,339 @@
+package export
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+type (
+	NodeType string
+
+	// Diagram is a format-agnostic view of a graph, with the same kind of nodes as the frontend.
+	Diagram struct {
+		Groups []Group
+		Nodes  []Node
+		Edges  []Edge
+	}
+
+	// Group gathers the resources of a compose project on a host.
+	Group struct {
+		ID    string
+		Label string
+	}
+
+	Node struct {
+		ID    string
+		Type  NodeType
+		Label string
+		// Group is the ID of the group of the node, if any.
+		Group string `json:",omitempty"`
+		// State summarizes the status and the health of containers.
+		State State `json:",omitempty"`
+		// Data holds the attributes of the underlying resource.
+		Data map[string]string `json:",omitempty"`
+	}
+
+	Edge struct {
+		Source string
+		Target string
+		Label  string `json:",omitempty"`
+		// Dependency is the kind of the dependency between two containers ; the other edges lead to resources.
+		Dependency containers.DependencyKind `json:",omitempty"`
+	}
+
+	State string
+
+	Options struct {
+		// HideStopped excludes the containers that are not running.
+		HideStopped bool
+	}
+
+	builder struct {
+		Options
+		diagram  *Diagram
+		multi    bool
+		nodes    map[string]bool
+		groups   map[string]bool
+		networks map[string]networkInfo
+		volumes  map[string]volumeInfo
+	}
+
+	networkInfo struct {
+		name    string
+		project *containers.Project
+		data    map[string]string
+	}
+
+	volumeInfo struct {
+		project *containers.Project
+		data    map[string]string
+	}
+)
+
+const (
+	ContainerNode NodeType = "container"
+	NetworkNode   NodeType = "network"
+	VolumeNode    NodeType = "volume"
+	BindMountNode NodeType = "bindMount"
+	PortNode      NodeType = "port"
+
+	StateRunning   State = "running"
+	StateStarting  State = "starting"
+	StateUnhealthy State = "unhealthy"
+	StateStopped   State = "stopped"
+)
+
+// Build converts a graph snapshot.
+//
+// The networks and volumes are included when they are used by a container or belong to a compose project,
+// so the default networks and the anonymous volumes do not clutter the diagram.
+func Build(g graph.Graph, opts Options) *Diagram {
+	b := &builder{
+		Options:  opts,
+		diagram:  &Diagram{Groups: []Group{}, Nodes: []Node{}, Edges: []Edge{}},
+		multi:    len(g.Hosts) > 1,
+		nodes:    make(map[string]bool),
+		groups:   make(map[string]bool),
+		networks: make(map[string]networkInfo, len(g.Networks)),
+		volumes:  make(map[string]volumeInfo, len(g.Volumes)),
+	}
+
+	for _, network := range g.Networks {
+		b.networks[nodeID(network.Host, NetworkNode, string(network.ID))] = networkInfo{
+			name:    network.Name,
+			project: network.Project,
+			data:    map[string]string{"host": network.Host, "driver": network.Driver, "scope": network.Scope},
+		}
+	}
+	for _, vol := range g.Volumes {
+		b.volumes[nodeID(vol.Host, VolumeNode, string(vol.Name))] = volumeInfo{
+			project: vol.Project,
+			data:    map[string]string{"host": vol.Host, "driver": vol.Driver},
+		}
+	}
+
+	included := make([]*containers.Container, 0, len(g.Containers))
+	for i := range g.Containers {
+		ctn := &g.Containers[i]
+		if b.HideStopped && !ctn.Status.IsRunning() {
+			continue
+		}
+		b.addContainer(*ctn)
+		included = append(included, ctn)
+	}
+	b.addDependencies(included)
+
+	for _, network := range g.Networks {
+		if network.Project != nil {
+			b.addNetwork(network.Host, string(network.ID), network.Name)
+		}
+	}
+	for _, vol := range g.Volumes {
+		if vol.Project != nil {
+			b.addVolume(vol.Host, string(vol.Name))
+		}
+	}
+
+	sort.Slice(b.diagram.Groups, func(i, j int) bool { return b.diagram.Groups[i].ID < b.diagram.Groups[j].ID })
+	return b.diagram
+}
+
+// ContainerState summarizes the status and the health of a container.
+func ContainerState(ctn containers.Container) State {
+	switch {
+	case !ctn.Status.IsRunning():
+		return StateStopped
+	case ctn.Healthy == "unhealthy":
+		return StateUnhealthy
+	case ctn.Healthy == "starting":
+		return StateStarting
+	default:
+		return StateRunning
+	}
+}
+
+func (b *builder) addContainer(ctn containers.Container) {
+	id := nodeID(ctn.Host, ContainerNode, string(ctn.ID))
+	data := map[string]string{
+		"host":   ctn.Host,
+		"image":  ctn.Image,
+		"status": string(ctn.Status),
+	}
+	if ctn.Healthy != "" {
+		data["health"] = ctn.Healthy
+	}
+	if ctn.Service != "" {
+		data["service"] = ctn.Service
+	}
+	if ctn.Project != nil {
+		data["project"] = ctn.Project.Name
+	}
+
+	ports := utils.SortedKeys(ctn.Ports)
+	if len(ports) > 0 {
+		bindings := make([]string, len(ports))
+		for i, inner := range ports {
+			bindings[i] = hostAddress(ctn.Ports[inner]) + "->" + inner
+		}
+		data["ports"] = strings.Join(bindings, ", ")
+	}
+
+	b.addNode(Node{
+		ID:    id,
+		Type:  ContainerNode,
+		Label: ctn.Name,
+		Group: b.addGroup(ctn.Host, ctn.Project),
+		State: ContainerState(ctn),
+		Data:  data,
+	})
+
+	for _, name := range utils.SortedKeys(ctn.Networks) {
+		network := ctn.Networks[name]
+		if network.ID == "" {
+			continue
+		}
+		b.addEdge(id, b.addNetwork(ctn.Host, network.ID, network.Name), "")
+	}
+
+	for _, mount := range ctn.Mounts {
+		switch mount.Type {
+		case "volume":
+			b.addEdge(id, b.addVolume(ctn.Host, mount.Name), mount.Destination)
+		case "bind":
+			target := nodeID(ctn.Host, BindMountNode, mount.Source)
+			b.addNode(Node{ID: target, Type: BindMountNode, Label: mount.Source, Data: map[string]string{"host": ctn.Host}})
+			b.addEdge(id, target, mount.Destination)
+		}
+	}
+
+	for _, inner := range ports {
+		address := hostAddress(ctn.Ports[inner])
+		target := nodeID(ctn.Host, PortNode, address)
+		b.addNode(Node{ID: target, Type: PortNode, Label: address, Data: map[string]string{"host": ctn.Host}})
+		b.addEdge(id, target, inner)
+	}
+}
+
+// addDependencies links the containers to the ones they depend on ; the dependencies on containers
+// that are not in the diagram are left out.
+func (b *builder) addDependencies(ctns []*containers.Container) {
+	for _, ctn := range ctns {
+		source := nodeID(ctn.Host, ContainerNode, string(ctn.ID))
+		for _, dep := range ctn.Dependencies {
+			for _, other := range ctns {
+				if ctn.DependsOn(dep, other) {
+					edge := Edge{source, nodeID(other.Host, ContainerNode, string(other.ID)), string(dep.Kind), dep.Kind}
+					b.diagram.Edges = append(b.diagram.Edges, edge)
+				}
+			}
+		}
+	}
+}
+
+func (b *builder) addNetwork(host, netID, name string) string {
+	id := nodeID(host, NetworkNode, netID)
+	info, found := b.networks[id]
+	if !found {
+		info = networkInfo{name: name, data: map[string]string{"host": host}}
+	}
+	if info.name == "" {
+		info.name = netID
+	}
+	b.addNode(Node{ID: id, Type: NetworkNode, Label: info.name, Group: b.addGroup(host, info.project), Data: info.data})
+	return id
+}
+
+func (b *builder) addVolume(host, name string) string {
+	id := nodeID(host, VolumeNode, name)
+	info, found := b.volumes[id]
+	if !found {
+		info = volumeInfo{data: map[string]string{"host": host}}
+	}
+	b.addNode(Node{ID: id, Type: VolumeNode, Label: name, Group: b.addGroup(host, info.project), Data: info.data})
+	return id
+}
+
+// addGroup returns the ID of the group of the project, adding it if need be.
+func (b *builder) addGroup(host string, project *containers.Project) string {
+	if project == nil {
+		return ""
+	}
+	id := nodeID(host, "project", project.Name)
+	if !b.groups[id] {
+		b.groups[id] = true
+		label := project.Name
+		if b.multi {
+			label = fmt.Sprintf("%s (%s)", project.Name, host)
+		}
+		b.diagram.Groups = append(b.diagram.Groups, Group{ID: id, Label: label})
+	}
+	return id
+}
+
+func (b *builder) addNode(node Node) {
+	if b.nodes[node.ID] {
+		return
+	}
+	b.nodes[node.ID] = true
+	b.diagram.Nodes = append(b.diagram.Nodes, node)
+}
+
+func (b *builder) addEdge(source, target, label string) {
+	b.diagram.Edges = append(b.diagram.Edges, Edge{Source: source, Target: target, Label: label})
+}
+
+// Lines returns the text to display for the node ; containers also show their image.
+func (n *Node) Lines() []string {
+	if image := n.Data["image"]; n.Type == ContainerNode && image != "" {
+		return []string{n.Label, image}
+	}
+	return []string{n.Label}
+}
+
+// Color returns the background color of the node.
+func (n *Node) Color() string {
+	if n.Type == ContainerNode {
+		return stateColors[n.State]
+	}
+	return typeColors[n.Type]
+}
+
+// NodesByGroup returns the nodes of each group, and the ones that do not belong to any group under the empty key.
+func (d *Diagram) NodesByGroup() map[string][]Node {
+	byGroup := make(map[string][]Node, len(d.Groups)+1)
+	for _, node := range d.Nodes {
+		byGroup[node.Group] = append(byGroup[node.Group], node)
+	}
+	return byGroup
+}
+
+// aliases returns short identifiers for the groups and nodes, for the formats that restrict their syntax.
+func (d *Diagram) aliases() map[string]string {
+	aliases := make(map[string]string, len(d.Groups)+len(d.Nodes))
+	for i, group := range d.Groups {
+		aliases[group.ID] = "g" + strconv.Itoa(i)
+	}
+	for i, node := range d.Nodes {
+		aliases[node.ID] = "n" + strconv.Itoa(i)
+	}
+	return aliases
+}
+
+func nodeID(host string, typ NodeType, id string) string {
+	return fmt.Sprintf("%s/%s:%s", host, typ, id)
+}
+
+func hostAddress(port containers.Port) string {
+	ip := port.HostIp
+	if ip == "" {
+		ip = "0.0.0.0"
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port.HostPort))
+}
@@ -0,0 +1,120 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/networks"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/volumes"
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// testGraph is a compose project with a database and a web server, and a standalone container whose names
+// and labels need to be escaped.
+func testGraph() graph.Graph {
+	shop := &containers.Project{Name: "shop", WorkingDir: "/srv/shop"}
+	return graph.Graph{
+		Hosts: []string{"local"},
+		Containers: []containers.Container{
+			{
+				ID: "db1", Host: "local", Name: "shop-db-1", Image: "postgres:14", Status: "running", Healthy: "unhealthy",
+				Service: "db", Project: shop,
+				Networks: map[string]*containers.Network{"shop_default": {ID: "net1", Name: "shop_default"}},
+				Mounts:   []containers.Mount{{Name: "shop_data", Type: "volume", Destination: "/var/lib/postgresql/data", ReadWrite: true}},
+			},
+			{
+				ID: "web1", Host: "local", Name: "shop-web-1", Image: "nginx:1.23", Status: "running",
+				Service: "web", Project: shop,
+				Networks: map[string]*containers.Network{"shop_default": {ID: "net1", Name: "shop_default"}},
+				Mounts:   []containers.Mount{{Type: "bind", Source: "/srv/shop/html", Destination: "/usr/share/nginx/html"}},
+				Ports: map[string]containers.Port{
+					"80/tcp":  {HostPort: 8080},
+					"443/tcp": {HostIp: "127.0.0.1", HostPort: 8443},
+				},
+				Dependencies: []containers.Dependency{{Kind: containers.DependsOn, Service: "db", Condition: "service_healthy"}},
+			},
+			{
+				ID: "odd1", Host: "local", Name: `odd "name" <b>#1~\`, Image: "busybox", Status: "exited",
+				Networks: map[string]*containers.Network{"bridge": {ID: "bridge1", Name: "bridge"}},
+				Mounts:   []containers.Mount{{Type: "bind", Source: `/tmp/a "quoted" dir`, Destination: "/data"}},
+			},
+		},
+		Networks: []networks.Network{
+			{ID: "net1", Host: "local", Name: "shop_default", Driver: "bridge", Scope: "local", Project: shop},
+			{ID: "bridge1", Host: "local", Name: "bridge", Driver: "bridge", Scope: "local"},
+			{ID: "host1", Host: "local", Name: "host", Driver: "host", Scope: "local"},
+		},
+		Volumes: []volumes.Volume{
+			{Name: "shop_data", Host: "local", Driver: "local", Project: shop},
+			{Name: "shop_cache", Host: "local", Driver: "local", Project: shop},
+			{Name: "0123456789abcdef", Host: "local", Driver: "local"},
+		},
+	}
+}
+
+// assertGolden compares the output with a file of the testdata directory, which is rewritten with -update.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"diagram", Options{}},
+		{"diagram_running", Options{HideStopped: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.MarshalIndent(Build(testGraph(), tt.opts), "", "  ")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			assertGolden(t, tt.name+".json", append(data, '\n'))
+		})
+	}
+}
+
+func TestBuildSeveralHosts(t *testing.T) {
+	g := testGraph()
+	g.Hosts = append(g.Hosts, "remote")
+	remote := g.Containers[1]
+	remote.Host = "remote"
+	g.Containers = append(g.Containers, remote)
+
+	d := Build(g, Options{})
+	labels := make([]string, len(d.Groups))
+	for i, group := range d.Groups {
+		labels[i] = group.Label
+	}
+	if len(labels) != 2 || labels[0] != "shop (local)" || labels[1] != "shop (remote)" {
+		t.Errorf("unexpected groups: %v", labels)
+	}
+	// The dependency of the remote container is left out, as db only runs on the local host
+	for _, edge := range d.Edges {
+		if edge.Dependency != "" && edge.Source == "remote/container:web1" {
+			t.Errorf("unexpected dependency across hosts: %+v", edge)
+		}
+	}
+}
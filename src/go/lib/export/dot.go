@@ -0,0 +1,85 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	dotShapes = map[NodeType]string{
+		ContainerNode: "box",
+		NetworkNode:   "ellipse",
+		VolumeNode:    "cylinder",
+		BindMountNode: "folder",
+		PortNode:      "cds",
+	}
+
+	dotStateStyles = map[State]string{
+		StateUnhealthy: `style="rounded,filled", color="#c62828"`,
+		StateStopped:   `style="rounded,filled,dashed", fontcolor="#616161"`,
+	}
+)
+
+// WriteDOT renders the diagram as a Graphviz digraph, with the compose projects as clusters.
+func WriteDOT(w io.Writer, d *Diagram) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintln(buf, "digraph \"docker-graph\" {")
+	fmt.Fprintln(buf, "\trankdir=LR;")
+	fmt.Fprintln(buf, "\tnode [fontname=\"Helvetica\", fontsize=10];")
+	fmt.Fprintln(buf, "\tedge [fontname=\"Helvetica\", fontsize=8];")
+
+	byGroup := d.NodesByGroup()
+	for i, group := range d.Groups {
+		fmt.Fprintf(buf, "\n\tsubgraph \"cluster_%d\" {\n", i)
+		fmt.Fprintf(buf, "\t\tlabel=%s;\n", dotQuote(group.Label))
+		fmt.Fprintln(buf, "\t\tstyle=\"rounded,dashed\";")
+		for _, node := range byGroup[group.ID] {
+			writeDOTNode(buf, "\t\t", node)
+		}
+		fmt.Fprintln(buf, "\t}")
+	}
+
+	if nodes := byGroup[""]; len(nodes) > 0 {
+		fmt.Fprintln(buf)
+		for _, node := range nodes {
+			writeDOTNode(buf, "\t", node)
+		}
+	}
+
+	if len(d.Edges) > 0 {
+		fmt.Fprintln(buf)
+		for _, edge := range d.Edges {
+			fmt.Fprintf(buf, "\t%s -> %s", dotQuote(edge.Source), dotQuote(edge.Target))
+			switch {
+			case edge.Dependency != "":
+				fmt.Fprintf(buf, " [label=%s, style=dashed, color=\"#1565c0\"]", dotQuote(edge.Label))
+			case edge.Label != "":
+				fmt.Fprintf(buf, " [label=%s]", dotQuote(edge.Label))
+			}
+			fmt.Fprintln(buf, ";")
+		}
+	}
+
+	fmt.Fprintln(buf, "}")
+	return buf.Flush()
+}
+
+func writeDOTNode(w io.Writer, indent string, node Node) {
+	fmt.Fprintf(w, "%s%s [label=%s, shape=%s", indent, dotQuote(node.ID), dotQuote(strings.Join(node.Lines(), "\n")), dotShapes[node.Type])
+	if style, found := dotStateStyles[node.State]; found {
+		fmt.Fprintf(w, ", %s", style)
+	} else if node.Type == ContainerNode {
+		fmt.Fprint(w, `, style="rounded,filled"`)
+	} else {
+		fmt.Fprint(w, ", style=filled")
+	}
+	fmt.Fprintf(w, ", fillcolor=%s];\n", dotQuote(node.Color()))
+}
+
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
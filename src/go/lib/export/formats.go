@@ -0,0 +1,44 @@
+package export
+
+import (
+	"io"
+
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+type (
+	// Format writes a diagram in a given syntax.
+	Format struct {
+		ContentType string
+		Write       func(w io.Writer, d *Diagram) error
+	}
+)
+
+var (
+	Formats = map[string]Format{
+		"dot":      {"text/vnd.graphviz; charset=utf-8", WriteDOT},
+		"graphml":  {"application/graphml+xml; charset=utf-8", WriteGraphML},
+		"jgf":      {"application/vnd.jgf+json", WriteJGF},
+		"mermaid":  {"text/vnd.mermaid; charset=utf-8", WriteMermaid},
+		"plantuml": {"text/plain; charset=utf-8", WritePlantUML},
+	}
+
+	// The colors are the same in all formats.
+	typeColors = map[NodeType]string{
+		NetworkNode:   "#bbdefb",
+		VolumeNode:    "#d7ccc8",
+		BindMountNode: "#f5f5f5",
+		PortNode:      "#ffe0b2",
+	}
+	stateColors = map[State]string{
+		StateRunning:   "#c8e6c9",
+		StateStarting:  "#fff9c4",
+		StateUnhealthy: "#ffcdd2",
+		StateStopped:   "#e0e0e0",
+	}
+)
+
+// FormatNames returns the names of the available formats, sorted.
+func FormatNames() []string {
+	return utils.SortedKeys(Formats)
+}
@@ -0,0 +1,43 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormats(t *testing.T) {
+	extensions := map[string]string{
+		"dot":      ".dot",
+		"graphml":  ".graphml",
+		"jgf":      ".jgf.json",
+		"mermaid":  ".mmd",
+		"plantuml": ".puml",
+	}
+	for _, name := range FormatNames() {
+		t.Run(name, func(t *testing.T) {
+			ext, found := extensions[name]
+			if !found {
+				t.Fatalf("no golden file for the %s format", name)
+			}
+			var buf bytes.Buffer
+			if err := Formats[name].Write(&buf, Build(testGraph(), Options{})); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			assertGolden(t, "diagram"+ext, buf.Bytes())
+		})
+	}
+}
+
+func TestFormatsWithEmptyDiagram(t *testing.T) {
+	for _, name := range FormatNames() {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Formats[name].Write(&buf, &Diagram{}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if buf.Len() == 0 {
+				t.Error("expected an empty document, got nothing")
+			}
+		})
+	}
+}
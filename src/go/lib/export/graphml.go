@@ -0,0 +1,130 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+type (
+	graphML struct {
+		XMLName xml.Name     `xml:"graphml"`
+		XMLNS   string       `xml:"xmlns,attr"`
+		Keys    []graphMLKey `xml:"key"`
+		Graph   graphMLGraph `xml:"graph"`
+	}
+
+	graphMLKey struct {
+		ID   string `xml:"id,attr"`
+		For  string `xml:"for,attr"`
+		Name string `xml:"attr.name,attr"`
+		Type string `xml:"attr.type,attr"`
+	}
+
+	graphMLGraph struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	}
+
+	graphMLNode struct {
+		ID   string        `xml:"id,attr"`
+		Data []graphMLData `xml:"data"`
+	}
+
+	graphMLEdge struct {
+		Source string        `xml:"source,attr"`
+		Target string        `xml:"target,attr"`
+		Data   []graphMLData `xml:"data"`
+	}
+
+	graphMLData struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+)
+
+const (
+	graphMLNamespace      = "http://graphml.graphdrawing.org/xmlns"
+	graphMLEdgeLabel      = "edgeLabel"
+	graphMLEdgeDependency = "edgeDependency"
+)
+
+// WriteGraphML renders the diagram as a GraphML document, for Gephi, yEd and the like.
+//
+// The nodes carry their type, label, group and state, and the attributes of their resource ; empty values are left out.
+func WriteGraphML(w io.Writer, d *Diagram) error {
+	groups := make(map[string]string, len(d.Groups))
+	for _, group := range d.Groups {
+		groups[group.ID] = group.Label
+	}
+
+	attributes := map[string]bool{"type": true, "label": true, "group": true, "state": true}
+	nodes := make([]graphMLNode, len(d.Nodes))
+	for i, node := range d.Nodes {
+		values := map[string]string{
+			"type":  string(node.Type),
+			"label": node.Label,
+			"group": groups[node.Group],
+			"state": string(node.State),
+		}
+		for name, value := range node.Data {
+			attributes[name] = true
+			values[name] = value
+		}
+		nodes[i] = graphMLNode{ID: node.ID, Data: graphMLValues(values)}
+	}
+
+	edges := make([]graphMLEdge, len(d.Edges))
+	for i, edge := range d.Edges {
+		edges[i] = graphMLEdge{Source: edge.Source, Target: edge.Target}
+		if edge.Label != "" {
+			edges[i].Data = append(edges[i].Data, graphMLData{graphMLEdgeLabel, edge.Label})
+		}
+		if edge.Dependency != "" {
+			edges[i].Data = append(edges[i].Data, graphMLData{graphMLEdgeDependency, string(edge.Dependency)})
+		}
+	}
+
+	names := utils.SortedKeys(attributes)
+	keys := make([]graphMLKey, 0, len(names)+2)
+	for _, name := range names {
+		keys = append(keys, graphMLKey{ID: name, For: "node", Name: name, Type: "string"})
+	}
+	keys = append(keys,
+		graphMLKey{ID: graphMLEdgeLabel, For: "edge", Name: "label", Type: "string"},
+		graphMLKey{ID: graphMLEdgeDependency, For: "edge", Name: "dependency", Type: "string"},
+	)
+
+	doc := graphML{
+		XMLNS: graphMLNamespace,
+		Keys:  keys,
+		Graph: graphMLGraph{ID: "docker-graph", EdgeDefault: "directed", Nodes: nodes, Edges: edges},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// graphMLValues converts the non-empty values, sorted by key.
+func graphMLValues(values map[string]string) []graphMLData {
+	data := make([]graphMLData, 0, len(values))
+	for key, value := range values {
+		if value != "" {
+			data = append(data, graphMLData{key, value})
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Key < data[j].Key })
+	return data
+}
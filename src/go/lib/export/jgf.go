@@ -0,0 +1,81 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type (
+	jgfDocument struct {
+		Graph jgfGraph `json:"graph"`
+	}
+
+	jgfGraph struct {
+		ID       string             `json:"id"`
+		Type     string             `json:"type"`
+		Directed bool               `json:"directed"`
+		Metadata jgfGraphMetadata   `json:"metadata"`
+		Nodes    map[string]jgfNode `json:"nodes"`
+		Edges    []jgfEdge          `json:"edges"`
+	}
+
+	jgfGraphMetadata struct {
+		Groups []jgfGroup `json:"groups"`
+	}
+
+	jgfGroup struct {
+		ID    string `json:"id"`
+		Label string `json:"label"`
+	}
+
+	jgfNode struct {
+		Label    string          `json:"label"`
+		Metadata jgfNodeMetadata `json:"metadata"`
+	}
+
+	jgfNodeMetadata struct {
+		Type  NodeType          `json:"type"`
+		Group string            `json:"group,omitempty"`
+		State State             `json:"state,omitempty"`
+		Data  map[string]string `json:"data,omitempty"`
+	}
+
+	jgfEdge struct {
+		Source string `json:"source"`
+		Target string `json:"target"`
+		Label  string `json:"label,omitempty"`
+		// Relation is the kind of dependency between containers.
+		Relation string `json:"relation,omitempty"`
+	}
+)
+
+// WriteJGF renders the diagram in the JSON Graph Format (version 2, see https://jsongraphformat.info/).
+//
+// The groups are listed in the metadata of the graph ; the nodes refer to them by ID.
+func WriteJGF(w io.Writer, d *Diagram) error {
+	doc := jgfDocument{jgfGraph{
+		ID:       "docker-graph",
+		Type:     "docker-graph",
+		Directed: true,
+		Metadata: jgfGraphMetadata{Groups: make([]jgfGroup, len(d.Groups))},
+		Nodes:    make(map[string]jgfNode, len(d.Nodes)),
+		Edges:    make([]jgfEdge, len(d.Edges)),
+	}}
+	for i, group := range d.Groups {
+		doc.Graph.Metadata.Groups[i] = jgfGroup(group)
+	}
+	for _, node := range d.Nodes {
+		doc.Graph.Nodes[node.ID] = jgfNode{
+			Label:    node.Label,
+			Metadata: jgfNodeMetadata{Type: node.Type, Group: node.Group, State: node.State, Data: node.Data},
+		}
+	}
+	for i, edge := range d.Edges {
+		doc.Graph.Edges[i] = jgfEdge{Source: edge.Source, Target: edge.Target, Label: edge.Label, Relation: string(edge.Dependency)}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(doc)
+}
@@ -0,0 +1,84 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// The hashes start the entity codes, so they are escaped too.
+	mermaidEscaper = strings.NewReplacer("#", "#35;", `"`, "#quot;", "<", "#lt;", ">", "#gt;")
+
+	// mermaidShapes holds the delimiters of the node shapes.
+	mermaidShapes = map[NodeType][2]string{
+		ContainerNode: {"(", ")"},
+		NetworkNode:   {"{{", "}}"},
+		VolumeNode:    {"[(", ")]"},
+		BindMountNode: {">", "]"},
+		PortNode:      {"([", "])"},
+	}
+
+	mermaidStateStyles = map[State]string{
+		StateUnhealthy: ",stroke:#c62828",
+		StateStopped:   ",color:#616161,stroke-dasharray:4",
+	}
+)
+
+// WriteMermaid renders the diagram as a Mermaid flowchart, with the compose projects as subgraphs.
+func WriteMermaid(w io.Writer, d *Diagram) error {
+	buf := bufio.NewWriter(w)
+	aliases := d.aliases()
+	fmt.Fprintln(buf, "flowchart LR")
+
+	byGroup := d.NodesByGroup()
+	for _, group := range d.Groups {
+		fmt.Fprintf(buf, "  subgraph %s[%s]\n", aliases[group.ID], mermaidQuote(group.Label))
+		for _, node := range byGroup[group.ID] {
+			writeMermaidNode(buf, "    ", aliases[node.ID], node)
+		}
+		fmt.Fprintln(buf, "  end")
+	}
+	for _, node := range byGroup[""] {
+		writeMermaidNode(buf, "  ", aliases[node.ID], node)
+	}
+
+	for _, edge := range d.Edges {
+		switch {
+		case edge.Dependency != "":
+			fmt.Fprintf(buf, "  %s -.->|%s| %s\n", aliases[edge.Source], mermaidQuote(edge.Label), aliases[edge.Target])
+		case edge.Label != "":
+			fmt.Fprintf(buf, "  %s -->|%s| %s\n", aliases[edge.Source], mermaidQuote(edge.Label), aliases[edge.Target])
+		default:
+			fmt.Fprintf(buf, "  %s --> %s\n", aliases[edge.Source], aliases[edge.Target])
+		}
+	}
+
+	for _, typ := range []NodeType{NetworkNode, VolumeNode, BindMountNode, PortNode} {
+		fmt.Fprintf(buf, "  classDef %s fill:%s\n", typ, typeColors[typ])
+	}
+	for _, state := range []State{StateRunning, StateStarting, StateUnhealthy, StateStopped} {
+		fmt.Fprintf(buf, "  classDef %s fill:%s%s\n", state, stateColors[state], mermaidStateStyles[state])
+	}
+
+	return buf.Flush()
+}
+
+func writeMermaidNode(w io.Writer, indent, alias string, node Node) {
+	shape := mermaidShapes[node.Type]
+	class := string(node.Type)
+	if node.Type == ContainerNode {
+		class = string(node.State)
+	}
+	lines := node.Lines()
+	for i, line := range lines {
+		lines[i] = mermaidEscaper.Replace(line)
+	}
+	label := `"` + strings.Join(lines, "<br/>") + `"`
+	fmt.Fprintf(w, "%s%s%s%s%s:::%s\n", indent, alias, shape[0], label, shape[1], class)
+}
+
+func mermaidQuote(s string) string {
+	return `"` + mermaidEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,68 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// The backslashes would be mistaken for escape sequences, and the tildes and the angle brackets for creole markup.
+	plantUMLEscaper = strings.NewReplacer(`\`, `\\`, `"`, "'", "\n", `\n`, "~", "~~", "<", "~<")
+
+	plantUMLElements = map[NodeType]string{
+		ContainerNode: "component",
+		NetworkNode:   "cloud",
+		VolumeNode:    "database",
+		BindMountNode: "folder",
+		PortNode:      "interface",
+	}
+)
+
+// WritePlantUML renders the diagram as a PlantUML deployment diagram, with the compose projects as frames.
+func WritePlantUML(w io.Writer, d *Diagram) error {
+	buf := bufio.NewWriter(w)
+	aliases := d.aliases()
+	fmt.Fprintln(buf, "@startuml")
+	fmt.Fprintln(buf, "left to right direction")
+
+	byGroup := d.NodesByGroup()
+	for _, group := range d.Groups {
+		fmt.Fprintf(buf, "frame %s as %s {\n", plantUMLQuote(group.Label), aliases[group.ID])
+		for _, node := range byGroup[group.ID] {
+			writePlantUMLNode(buf, "  ", aliases[node.ID], node)
+		}
+		fmt.Fprintln(buf, "}")
+	}
+	for _, node := range byGroup[""] {
+		writePlantUMLNode(buf, "", aliases[node.ID], node)
+	}
+
+	for _, edge := range d.Edges {
+		arrow := "-->"
+		if edge.Dependency != "" {
+			arrow = "..>"
+		}
+		fmt.Fprintf(buf, "%s %s %s", aliases[edge.Source], arrow, aliases[edge.Target])
+		if edge.Label != "" {
+			fmt.Fprintf(buf, " : %s", plantUMLEscaper.Replace(edge.Label))
+		}
+		fmt.Fprintln(buf)
+	}
+
+	fmt.Fprintln(buf, "@enduml")
+	return buf.Flush()
+}
+
+func writePlantUMLNode(w io.Writer, indent, alias string, node Node) {
+	fmt.Fprintf(w, "%s%s %s as %s", indent, plantUMLElements[node.Type], plantUMLQuote(strings.Join(node.Lines(), "\n")), alias)
+	if node.State != "" {
+		fmt.Fprintf(w, " <<%s>>", node.State)
+	}
+	fmt.Fprintf(w, " %s\n", node.Color())
+}
+
+func plantUMLQuote(s string) string {
+	return `"` + plantUMLEscaper.Replace(s) + `"`
+}
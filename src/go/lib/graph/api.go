@@ -0,0 +1,94 @@
+package graph
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+type (
+	API struct {
+		source  *Source
+		events  LastEventSource
+		history History
+	}
+
+	LastEventSource interface {
+		Last() (api.Event, bool)
+	}
+
+	// History rebuilds the past states of the graph.
+	History interface {
+		GraphAt(at time.Time) (Graph, error)
+	}
+)
+
+// NewAPI creates the API ; history can be nil, in which case the past states are not available.
+func NewAPI(source *Source, events LastEventSource, history History) *API {
+	return &API{source, events, history}
+}
+
+func (a *API) MountInto(mnt fiber.Router) {
+	mnt.Get("/graph", a.checkETag, a.getGraph)
+	mnt.Get("/containers", a.checkETag, a.listContainers)
+	mnt.Get("/containers/:id", a.checkETag, a.getContainer)
+	mnt.Get("/status", a.getStatus)
+}
+
+// checkETag sets the ETag of the response from the ID of the last dispatched event,
+// and answers "304 Not Modified" if the client already knows it.
+func (a *API) checkETag(ctx *fiber.Ctx) error {
+	// The past states do not change
+	if ctx.Query("at") != "" {
+		return ctx.Next()
+	}
+	event, found := a.events.Last()
+	if !found {
+		return ctx.Next()
+	}
+	etag := strconv.Quote(event.ID())
+	ctx.Set(fiber.HeaderETag, etag)
+	if ctx.Get(fiber.HeaderIfNoneMatch) == etag {
+		return ctx.SendStatus(fiber.StatusNotModified)
+	}
+	return ctx.Next()
+}
+
+// getGraph returns the current graph, or the one at the time given by the "at" query parameter.
+func (a *API) getGraph(ctx *fiber.Ctx) error {
+	value := ctx.Query("at")
+	if value == "" {
+		return ctx.JSON(a.source.Snapshot())
+	}
+	if a.history == nil {
+		return fiber.NewError(fiber.StatusNotImplemented, "the history is not enabled")
+	}
+	at, err := utils.ParseTime(value, time.Now())
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid at parameter")
+	}
+	g, err := a.history.GraphAt(at)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(g)
+}
+
+func (a *API) listContainers(ctx *fiber.Ctx) error {
+	return ctx.JSON(a.source.ListContainers())
+}
+
+func (a *API) getStatus(ctx *fiber.Ctx) error {
+	return ctx.JSON(a.source.Status())
+}
+
+func (a *API) getContainer(ctx *fiber.Ctx) error {
+	ctn, found := a.source.Container(ctx.Query("host"), ctx.Params("id"))
+	if !found {
+		return fiber.ErrNotFound
+	}
+	return ctx.JSON(ctn)
+}
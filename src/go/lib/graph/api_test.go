@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/gofiber/fiber/v2"
+)
+
+type (
+	fakeEvents struct{}
+
+	// fakeHistory has a single host before the given time.
+	fakeHistory struct {
+		until time.Time
+	}
+)
+
+func (fakeEvents) Last() (api.Event, bool) {
+	return nil, false
+}
+
+func (h *fakeHistory) GraphAt(at time.Time) (Graph, error) {
+	if at.After(h.until) {
+		return Graph{}, errors.New("too recent")
+	}
+	return Graph{Hosts: []string{"old"}}, nil
+}
+
+func TestAPIGraphAt(t *testing.T) {
+	until := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		history   bool
+		query     string
+		status    int
+		wantHosts []string
+	}{
+		{"current graph", true, "", fiber.StatusOK, []string{}},
+		{"past graph", true, "?at=2019-12-31T12:00:00Z", fiber.StatusOK, []string{"old"}},
+		{"history error", true, "?at=2020-01-02", fiber.StatusInternalServerError, nil},
+		{"invalid time", true, "?at=yesterday", fiber.StatusBadRequest, nil},
+		{"no history", false, "?at=2019-12-31", fiber.StatusNotImplemented, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var history History
+			if tt.history {
+				history = &fakeHistory{until: until}
+			}
+			app := fiber.New()
+			NewAPI(&Source{}, fakeEvents{}, history).MountInto(app)
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/graph"+tt.query, nil), -1)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("unexpected status: %d, %s", resp.StatusCode, body)
+			}
+			if tt.wantHosts == nil {
+				return
+			}
+			var g Graph
+			if err := json.Unmarshal(body, &g); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(g.Hosts) != len(tt.wantHosts) || (len(g.Hosts) > 0 && g.Hosts[0] != tt.wantHosts[0]) {
+				t.Errorf("unexpected hosts: %v, want %v", g.Hosts, tt.wantHosts)
+			}
+		})
+	}
+}
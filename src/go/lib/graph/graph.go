@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/hosts"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/images"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/networks"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/swarm"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/volumes"
+)
+
+type (
+	Graph struct {
+		Hosts      []string
+		Containers []containers.Container
+		Networks   []networks.Network
+		Volumes    []volumes.Volume
+		Images     []images.Image
+		Nodes      []swarm.Node
+		Services   []swarm.Service
+		Tasks      []swarm.Task
+		Configs    []swarm.Config
+		Secrets    []swarm.Secret
+	}
+
+	// Status describes the state of the connections to the Docker hosts.
+	Status struct {
+		Hosts map[string]connections.Status
+	}
+
+	// Source gathers the Docker hosts used to build the graph.
+	Source struct {
+		Hosts []*hosts.Host
+	}
+)
+
+func (s *Source) Snapshot() (g Graph) {
+	g.Hosts = make([]string, 0, len(s.Hosts))
+	g.Containers = []containers.Container{}
+	g.Networks = []networks.Network{}
+	g.Volumes = []volumes.Volume{}
+	g.Images = []images.Image{}
+	g.Nodes = []swarm.Node{}
+	g.Services = []swarm.Service{}
+	g.Tasks = []swarm.Task{}
+	g.Configs = []swarm.Config{}
+	g.Secrets = []swarm.Secret{}
+	for _, host := range s.Hosts {
+		g.Hosts = append(g.Hosts, host.Name)
+		g.Containers = append(g.Containers, host.Containers.List()...)
+		g.Networks = append(g.Networks, host.Networks.List()...)
+		g.Volumes = append(g.Volumes, host.Volumes.List()...)
+		g.Images = append(g.Images, host.Images.List()...)
+		if host.Swarm != nil {
+			g.Nodes = append(g.Nodes, host.Swarm.Nodes()...)
+			g.Services = append(g.Services, host.Swarm.Services()...)
+			g.Tasks = append(g.Tasks, host.Swarm.Tasks()...)
+			g.Configs = append(g.Configs, host.Swarm.Configs()...)
+			g.Secrets = append(g.Secrets, host.Swarm.Secrets()...)
+		}
+	}
+	return
+}
+
+func (s *Source) Status() Status {
+	status := Status{Hosts: make(map[string]connections.Status, len(s.Hosts))}
+	for _, host := range s.Hosts {
+		status.Hosts[host.Name] = host.Connection.Status()
+	}
+	return status
+}
+
+func (s *Source) ListContainers() []containers.Container {
+	list := []containers.Container{}
+	for _, host := range s.Hosts {
+		list = append(list, host.Containers.List()...)
+	}
+	return list
+}
+
+// Container looks for a container by ID or name, on the given host or on any of them if hostName is empty.
+func (s *Source) Container(hostName, idOrName string) (containers.Container, bool) {
+	for _, host := range s.Hosts {
+		if hostName != "" && host.Name != hostName {
+			continue
+		}
+		if ctn, found := host.Containers.Get(idOrName); found {
+			return ctn, true
+		}
+	}
+	return containers.Container{}, false
+}
@@ -0,0 +1,104 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
+)
+
+type (
+	// repository is the part of the repositories used by the metrics.
+	repository interface {
+		Len() int
+		Pending() int
+	}
+
+	containerKey struct {
+		host    string
+		project string
+		status  string
+		health  string
+	}
+)
+
+var (
+	_ metrics.Collector = (*Source)(nil)
+)
+
+// Collect provides the metrics of the connections and of the repositories of the hosts, and the gauges
+// of the topology.
+func (s *Source) Collect() []metrics.Family {
+	connected := metrics.Family{Name: "docker_graph_connected", Help: "Whether the Docker host is connected", Type: "gauge"}
+	reconnects := metrics.Family{Name: "docker_graph_reconnects_total", Help: "Number of reconnections to the Docker host", Type: "counter"}
+	sizes := metrics.Family{Name: "docker_graph_repository_size", Help: "Number of resources known by the repository", Type: "gauge"}
+	pending := metrics.Family{Name: "docker_graph_repository_pending_messages", Help: "Number of Docker events waiting to be handled by the repository", Type: "gauge"}
+	ctnFamily := metrics.Family{Name: "docker_graph_containers", Help: "Number of containers by project, status and health", Type: "gauge"}
+	netFamily := metrics.Family{Name: "docker_graph_networks", Help: "Number of networks", Type: "gauge"}
+	volFamily := metrics.Family{Name: "docker_graph_volumes", Help: "Number of volumes", Type: "gauge"}
+
+	for _, host := range s.Hosts {
+		hostLabels := metrics.Labels{"host": host.Name}
+		status := host.Connection.Status()
+		connected.Samples = append(connected.Samples, metrics.Sample{Labels: hostLabels, Value: boolValue(status.State == connections.StateConnected)})
+		reconnects.Samples = append(reconnects.Samples, metrics.Sample{Labels: hostLabels, Value: float64(status.Reconnects)})
+
+		repositories := map[string]repository{
+			"containers": host.Containers,
+			"networks":   host.Networks,
+			"volumes":    host.Volumes,
+			"images":     host.Images,
+		}
+		if host.Swarm != nil {
+			repositories["swarm"] = host.Swarm
+		}
+		for _, name := range sortedNames(repositories) {
+			labels := metrics.Labels{"host": host.Name, "repository": name}
+			sizes.Samples = append(sizes.Samples, metrics.Sample{Labels: labels, Value: float64(repositories[name].Len())})
+			pending.Samples = append(pending.Samples, metrics.Sample{Labels: labels, Value: float64(repositories[name].Pending())})
+		}
+
+		counts := make(map[containerKey]int)
+		for _, ctn := range host.Containers.List() {
+			key := containerKey{host: host.Name, status: string(ctn.Status), health: ctn.Healthy}
+			if ctn.Project != nil {
+				key.project = ctn.Project.Name
+			}
+			counts[key]++
+		}
+		keys := make([]containerKey, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := keys[i], keys[j]
+			return strings.Join([]string{a.project, a.status, a.health}, "\x00") < strings.Join([]string{b.project, b.status, b.health}, "\x00")
+		})
+		for _, key := range keys {
+			labels := metrics.Labels{"host": key.host, "project": key.project, "status": key.status, "health": key.health}
+			ctnFamily.Samples = append(ctnFamily.Samples, metrics.Sample{Labels: labels, Value: float64(counts[key])})
+		}
+
+		netFamily.Samples = append(netFamily.Samples, metrics.Sample{Labels: hostLabels, Value: float64(host.Networks.Len())})
+		volFamily.Samples = append(volFamily.Samples, metrics.Sample{Labels: hostLabels, Value: float64(host.Volumes.Len())})
+	}
+
+	return []metrics.Family{connected, reconnects, sizes, pending, ctnFamily, netFamily, volFamily}
+}
+
+func sortedNames(repositories map[string]repository) []string {
+	names := make([]string, 0, len(repositories))
+	for name := range repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
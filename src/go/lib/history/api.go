@@ -0,0 +1,81 @@
+package history
+
+import (
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+type (
+	API struct {
+		store *Store
+	}
+)
+
+func NewAPI(store *Store) *API {
+	return &API{store}
+}
+
+func (a *API) MountInto(mnt fiber.Router) {
+	mnt.Get("/history/events", a.replay)
+	mnt.Get("/diff", a.diff)
+}
+
+// replay streams the state at "from", between a "resync" and a "synced" event, then the events until "to",
+// which defaults to now.
+func (a *API) replay(ctx *fiber.Ctx) error {
+	from, to, err := parseRange(ctx)
+	if err != nil {
+		return err
+	}
+
+	state, records, err := a.store.Replay(from, to)
+	if err != nil {
+		return err
+	}
+
+	initial := state.Records()
+	events := make([]api.Event, 0, len(initial)+len(records)+2)
+	events = append(events, &api.ControlEvent{Type: "resync", When: from})
+	for _, record := range initial {
+		events = append(events, record)
+	}
+	events = append(events, &api.ControlEvent{Type: "synced", When: from})
+	for _, record := range records {
+		events = append(events, record)
+	}
+	return api.WriteEventStream(ctx, events)
+}
+
+// diff compares the containers at "from" and at "to", which defaults to now.
+func (a *API) diff(ctx *fiber.Ctx) error {
+	from, to, err := parseRange(ctx)
+	if err != nil {
+		return err
+	}
+	diff, err := a.store.Diff(from, to)
+	if err != nil {
+		return err
+	}
+	return ctx.JSON(diff)
+}
+
+// parseRange reads the "from" and "to" query parameters ; "to" defaults to now.
+func parseRange(ctx *fiber.Ctx) (from, to time.Time, err error) {
+	now := time.Now()
+	if from, err = utils.ParseTime(ctx.Query("from"), now); err != nil {
+		return from, to, fiber.NewError(fiber.StatusBadRequest, "invalid from parameter")
+	}
+	to = now
+	if value := ctx.Query("to"); value != "" {
+		if to, err = utils.ParseTime(value, now); err != nil {
+			return from, to, fiber.NewError(fiber.StatusBadRequest, "invalid to parameter")
+		}
+	}
+	if to.Before(from) {
+		return from, to, fiber.NewError(fiber.StatusBadRequest, "to is before from")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,127 @@
+package history
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/inconshreveable/log15"
+)
+
+// get sends a request to the API of the store, and returns the status and the body of the response.
+func get(t *testing.T, store *Store, path string, query url.Values) (int, []byte) {
+	t.Helper()
+	app := fiber.New()
+	app.Use(func(ctx *fiber.Ctx) error {
+		ctx.Locals("logger", log.New())
+		return ctx.Next()
+	})
+	NewAPI(store).MountInto(app)
+
+	resp, err := app.Test(httptest.NewRequest("GET", path+"?"+query.Encode(), nil), -1)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return resp.StatusCode, body
+}
+
+func recordedStore(t *testing.T, n int) (*Store, []*Record) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	records := testRecords(n)
+	store := NewStore(path, nil)
+	store.Retention = 0
+	store.CheckpointSize = 1000
+	record(t, store, records)
+	return NewStore(path, nil), records
+}
+
+func TestAPIReplay(t *testing.T) {
+	store, records := recordedStore(t, 20)
+	from, to := baseTime.Add(5*time.Minute), baseTime.Add(10*time.Minute)
+
+	status, body := get(t, store, "/history/events", url.Values{
+		"from": {from.Format(time.RFC3339)},
+		"to":   {to.Format(time.RFC3339)},
+	})
+	if status != fiber.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", status, body)
+	}
+
+	var got []string
+	for _, message := range strings.Split(strings.TrimSpace(string(body)), "\n\n") {
+		var event struct{ TargetType, TargetID, Type string }
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(message), "data:")), &event); err != nil {
+			t.Fatalf("invalid message %q: %s", message, err)
+		}
+		got = append(got, event.TargetType+":"+event.TargetID+":"+event.Type)
+	}
+
+	// The state at "from", then the events until "to"
+	want := []string{"stream::resync"}
+	for _, record := range stateAt(records, from).Records() {
+		want = append(want, "container:"+record.TargetID+":updated")
+	}
+	want = append(want, "stream::synced")
+	for _, record := range records[6:11] {
+		want = append(want, "container:"+record.TargetID+":"+record.Type)
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("unexpected events:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestAPIDiff(t *testing.T) {
+	store, _ := recordedStore(t, 20)
+
+	status, body := get(t, store, "/diff", url.Values{
+		"from": {baseTime.Add(2 * time.Minute).Format(time.RFC3339)},
+		"to":   {baseTime.Add(6 * time.Minute).Format(time.RFC3339)},
+	})
+	if status != fiber.StatusOK {
+		t.Fatalf("unexpected status: %d, %s", status, body)
+	}
+	var diff struct {
+		Added, Removed []struct{ Name string }
+		Changed        []struct{ Name string }
+	}
+	if err := json.Unmarshal(body, &diff); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(diff.Added) != 2 || len(diff.Removed) != 1 || len(diff.Changed) != 1 || diff.Changed[0].Name != "c0" {
+		t.Errorf("unexpected diff: %s", body)
+	}
+}
+
+func TestAPIInvalidRange(t *testing.T) {
+	store, _ := recordedStore(t, 1)
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{"missing from", url.Values{}},
+		{"invalid from", url.Values{"from": {"yesterday"}}},
+		{"invalid to", url.Values{"from": {"-1h"}, "to": {"tomorrow"}}},
+		{"to before from", url.Values{"from": {"-1h"}, "to": {"-2h"}}},
+	}
+	for _, tt := range tests {
+		for _, path := range []string{"/history/events", "/diff"} {
+			t.Run(tt.name+" "+path, func(t *testing.T) {
+				if status, body := get(t, store, path, tt.query); status != fiber.StatusBadRequest {
+					t.Errorf("unexpected status: %d, %s", status, body)
+				}
+			})
+		}
+	}
+}
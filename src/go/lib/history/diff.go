@@ -0,0 +1,88 @@
+package history
+
+import (
+	"sort"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+)
+
+type (
+	// Diff lists the containers that have been added, removed or changed between two times.
+	// The containers are matched by host and name, so the recreated ones are changed, with a new ID.
+	Diff struct {
+		From    time.Time
+		To      time.Time
+		Added   []containers.Container
+		Removed []containers.Container
+		Changed []ContainerChanges
+	}
+
+	// ContainerChanges are the changes of a container, which has the given ID at the end.
+	ContainerChanges struct {
+		Host    string
+		Name    string
+		ID      containers.ID
+		Changes []containers.Change
+	}
+
+	containerKey struct {
+		host string
+		name string
+	}
+)
+
+// Diff compares the containers at two times.
+func (s *Store) Diff(from, to time.Time) (Diff, error) {
+	diff := Diff{
+		From:    from,
+		To:      to,
+		Added:   []containers.Container{},
+		Removed: []containers.Container{},
+		Changed: []ContainerChanges{},
+	}
+	// The file is read once, from the state at the first time
+	state, records, err := s.Replay(from, to)
+	if err != nil {
+		return diff, err
+	}
+	before, err := state.Graph()
+	if err != nil {
+		return diff, err
+	}
+	for _, record := range records {
+		state.Apply(record)
+	}
+	state.Time = to
+	after, err := state.Graph()
+	if err != nil {
+		return diff, err
+	}
+
+	previous := make(map[containerKey]*containers.Container, len(before.Containers))
+	for i := range before.Containers {
+		ctn := &before.Containers[i]
+		previous[containerKey{ctn.Host, ctn.Name}] = ctn
+	}
+	for i := range after.Containers {
+		ctn := &after.Containers[i]
+		key := containerKey{ctn.Host, ctn.Name}
+		old, found := previous[key]
+		delete(previous, key)
+		if !found {
+			diff.Added = append(diff.Added, *ctn)
+		} else if changes := containers.Compare(old, ctn); len(changes) > 0 {
+			diff.Changed = append(diff.Changed, ContainerChanges{ctn.Host, ctn.Name, ctn.ID, changes})
+		}
+	}
+	for _, ctn := range previous {
+		diff.Removed = append(diff.Removed, *ctn)
+	}
+
+	// The containers of the graphs are already sorted by host and name
+	sort.Slice(diff.Removed, func(i, j int) bool {
+		a, b := diff.Removed[i], diff.Removed[j]
+		return a.Host < b.Host || (a.Host == b.Host && a.Name < b.Name)
+	})
+	return diff, nil
+}
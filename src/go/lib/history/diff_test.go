@@ -0,0 +1,72 @@
+package history
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+)
+
+func TestDiff(t *testing.T) {
+	at := func(minutes int) time.Time { return baseTime.Add(time.Duration(minutes) * time.Minute) }
+	updated := func(minutes int, host, id, name, image string) *Record {
+		details := fmt.Sprintf(`{"ID":%q,"Host":%q,"Name":%q,"Image":%q,"Status":"running"}`, id, host, name, image)
+		return &Record{TargetType: "container", Host: host, TargetID: id, Type: "updated", Time: at(minutes), Details: []byte(details)}
+	}
+	removed := func(minutes int, host, id string) *Record {
+		return &Record{TargetType: "container", Host: host, TargetID: id, Type: "removed", Time: at(minutes)}
+	}
+	records := []*Record{
+		updated(1, "h", "k1", "kept", "busybox"),
+		updated(2, "h", "u1", "updated", "app:1"),
+		updated(3, "h", "r1", "recreated", "db:1"),
+		updated(4, "h", "g1", "gone", "busybox"),
+		// The same name on another host
+		updated(5, "h2", "o1", "updated", "app:1"),
+
+		// Between the two times
+		updated(11, "h", "t1", "transient", "busybox"),
+		removed(12, "h", "t1"),
+		removed(12, "h", "r1"),
+		updated(13, "h", "r2", "recreated", "db:1"),
+		removed(14, "h", "g1"),
+		updated(15, "h", "u1", "updated", "app:2"),
+		updated(16, "h", "n1", "new", "busybox"),
+
+		// After the second time
+		updated(25, "h", "l1", "late", "busybox"),
+		removed(26, "h", "k1"),
+	}
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	store := NewStore(path, nil)
+	store.Retention = 0
+	record(t, store, records)
+
+	diff, err := NewStore(path, nil).Diff(at(10), at(20))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	names := func(list []containers.Container) (names []string) {
+		for _, ctn := range list {
+			names = append(names, ctn.Host+"/"+ctn.Name)
+		}
+		return
+	}
+	if added := names(diff.Added); !reflect.DeepEqual(added, []string{"h/new"}) {
+		t.Errorf("unexpected added containers: %v", added)
+	}
+	if removed := names(diff.Removed); !reflect.DeepEqual(removed, []string{"h/gone"}) {
+		t.Errorf("unexpected removed containers: %v", removed)
+	}
+	want := []ContainerChanges{
+		{"h", "recreated", "r2", []containers.Change{{Field: "ID", From: "r1", To: "r2"}}},
+		{"h", "updated", "u1", []containers.Change{{Field: "Image", From: "app:1", To: "app:2"}}},
+	}
+	if !reflect.DeepEqual(diff.Changed, want) {
+		t.Errorf("unexpected changes: %+v", diff.Changed)
+	}
+}
@@ -0,0 +1,202 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/images"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/networks"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/swarm"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/volumes"
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+)
+
+type (
+	// Record is an event as it is stored ; the details are kept as JSON.
+	Record struct {
+		TargetType string
+		Host       string `json:",omitempty"`
+		TargetID   string
+		Type       string
+		Time       time.Time
+		Details    json.RawMessage `json:",omitempty"`
+	}
+
+	// Key identifies a resource of a host.
+	Key struct {
+		TargetType string
+		Host       string
+		TargetID   string
+	}
+
+	// State holds the resources that existed at a given time, as their last "updated" records.
+	State struct {
+		Time      time.Time
+		Hosts     map[string]bool
+		Resources map[Key]*Record
+	}
+
+	// checkpointDetails are the details of a checkpoint record, which holds a whole state.
+	checkpointDetails struct {
+		Hosts     []string
+		Resources []*Record
+	}
+)
+
+var (
+	_ api.Event = (*Record)(nil)
+)
+
+const (
+	streamTargetType     = "stream"
+	checkpointTargetType = "checkpoint"
+)
+
+func NewState(t time.Time) *State {
+	return &State{Time: t, Hosts: make(map[string]bool), Resources: make(map[Key]*Record)}
+}
+
+func (r *Record) ID() string {
+	return r.Time.Format(time.RFC3339Nano)
+}
+
+func (r *Record) Data() any {
+	return api.EventDTO{
+		TargetType: r.TargetType,
+		Host:       r.Host,
+		TargetID:   r.TargetID,
+		Type:       r.Type,
+		Time:       r.Time,
+		Details:    r.Details,
+	}
+}
+
+func (r *Record) Key() Key {
+	return Key{r.TargetType, r.Host, r.TargetID}
+}
+
+// Apply updates the state with a record ; the events about the streams do not change the resources,
+// and the checkpoints replace them.
+func (s *State) Apply(r *Record) {
+	if r.Host != "" {
+		s.Hosts[r.Host] = true
+	}
+	switch {
+	case r.TargetType == streamTargetType:
+	case r.TargetType == checkpointTargetType:
+		s.restore(r)
+	case r.Type == "removed":
+		delete(s.Resources, r.Key())
+	case r.Type == "updated":
+		s.Resources[r.Key()] = r
+	}
+}
+
+// Checkpoint returns a record holding the whole state.
+func (s *State) Checkpoint(t time.Time) (*Record, error) {
+	details := checkpointDetails{Hosts: make([]string, 0, len(s.Hosts)), Resources: s.Records()}
+	for host := range s.Hosts {
+		details.Hosts = append(details.Hosts, host)
+	}
+	sort.Strings(details.Hosts)
+	data, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{TargetType: checkpointTargetType, Type: checkpointTargetType, Time: t, Details: data}, nil
+}
+
+// restore replaces the resources with the ones of a checkpoint.
+func (s *State) restore(r *Record) {
+	var details checkpointDetails
+	if err := json.Unmarshal(r.Details, &details); err != nil {
+		Log.Warn("skipping invalid checkpoint", "time", r.Time, "error", err)
+		return
+	}
+	s.Hosts = make(map[string]bool, len(details.Hosts))
+	for _, host := range details.Hosts {
+		s.Hosts[host] = true
+	}
+	s.Resources = make(map[Key]*Record, len(details.Resources))
+	for _, record := range details.Resources {
+		s.Resources[record.Key()] = record
+	}
+}
+
+// Records lists the resources, sorted by host, type and ID.
+func (s *State) Records() []*Record {
+	records := make([]*Record, 0, len(s.Resources))
+	for _, record := range s.Resources {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.TargetType != b.TargetType {
+			return a.TargetType < b.TargetType
+		}
+		return a.TargetID < b.TargetID
+	})
+	return records
+}
+
+// Graph decodes the resources, in the same layout as the snapshots of the live graph.
+func (s *State) Graph() (g graph.Graph, err error) {
+	g.Hosts = make([]string, 0, len(s.Hosts))
+	for host := range s.Hosts {
+		g.Hosts = append(g.Hosts, host)
+	}
+	sort.Strings(g.Hosts)
+
+	byType := make(map[string][]*Record)
+	for _, record := range s.Records() {
+		byType[record.TargetType] = append(byType[record.TargetType], record)
+	}
+	if g.Containers, err = decodeAll[containers.Container](byType["container"]); err != nil {
+		return
+	}
+	// The repositories list the containers by name
+	sort.SliceStable(g.Containers, func(i, j int) bool {
+		a, b := g.Containers[i], g.Containers[j]
+		return a.Host < b.Host || (a.Host == b.Host && a.Name < b.Name)
+	})
+	if g.Networks, err = decodeAll[networks.Network](byType["network"]); err != nil {
+		return
+	}
+	if g.Volumes, err = decodeAll[volumes.Volume](byType["volume"]); err != nil {
+		return
+	}
+	if g.Images, err = decodeAll[images.Image](byType["image"]); err != nil {
+		return
+	}
+	if g.Nodes, err = decodeAll[swarm.Node](byType[string(swarm.NodeKind)]); err != nil {
+		return
+	}
+	if g.Services, err = decodeAll[swarm.Service](byType[string(swarm.ServiceKind)]); err != nil {
+		return
+	}
+	if g.Tasks, err = decodeAll[swarm.Task](byType[string(swarm.TaskKind)]); err != nil {
+		return
+	}
+	if g.Configs, err = decodeAll[swarm.Config](byType[string(swarm.ConfigKind)]); err != nil {
+		return
+	}
+	g.Secrets, err = decodeAll[swarm.Secret](byType[string(swarm.SecretKind)])
+	return
+}
+
+func decodeAll[T any](records []*Record) ([]T, error) {
+	values := make([]T, len(records))
+	for i, record := range records {
+		if err := json.Unmarshal(record.Details, &values[i]); err != nil {
+			return nil, fmt.Errorf("%s %s on %s: %w", record.TargetType, record.TargetID, record.Host, err)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,520 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+	log "github.com/inconshreveable/log15"
+	"github.com/thejerf/suture/v4"
+)
+
+type (
+	// Store appends the dispatched events to a file, one JSON document per line, so the past states of the graph
+	// can be rebuilt. The whole state is written again from time to time, as a checkpoint, so the file does not
+	// have to be read from the start. The events wait in memory while the file is busy, so the dispatch does not
+	// wait for the disk.
+	Store struct {
+		Path string
+		// Retention is how long the records are kept ; the older ones are dropped once a checkpoint has been
+		// written after them. Zero keeps all the records.
+		Retention time.Duration
+		// CheckpointSize is the size of the records written between two checkpoints.
+		CheckpointSize int64
+
+		events Subscriber
+		// pending holds, for each host that has not been synced since the start, the resources recorded
+		// by the previous runs that have not been seen again.
+		pending map[string]map[Key]bool
+
+		// These are only used by the goroutine of Serve
+		file          *os.File
+		size          int64
+		checkpointEnd int64
+		current       *State
+		lastTime      time.Time
+
+		// checkpoints are looked for on the first read, and they are updated by Serve
+		checkpoints []checkpoint
+		indexed     bool
+		mu          sync.RWMutex
+	}
+
+	Subscriber interface {
+		SubscribeWithoutHooks() (c <-chan api.Event, cancel func())
+	}
+
+	// checkpoint locates a checkpoint record in the file.
+	checkpoint struct {
+		Time   time.Time
+		Offset int64
+	}
+)
+
+var (
+	_ suture.Service = (*Store)(nil)
+	_ fmt.GoStringer = (*Store)(nil)
+
+	Log = log.New()
+
+	// MaxRecordSize is the maximum size of a line of the file.
+	MaxRecordSize = 64 * 1024 * 1024
+
+	DefaultRetention      = 30 * 24 * time.Hour
+	DefaultCheckpointSize = int64(4 * 1024 * 1024)
+
+	// checkpointPrefix starts the lines of the checkpoint records, as the fields are encoded in order.
+	checkpointPrefix = []byte(`{"TargetType":"` + checkpointTargetType + `"`)
+)
+
+func NewStore(path string, events Subscriber) *Store {
+	return &Store{Path: path, Retention: DefaultRetention, CheckpointSize: DefaultCheckpointSize, events: events}
+}
+
+func (s *Store) GoString() string {
+	return fmt.Sprintf("history.Store(%s)", s.Path)
+}
+
+func (s *Store) Serve(ctx context.Context) (err error) {
+	events, cancel := s.events.SubscribeWithoutHooks()
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	queue := enqueue(ctx, events, done)
+
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	if s.file, err = os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+		return err
+	}
+	defer func() {
+		_ = s.file.Close()
+		s.file = nil
+	}()
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	s.size = info.Size()
+
+	// The resources that were removed while the server was stopped do not cause any event ;
+	// they are removed once their host has been synced, if they have not been seen by then.
+	if s.pending == nil {
+		s.pending = make(map[string]map[Key]bool, len(s.current.Hosts))
+		for key := range s.current.Resources {
+			if s.pending[key.Host] == nil {
+				s.pending[key.Host] = make(map[Key]bool)
+			}
+			s.pending[key.Host][key] = true
+		}
+	}
+
+	if err := s.compact(time.Now()); err != nil {
+		return err
+	}
+
+	for event := range queue {
+		if err := s.handle(event); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// enqueue forwards the events to the returned channel, and keeps them while the store is busy, e.g. while the file
+// is read or compacted, so their dispatch does not wait for it. When the context is done, it stops receiving events,
+// then forwards the kept ones, so they are written anyway, and closes the channel ; it stops when done is closed.
+func enqueue(ctx context.Context, events <-chan api.Event, done <-chan struct{}) <-chan api.Event {
+	out := make(chan api.Event)
+	go func() {
+		defer close(out)
+		var queue []api.Event
+		for {
+			var next api.Event
+			var outC chan<- api.Event
+			if len(queue) > 0 {
+				next, outC = queue[0], out
+			}
+			select {
+			case event := <-events:
+				queue = append(queue, event)
+			case outC <- next:
+				queue[0] = nil
+				queue = queue[1:]
+			case <-ctx.Done():
+				for _, event := range queue {
+					select {
+					case out <- event:
+					case <-done:
+						return
+					}
+				}
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// load reads the current state, from the last checkpoint of the file.
+func (s *Store) load() error {
+	checkpoints, err := s.index()
+	if err != nil {
+		return err
+	}
+	var offset int64
+	if len(checkpoints) > 0 {
+		offset = checkpoints[len(checkpoints)-1].Offset
+	}
+
+	s.current = NewState(time.Now())
+	s.checkpointEnd = 0
+	file, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.scanRecords(file, offset, func(record *Record, end int64) error {
+		s.current.Apply(record)
+		if record.Time.After(s.lastTime) {
+			s.lastTime = record.Time
+		}
+		if record.TargetType == checkpointTargetType {
+			s.checkpointEnd = end
+		}
+		return nil
+	})
+}
+
+func (s *Store) handle(event api.Event) error {
+	dto, ok := event.Data().(api.EventDTO)
+	if !ok {
+		return nil
+	}
+	if err := s.write(dto); err != nil {
+		return err
+	}
+	if err := s.reconcile(dto); err != nil {
+		return err
+	}
+	if s.size-s.checkpointEnd < s.CheckpointSize {
+		return nil
+	}
+	if err := s.writeCheckpoint(); err != nil {
+		return err
+	}
+	return s.compact(time.Now())
+}
+
+// write appends an event to the file, and applies it to the current state.
+func (s *Store) write(dto api.EventDTO) error {
+	line, err := json.Marshal(dto)
+	if err != nil {
+		Log.Error("could not encode event", "event", dto, "error", err)
+		return nil
+	}
+	var record Record
+	if err := json.Unmarshal(line, &record); err != nil {
+		Log.Error("could not decode event", "event", dto, "error", err)
+		return nil
+	}
+	if err := s.writeLine(line); err != nil {
+		return err
+	}
+	s.current.Apply(&record)
+	if record.Time.After(s.lastTime) {
+		s.lastTime = record.Time
+	}
+	return nil
+}
+
+func (s *Store) writeLine(line []byte) error {
+	n, err := s.file.Write(append(line, '\n'))
+	s.size += int64(n)
+	return err
+}
+
+// writeCheckpoint appends the current state to the file. Its time is the one of the most recent record,
+// so all the records before it are at or before that time.
+func (s *Store) writeCheckpoint() error {
+	record, err := s.current.Checkpoint(s.lastTime)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	offset := s.size
+	if err := s.writeLine(line); err != nil {
+		return err
+	}
+	s.checkpointEnd = s.size
+	Log.Debug("wrote checkpoint", "path", s.Path, "time", record.Time, "#resources", len(s.current.Resources))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints = append(s.checkpoints, checkpoint{record.Time, offset})
+	return nil
+}
+
+// compact drops the records that are older than the retention ; the file then starts with the last checkpoint
+// before the limit, which is the oldest state that can be rebuilt.
+func (s *Store) compact(now time.Time) error {
+	if s.Retention <= 0 {
+		return nil
+	}
+	limit := now.Add(-s.Retention)
+	cut := -1
+	for i, c := range s.checkpoints {
+		if !c.Time.After(limit) {
+			cut = i
+		}
+	}
+	if cut < 0 || s.checkpoints[cut].Offset == 0 {
+		return nil
+	}
+	offset := s.checkpoints[cut].Offset
+	Log.Info("dropping the records older than the retention", "path", s.Path, "before", s.checkpoints[cut].Time, "bytes", offset)
+
+	// Only this goroutine writes to the file, so it can be copied without the lock
+	tmpPath := s.Path + ".tmp"
+	if err := copyFrom(s.Path, tmpPath, offset); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	// The readers open the file and pick the offsets of the checkpoints while holding the lock
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Rename(tmpPath, s.Path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	checkpoints := make([]checkpoint, 0, len(s.checkpoints)-cut)
+	for _, c := range s.checkpoints[cut:] {
+		checkpoints = append(checkpoints, checkpoint{c.Time, c.Offset - offset})
+	}
+	s.checkpoints = checkpoints
+	s.size -= offset
+	s.checkpointEnd -= offset
+
+	_ = s.file.Close()
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	return nil
+}
+
+// copyFrom copies the content of a file from the given offset.
+func copyFrom(srcPath, dstPath string, offset int64) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// reconcile tracks the resources seen since the start, and removes the other ones when their host is synced.
+func (s *Store) reconcile(dto api.EventDTO) error {
+	pending, found := s.pending[dto.Host]
+	if !found {
+		return nil
+	}
+	if dto.TargetType != streamTargetType {
+		delete(pending, Key{dto.TargetType, dto.Host, dto.TargetID})
+		return nil
+	}
+	if dto.Type != "synced" {
+		return nil
+	}
+	delete(s.pending, dto.Host)
+	Log.Debug("removing the resources that disappeared while stopped", "host", dto.Host, "#resources", len(pending))
+	for key := range pending {
+		removed := api.EventDTO{TargetType: key.TargetType, Host: key.Host, TargetID: key.TargetID, Type: "removed", Time: dto.Time}
+		if err := s.write(removed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// index returns the checkpoints of the file, which are looked for on the first call.
+func (s *Store) index() ([]checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexed {
+		return s.checkpoints, nil
+	}
+
+	file, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		s.indexed = true
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var checkpoints []checkpoint
+	err = scanLines(file, 0, func(line []byte, start, _ int64) error {
+		// Only the checkpoints are decoded
+		if !bytes.HasPrefix(line, checkpointPrefix) {
+			return nil
+		}
+		var header struct{ Time time.Time }
+		if err := json.Unmarshal(line, &header); err != nil {
+			Log.Warn("skipping invalid checkpoint", "path", s.Path, "offset", start, "error", err)
+			return nil
+		}
+		checkpoints = append(checkpoints, checkpoint{header.Time, start})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.checkpoints, s.indexed = checkpoints, true
+	return checkpoints, nil
+}
+
+// openAt opens the file, and returns the offset of the last checkpoint at or before the given time.
+// When the older records have been dropped, the file starts with the oldest checkpoint, which is used for
+// the earlier times.
+func (s *Store) openAt(at time.Time) (*os.File, int64, error) {
+	if _, err := s.index(); err != nil {
+		return nil, 0, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var offset int64
+	for i, c := range s.checkpoints {
+		if c.Time.After(at) && (i > 0 || c.Offset > 0) {
+			break
+		}
+		offset = c.Offset
+	}
+	file, err := os.Open(s.Path)
+	return file, offset, err
+}
+
+// Scan reads all the records, including the checkpoints, in the order they have been written.
+func (s *Store) Scan(fn func(*Record) error) error {
+	file, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.scanRecords(file, 0, func(record *Record, _ int64) error { return fn(record) })
+}
+
+// scanRecords reads the records from the given offset ; fn receives the offset of the end of each record.
+func (s *Store) scanRecords(file *os.File, offset int64, fn func(record *Record, end int64) error) error {
+	return scanLines(file, offset, func(line []byte, start, end int64) error {
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			// The last line can be incomplete, while it is being written
+			Log.Warn("skipping invalid record", "path", s.Path, "offset", start, "error", err)
+			return nil
+		}
+		return fn(&record, end)
+	})
+}
+
+// scanLines reads the lines of a file from the given offset, with their start and end offsets.
+func scanLines(file *os.File, offset int64, fn func(line []byte, start, end int64) error) error {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxRecordSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		start := offset
+		offset += int64(len(line)) + 1
+		if err := fn(line, start, offset); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// StateAt rebuilds the state of the hosts at the given time.
+func (s *Store) StateAt(at time.Time) (*State, error) {
+	state, _, err := s.Replay(at, at)
+	return state, err
+}
+
+// Replay returns the state at the first time, and the records of the events that happened until the second one.
+// The file is read from the last checkpoint before the first time.
+func (s *Store) Replay(from, to time.Time) (*State, []*Record, error) {
+	state := NewState(from)
+	file, offset, err := s.openAt(from)
+	if os.IsNotExist(err) {
+		return state, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var records []*Record
+	first := true
+	err = s.scanRecords(file, offset, func(record *Record, _ int64) error {
+		switch {
+		case record.TargetType == checkpointTargetType:
+			// The next checkpoints only repeat the records
+			if first {
+				state.Apply(record)
+			}
+		case !record.Time.After(from):
+			state.Apply(record)
+		case !record.Time.After(to):
+			records = append(records, record)
+		}
+		first = false
+		return nil
+	})
+	return state, records, err
+}
+
+// GraphAt rebuilds the graph of the hosts at the given time.
+func (s *Store) GraphAt(at time.Time) (graph.Graph, error) {
+	state, err := s.StateAt(at)
+	if err != nil {
+		return graph.Graph{}, err
+	}
+	return state.Graph()
+}
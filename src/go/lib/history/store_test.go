@@ -0,0 +1,281 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+)
+
+type (
+	fakeSubscriber chan api.Event
+)
+
+var (
+	baseTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func (s fakeSubscriber) SubscribeWithoutHooks() (<-chan api.Event, func()) {
+	return s, func() {}
+}
+
+// testRecords updates 5 containers in turn, with a new image each time, and removes one of them from time to time.
+func testRecords(n int) []*Record {
+	records := make([]*Record, n)
+	for i := range records {
+		name := fmt.Sprintf("c%d", i%5)
+		record := &Record{TargetType: "container", Host: "h", TargetID: name, Type: "updated", Time: baseTime.Add(time.Duration(i) * time.Minute)}
+		if i%7 == 6 {
+			record.Type = "removed"
+		} else {
+			record.Details = []byte(fmt.Sprintf(`{"ID":%q,"Host":"h","Name":%q,"Image":"image:%d"}`, name, name, i))
+		}
+		records[i] = record
+	}
+	return records
+}
+
+// record writes the records with a store, and returns it once it has stopped.
+func record(t *testing.T, store *Store, records []*Record) {
+	t.Helper()
+	events := make(fakeSubscriber)
+	store.events = events
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- store.Serve(ctx) }()
+	for _, record := range records {
+		events <- record
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// stateAt applies the records until the given time, the slow way.
+func stateAt(records []*Record, at time.Time) *State {
+	state := NewState(at)
+	for _, record := range records {
+		if !record.Time.After(at) {
+			state.Apply(record)
+		}
+	}
+	return state
+}
+
+func assertSameState(t *testing.T, got, want *State) {
+	t.Helper()
+	if !reflect.DeepEqual(got.Hosts, want.Hosts) {
+		t.Errorf("unexpected hosts: %v, want %v", got.Hosts, want.Hosts)
+	}
+	gotRecords, wantRecords := got.Records(), want.Records()
+	if len(gotRecords) != len(wantRecords) {
+		t.Fatalf("got %d resources, want %d", len(gotRecords), len(wantRecords))
+	}
+	for i := range gotRecords {
+		if gotRecords[i].Key() != wantRecords[i].Key() || !bytes.Equal(gotRecords[i].Details, wantRecords[i].Details) {
+			t.Errorf("resource #%d: got %s, want %s", i, gotRecords[i].Details, wantRecords[i].Details)
+		}
+	}
+}
+
+func TestStoreCheckpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	records := testRecords(100)
+
+	store := NewStore(path, nil)
+	store.Retention = 0
+	store.CheckpointSize = 1000
+	// The store is restarted, so the state is loaded from the last checkpoint
+	record(t, store, records[:50])
+	record(t, store, records[50:])
+
+	if len(store.checkpoints) < 5 {
+		t.Fatalf("expected several checkpoints, got %d", len(store.checkpoints))
+	}
+
+	// A new store finds the checkpoints in the file
+	reader := NewStore(path, nil)
+	checkpoints, err := reader.index()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(checkpoints, store.checkpoints) {
+		t.Errorf("unexpected checkpoints: %v, want %v", checkpoints, store.checkpoints)
+	}
+
+	for _, minutes := range []int{-1, 0, 10, 33, 50, 77, 99, 200} {
+		at := baseTime.Add(time.Duration(minutes) * time.Minute)
+		t.Run(fmt.Sprintf("at %d minutes", minutes), func(t *testing.T) {
+			state, err := reader.StateAt(at)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			assertSameState(t, state, stateAt(records, at))
+		})
+	}
+
+	// The checkpoints are not replayed as events
+	from, to := baseTime.Add(20*time.Minute), baseTime.Add(60*time.Minute)
+	state, replayed, err := reader.Replay(from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertSameState(t, state, stateAt(records, from))
+	if len(replayed) != 40 || !replayed[0].Time.Equal(from.Add(time.Minute)) || !replayed[39].Time.Equal(to) {
+		t.Errorf("unexpected replayed records: %d", len(replayed))
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	records := testRecords(100)
+
+	store := NewStore(path, nil)
+	store.Retention = 0
+	store.CheckpointSize = 1000
+	record(t, store, records[:50])
+	before, _ := os.Stat(path)
+
+	// All the records are older than the retention
+	store.Retention = time.Hour
+	record(t, store, records[50:])
+	after, _ := os.Stat(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.HasPrefix(data, checkpointPrefix) {
+		t.Errorf("the file should start with a checkpoint")
+	}
+	if after.Size() >= before.Size() {
+		t.Errorf("the file should have been compacted: %d bytes, then %d bytes", before.Size(), after.Size())
+	}
+	if len(store.checkpoints) != 1 || store.checkpoints[0].Offset != 0 {
+		t.Errorf("only the first checkpoint should be left: %v", store.checkpoints)
+	}
+
+	reader := NewStore(path, nil)
+	last := records[len(records)-1].Time
+	state, err := reader.StateAt(last)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertSameState(t, state, stateAt(records, last))
+
+	// The earlier times get the oldest state that is kept
+	oldest := store.checkpoints[0].Time
+	state, err = reader.StateAt(baseTime)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertSameState(t, state, stateAt(records, oldest))
+}
+
+func TestStoreDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	records := testRecords(20)
+	store := NewStore(path, nil)
+	store.Retention = 0
+	store.CheckpointSize = 1000
+	record(t, store, records)
+
+	// c3 and c4 have been added, c1 removed, and c0 updated
+	diff, err := NewStore(path, nil).Diff(baseTime.Add(2*time.Minute), baseTime.Add(6*time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	names := func(list []containers.Container) (names []string) {
+		for _, ctn := range list {
+			names = append(names, ctn.Name)
+		}
+		return
+	}
+	if added := names(diff.Added); !reflect.DeepEqual(added, []string{"c3", "c4"}) {
+		t.Errorf("unexpected added containers: %v", added)
+	}
+	if removed := names(diff.Removed); !reflect.DeepEqual(removed, []string{"c1"}) {
+		t.Errorf("unexpected removed containers: %v", removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Name != "c0" {
+		t.Errorf("unexpected changed containers: %v", diff.Changed)
+	}
+}
+
+func TestStoreRemovesTheResourcesNotSeenAgain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	records := testRecords(5)
+	record(t, NewStore(path, nil), records)
+
+	// After a restart, only c0 is seen before the host is synced
+	synced := &Record{TargetType: streamTargetType, Host: "h", Type: "synced", Time: baseTime.Add(time.Hour)}
+	record(t, NewStore(path, nil), []*Record{records[0], synced})
+
+	state, err := NewStore(path, nil).StateAt(synced.Time)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(state.Resources) != 1 || state.Resources[records[0].Key()] == nil {
+		t.Errorf("unexpected resources: %v", state.Records())
+	}
+}
+
+func TestStoreDoesNotBlockTheDispatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	records := testRecords(100)
+	store := NewStore(path, nil)
+	store.Retention = 0
+	// Each event is followed by a checkpoint, which cannot be written while the lock is held
+	store.CheckpointSize = 1
+	events := make(fakeSubscriber)
+	store.events = events
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- store.Serve(ctx) }()
+	// The file is created once the store has loaded it
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("the store has not created the file")
+		}
+	}
+
+	store.mu.Lock()
+	for i, record := range records {
+		select {
+		case events <- record:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the dispatch of event #%d is blocked", i)
+		}
+	}
+	store.mu.Unlock()
+
+	// The queued events are written before the store stops
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var written int
+	err := NewStore(path, nil).Scan(func(record *Record) error {
+		if record.TargetType != checkpointTargetType {
+			written++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if written != len(records) {
+		t.Errorf("got %d records, want %d", written, len(records))
+	}
+}
@@ -16,6 +16,8 @@ type (
 		Color       ColorFlag
 		StderrLevel Level
 		Filename    string
+		// Quiet disables the stderr logs, e.g. when the terminal is used by the user interface.
+		Quiet bool
 	}
 
 	Level log.Lvl
@@ -69,6 +71,9 @@ func (c *Config) createHandler() (log.Handler, error) {
 }
 
 func (c *Config) createStderrHandler() log.Handler {
+	if c.Quiet {
+		return log.DiscardHandler()
+	}
 	stdErrFormat := log.LogfmtFormat()
 	if c.Color == ColorAlways || (c.Color == ColorAuto && isatty.IsTerminal(os.Stderr.Fd())) {
 		stdErrFormat = log.TerminalFormat()
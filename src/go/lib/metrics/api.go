@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"bytes"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type (
+	API struct {
+		registry *Registry
+	}
+)
+
+func NewAPI(registry *Registry) *API {
+	return &API{registry}
+}
+
+func (a *API) MountInto(mnt fiber.Router) {
+	mnt.Get("/metrics", a.getMetrics)
+}
+
+func (a *API) getMetrics(ctx *fiber.Ctx) error {
+	var buf bytes.Buffer
+	if err := a.registry.Write(&buf); err != nil {
+		return err
+	}
+	ctx.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return ctx.Send(buf.Bytes())
+}
@@ -0,0 +1,23 @@
+package metrics
+
+var (
+	// Default is the registry exposed by the API.
+	Default = &Registry{}
+
+	// EventStreams is the number of clients of the live event streams.
+	EventStreams = NewGauge("docker_graph_event_streams", "Number of clients of the event streams")
+
+	// DispatchDuration is the time taken by the dispatchers to deliver an event to all their subscribers, by dispatcher.
+	DispatchDuration = NewHistogramVec("docker_graph_dispatch_duration_seconds", "Time taken to deliver an event to all the subscribers", DurationBuckets, "dispatcher")
+
+	// DroppedValues counts the values that the lossy dispatchers did not deliver to lagging subscribers, by dispatcher.
+	DroppedValues = NewCounterVec("docker_graph_dropped_values_total", "Number of values dropped for lagging subscribers", "dispatcher")
+
+	// InspectErrors counts the failed inspections of the Docker resources, by host and type of resource ;
+	// the resources that are not found are not counted.
+	InspectErrors = NewCounterVec("docker_graph_inspect_errors_total", "Number of failed inspections of Docker resources", "host", "type")
+)
+
+func init() {
+	Default.Register(EventStreams, DispatchDuration, DroppedValues, InspectErrors)
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// Registry gathers the collectors exposed to Prometheus.
+	Registry struct {
+		collectors []Collector
+		mu         sync.Mutex
+	}
+
+	// Collector provides metric families when they are scraped.
+	Collector interface {
+		Collect() []Family
+	}
+
+	// CollectorFunc is a function used as a Collector.
+	CollectorFunc func() []Family
+
+	// Family is a metric with its samples.
+	Family struct {
+		Name string
+		Help string
+		// Type is "counter", "gauge" or "histogram".
+		Type    string
+		Samples []Sample
+	}
+
+	// Sample is a value of a family ; Suffix is appended to the name of the family, e.g. "_bucket".
+	Sample struct {
+		Suffix string
+		Labels Labels
+		Value  float64
+	}
+
+	// Labels are the names and values of the labels of a sample.
+	Labels map[string]string
+)
+
+var (
+	_ Collector = CollectorFunc(nil)
+
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// Gather collects the families of all the collectors, sorted by name.
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	collectors := r.collectors
+	r.mu.Unlock()
+	var families []Family
+	for _, collector := range collectors {
+		families = append(families, collector.Collect()...)
+	}
+	sort.SliceStable(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// Write writes the families with the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	for _, family := range r.Gather() {
+		fmt.Fprintf(buf, "# HELP %s %s\n", family.Name, helpEscaper.Replace(family.Help))
+		fmt.Fprintf(buf, "# TYPE %s %s\n", family.Name, family.Type)
+		for _, sample := range family.Samples {
+			buf.WriteString(family.Name)
+			buf.WriteString(sample.Suffix)
+			sample.Labels.writeTo(buf)
+			buf.WriteByte(' ')
+			buf.WriteString(formatValue(sample.Value))
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Flush()
+}
+
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
+
+// with returns a copy of the labels with another one.
+func (l Labels) with(name, value string) Labels {
+	labels := make(Labels, len(l)+1)
+	for k, v := range l {
+		labels[k] = v
+	}
+	labels[name] = value
+	return labels
+}
+
+func (l Labels) writeTo(buf *bufio.Writer) {
+	if len(l) == 0 {
+		return
+	}
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, `%s="%s"`, name, labelEscaper.Replace(l[name]))
+	}
+	buf.WriteByte('}')
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestRegistryWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		collectors func() []Collector
+	}{
+		{
+			name: "counter_vec",
+			collectors: func() []Collector {
+				c := NewCounterVec("test_errors_total", "Number of errors", "host", "type")
+				c.Inc("b", "image")
+				c.Inc("a", "container")
+				c.Inc("a", "container")
+				c.Inc(`quote"back\slash`+"\nnewline", "volume")
+				return []Collector{c}
+			},
+		},
+		{
+			name: "gauge",
+			collectors: func() []Collector {
+				g := NewGauge("test_clients", "Number of clients")
+				g.Inc()
+				g.Inc()
+				g.Dec()
+				return []Collector{g}
+			},
+		},
+		{
+			name: "histogram",
+			collectors: func() []Collector {
+				h := NewHistogram("test_duration_seconds", "Duration", []float64{0.1, 1})
+				h.Observe(0.05)
+				h.Observe(0.5)
+				h.Observe(2)
+				return []Collector{h}
+			},
+		},
+		{
+			name: "histogram_vec",
+			collectors: func() []Collector {
+				v := NewHistogramVec("test_duration_seconds", "Duration", []float64{0.1, 1}, "dispatcher")
+				v.With("stats").Observe(0.5)
+				v.With("events").Observe(0.05)
+				v.With("events").Observe(0.25)
+				return []Collector{v}
+			},
+		},
+		{
+			name: "families",
+			collectors: func() []Collector {
+				return []Collector{
+					NewGauge("test_z", "Last family"),
+					CollectorFunc(func() []Family {
+						return []Family{{Name: "test_a", Help: `Help with a back\slash` + "\nand a newline", Type: "gauge", Samples: []Sample{{Value: 1.5}}}}
+					}),
+					NewCounterVec("test_m_total", "Empty counter", "host"),
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := &Registry{}
+			registry.Register(tt.collectors()...)
+			var buf bytes.Buffer
+			if err := registry.Write(&buf); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			path := filepath.Join("testdata", tt.name+".prom")
+			if *update {
+				if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("unexpected output:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
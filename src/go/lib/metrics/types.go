@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// CounterVec counts events by the values of its labels.
+	CounterVec struct {
+		name       string
+		help       string
+		labelNames []string
+		values     map[string]float64
+		mu         sync.Mutex
+	}
+
+	// Gauge is a value that can go up and down.
+	Gauge struct {
+		name  string
+		help  string
+		value int64
+	}
+
+	// Histogram counts observations, like durations, in cumulative buckets.
+	Histogram struct {
+		name    string
+		help    string
+		buckets []float64
+		counts  []uint64
+		count   uint64
+		sum     float64
+		mu      sync.Mutex
+	}
+
+	// HistogramVec holds histograms by the values of their labels.
+	HistogramVec struct {
+		name       string
+		help       string
+		labelNames []string
+		buckets    []float64
+		histograms map[string]*Histogram
+		mu         sync.Mutex
+	}
+)
+
+var (
+	_ Collector = (*CounterVec)(nil)
+	_ Collector = (*Gauge)(nil)
+	_ Collector = (*Histogram)(nil)
+	_ Collector = (*HistogramVec)(nil)
+
+	// DurationBuckets are the upper bounds of the buckets of durations, in seconds, from 100µs to 10s.
+	DurationBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5, 10}
+)
+
+const (
+	labelSeparator = "\xff"
+)
+
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labelNames: labelNames, values: make(map[string]float64)}
+}
+
+// Inc increments the counter of the label values, given in the order of the label names.
+func (c *CounterVec) Inc(labelValues ...string) {
+	key := strings.Join(labelValues, labelSeparator)
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) Collect() []Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	family := Family{Name: c.name, Help: c.help, Type: "counter"}
+	for _, key := range keys {
+		family.Samples = append(family.Samples, Sample{Labels: labelsOf(c.labelNames, key), Value: c.values[key]})
+	}
+	return []Family{family}
+}
+
+func NewGauge(name, help string) *Gauge {
+	return &Gauge{name: name, help: help}
+}
+
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.value, 1)
+}
+
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.value, -1)
+}
+
+func (g *Gauge) Collect() []Family {
+	return []Family{{Name: g.name, Help: g.help, Type: "gauge", Samples: []Sample{{Value: float64(atomic.LoadInt64(&g.value))}}}}
+}
+
+// NewHistogram creates a histogram with the upper bounds of its buckets, in increasing order.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	h.sum += value
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+// ObserveSince observes the time elapsed since start, in seconds.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) Collect() []Family {
+	return []Family{{Name: h.name, Help: h.help, Type: "histogram", Samples: h.samples(nil)}}
+}
+
+// samples returns the buckets, the sum and the count, with the given labels.
+func (h *Histogram) samples(labels Labels) []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	samples := make([]Sample, 0, len(h.buckets)+3)
+	for i, bound := range h.buckets {
+		samples = append(samples, Sample{"_bucket", labels.with("le", formatValue(bound)), float64(h.counts[i])})
+	}
+	return append(samples,
+		Sample{"_bucket", labels.with("le", formatValue(math.Inf(1))), float64(h.count)},
+		Sample{"_sum", labels, h.sum},
+		Sample{"_count", labels, float64(h.count)},
+	)
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{name: name, help: help, labelNames: labelNames, buckets: buckets, histograms: make(map[string]*Histogram)}
+}
+
+// With returns the histogram of the label values, given in the order of the label names.
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	key := strings.Join(labelValues, labelSeparator)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, found := v.histograms[key]
+	if !found {
+		h = NewHistogram(v.name, v.help, v.buckets)
+		v.histograms[key] = h
+	}
+	return h
+}
+
+func (v *HistogramVec) Collect() []Family {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.histograms))
+	for key := range v.histograms {
+		keys = append(keys, key)
+	}
+	histograms := make(map[string]*Histogram, len(v.histograms))
+	for key, h := range v.histograms {
+		histograms[key] = h
+	}
+	v.mu.Unlock()
+	sort.Strings(keys)
+
+	family := Family{Name: v.name, Help: v.help, Type: "histogram"}
+	for _, key := range keys {
+		family.Samples = append(family.Samples, histograms[key].samples(labelsOf(v.labelNames, key))...)
+	}
+	return []Family{family}
+}
+
+// labelsOf rebuilds the labels from the joined label values.
+func labelsOf(names []string, key string) Labels {
+	labels := make(Labels, len(names))
+	for i, value := range strings.SplitN(key, labelSeparator, len(names)) {
+		labels[names[i]] = value
+	}
+	return labels
+}
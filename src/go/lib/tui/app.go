@@ -0,0 +1,420 @@
+package tui
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/api"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/connections"
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/export"
+	"github.com/adirelle/docker-graph/src/go/lib/graph"
+)
+
+type (
+	// EventSource provides the current state of the hosts, then the changes.
+	EventSource interface {
+		Subscribe() (<-chan api.Event, func())
+	}
+
+	// StatusSource provides the state of the connections to the hosts.
+	StatusSource interface {
+		Status() graph.Status
+	}
+
+	// App displays the containers of the Docker hosts in the terminal, as a tree updated by the events.
+	App struct {
+		Events EventSource
+		Status StatusSource
+		// RefreshInterval is the minimum delay between two redraws caused by events.
+		RefreshInterval time.Duration
+
+		containers map[containerKey]containers.Container
+		hosts      graph.Status
+		filter     string
+		editing    bool
+		showDetail bool
+		selected   int
+		offset     int
+		lines      []Line
+		width      int
+		height     int
+	}
+
+	containerKey struct {
+		host string
+		id   containers.ID
+	}
+
+	// segment is a piece of text with its SGR parameters.
+	segment struct {
+		style string
+		text  string
+	}
+)
+
+var (
+	DefaultRefreshInterval = 200 * time.Millisecond
+
+	stateStyles = map[export.State]string{
+		export.StateRunning:   "32",
+		export.StateStarting:  "33",
+		export.StateUnhealthy: "31",
+		export.StateStopped:   "90",
+	}
+)
+
+const (
+	prefixStyle  = "90"
+	hostStyle    = "1"
+	projectStyle = "1;36"
+	serviceStyle = "1"
+	errorStyle   = "1;31"
+	barStyle     = "7"
+
+	helpText = "↑↓ move  / filter  enter details  esc clear filter  q quit"
+)
+
+func NewApp(events EventSource, status StatusSource) *App {
+	return &App{
+		Events:          events,
+		Status:          status,
+		RefreshInterval: DefaultRefreshInterval,
+		containers:      make(map[containerKey]containers.Container),
+	}
+}
+
+// Run displays the tree until the user quits or the context is cancelled.
+func (a *App) Run(ctx context.Context) error {
+	t, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer t.close()
+
+	events, unsubscribe := a.Events.Subscribe()
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	defer close(done)
+	keys := make(chan Key)
+	go t.readKeys(keys, done)
+
+	ticker := time.NewTicker(a.RefreshInterval)
+	defer ticker.Stop()
+
+	a.width, a.height = t.size()
+	a.hosts = a.Status.Status()
+	dirty := true
+	for {
+		select {
+		case event := <-events:
+			dirty = a.apply(event) || dirty
+			continue
+		case key := <-keys:
+			if !a.handleKey(key) {
+				return nil
+			}
+			dirty = true
+		case <-ticker.C:
+			if width, height := t.size(); width != a.width || height != a.height {
+				a.width, a.height = width, height
+				dirty = true
+			}
+			if hosts := a.Status.Status(); !reflect.DeepEqual(hosts, a.hosts) {
+				a.hosts = hosts
+				dirty = true
+			}
+		case <-ctx.Done():
+			return nil
+		}
+		if dirty {
+			a.render(t.out)
+			if err := t.out.Flush(); err != nil {
+				return err
+			}
+			dirty = false
+		}
+	}
+}
+
+// apply updates the containers from an event ; it returns whether the event is relevant.
+func (a *App) apply(event api.Event) bool {
+	dto, ok := event.Data().(api.EventDTO)
+	if !ok || dto.TargetType != "container" {
+		return false
+	}
+	key := containerKey{dto.Host, containers.ID(dto.TargetID)}
+	switch dto.Type {
+	case "updated":
+		if ctn, ok := dto.Details.(*containers.Container); ok {
+			a.containers[key] = *ctn
+		}
+	case "removed":
+		delete(a.containers, key)
+	}
+	return true
+}
+
+// handleKey applies a key ; it returns false when the user quits.
+func (a *App) handleKey(key Key) bool {
+	if key.Code == InterruptKey {
+		return false
+	}
+
+	if a.editing {
+		switch key.Code {
+		case RuneKey:
+			a.filter += string(key.Rune)
+		case BackspaceKey:
+			if runes := []rune(a.filter); len(runes) > 0 {
+				a.filter = string(runes[:len(runes)-1])
+			}
+		case EnterKey:
+			a.editing = false
+		case EscapeKey:
+			a.filter = ""
+			a.editing = false
+		}
+		return true
+	}
+
+	page := a.bodyHeight() - 1
+	switch {
+	case key.Code == RuneKey && key.Rune == 'q':
+		return false
+	case key.Code == RuneKey && key.Rune == '/':
+		a.editing = true
+	case key.Code == EscapeKey:
+		a.filter = ""
+	case key.Code == EnterKey || key.Code == TabKey:
+		a.showDetail = !a.showDetail
+	case key.Code == UpKey || key.Code == RuneKey && key.Rune == 'k':
+		a.selected--
+	case key.Code == DownKey || key.Code == RuneKey && key.Rune == 'j':
+		a.selected++
+	case key.Code == PageUpKey:
+		a.selected -= page
+	case key.Code == PageDownKey:
+		a.selected += page
+	case key.Code == HomeKey || key.Code == RuneKey && key.Rune == 'g':
+		a.selected = 0
+	case key.Code == EndKey || key.Code == RuneKey && key.Rune == 'G':
+		a.selected = len(a.lines) - 1
+	}
+	return true
+}
+
+// match tells whether a container contains all the words of the filter.
+func (a *App) match(ctn *containers.Container) bool {
+	words := strings.Fields(strings.ToLower(a.filter))
+	if len(words) == 0 {
+		return true
+	}
+	fields := []string{ctn.Host, ctn.Name, ctn.Image, ctn.Service, string(ctn.Status), ctn.Healthy}
+	if ctn.Project != nil {
+		fields = append(fields, ctn.Project.Name)
+	}
+	text := strings.ToLower(strings.Join(fields, " "))
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *App) bodyHeight() int {
+	if a.height < 3 {
+		return 1
+	}
+	return a.height - 2
+}
+
+// updateLines rebuilds the tree, keeping the selection on the same entry if it is still displayed.
+func (a *App) updateLines() {
+	var previous *Line
+	if a.selected >= 0 && a.selected < len(a.lines) {
+		previous = &a.lines[a.selected]
+	}
+
+	hosts := make([]string, 0, len(a.hosts.Hosts))
+	for name := range a.hosts.Hosts {
+		hosts = append(hosts, name)
+	}
+	sort.Strings(hosts)
+	ctns := make([]containers.Container, 0, len(a.containers))
+	for _, ctn := range a.containers {
+		ctns = append(ctns, ctn)
+	}
+	a.lines = Flatten(BuildTree(hosts, ctns, a.match))
+
+	if previous != nil {
+		for i, line := range a.lines {
+			if sameNode(line.Node, previous.Node) {
+				a.selected = i
+				break
+			}
+		}
+	}
+	if a.selected >= len(a.lines) {
+		a.selected = len(a.lines) - 1
+	}
+	if a.selected < 0 {
+		a.selected = 0
+	}
+
+	height := a.bodyHeight()
+	if a.selected < a.offset {
+		a.offset = a.selected
+	} else if a.selected >= a.offset+height {
+		a.offset = a.selected - height + 1
+	}
+	if a.offset > len(a.lines)-height {
+		a.offset = len(a.lines) - height
+	}
+	if a.offset < 0 {
+		a.offset = 0
+	}
+}
+
+// sameNode tells whether two nodes show the same entry ; the labels of the containers change with their status.
+func sameNode(n, m *Node) bool {
+	if n.Kind != m.Kind || (n.Kind != ContainerNode && n.Label != m.Label) {
+		return false
+	}
+	if n.Container == nil || m.Container == nil {
+		return n.Container == m.Container
+	}
+	return n.Container.Host == m.Container.Host && n.Container.ID == m.Container.ID
+}
+
+func (a *App) render(w *bufio.Writer) {
+	a.updateLines()
+
+	treeWidth := a.width
+	var detail []string
+	if a.showDetail {
+		treeWidth = a.width / 2
+		detail = a.detailLines()
+	}
+
+	count := 0
+	for _, ctn := range a.containers {
+		if a.match(&ctn) {
+			count++
+		}
+	}
+	header := fmt.Sprintf(" docker-graph  %d/%d containers", count, len(a.containers))
+	if a.filter != "" {
+		header += "  filter: " + a.filter
+	}
+	moveTo(w, 1)
+	writeCell(w, a.width, segment{barStyle, header})
+
+	for row := 0; row < a.bodyHeight(); row++ {
+		moveTo(w, row+2)
+		index := a.offset + row
+		if index < len(a.lines) {
+			writeCell(w, treeWidth, a.lineSegments(a.lines[index], index == a.selected)...)
+		} else {
+			writeCell(w, treeWidth)
+		}
+		if a.showDetail {
+			text := ""
+			if row < len(detail) {
+				text = detail[row]
+			}
+			writeCell(w, a.width-treeWidth, segment{prefixStyle, "│"}, segment{"", text})
+		}
+	}
+
+	moveTo(w, a.height)
+	if a.editing {
+		writeCell(w, a.width, segment{"", "filter: " + a.filter}, segment{barStyle, " "})
+	} else {
+		writeCell(w, a.width, segment{prefixStyle, helpText})
+	}
+}
+
+func (a *App) lineSegments(line Line, selected bool) []segment {
+	label := segment{"", line.Node.Label}
+	var extra []segment
+	switch line.Node.Kind {
+	case HostNode:
+		label.style = hostStyle
+		if status, found := a.hosts.Hosts[line.Node.Label]; found {
+			extra = append(extra, hostState(status))
+		}
+	case ProjectNode:
+		label.style = projectStyle
+	case ServiceNode:
+		label.style = serviceStyle
+	case ContainerNode:
+		label.style = stateStyles[export.ContainerState(*line.Node.Container)]
+	}
+	segments := append([]segment{{prefixStyle, line.Prefix}, label}, extra...)
+	if selected {
+		for i := range segments {
+			segments[i].style += ";" + barStyle
+		}
+	}
+	return segments
+}
+
+func hostState(status connections.Status) segment {
+	if status.State == connections.StateConnected {
+		return segment{prefixStyle, " (" + string(status.State) + ")"}
+	}
+	text := " (" + string(status.State)
+	if status.LastError != "" {
+		text += ": " + status.LastError
+	}
+	return segment{errorStyle, text + ")"}
+}
+
+// detailLines returns the selected container as indented JSON.
+func (a *App) detailLines() []string {
+	if a.selected >= len(a.lines) || a.lines[a.selected].Node.Container == nil {
+		return []string{" Select a container to see its details."}
+	}
+	data, err := json.MarshalIndent(a.lines[a.selected].Node.Container, " ", "  ")
+	if err != nil {
+		return []string{" " + err.Error()}
+	}
+	return strings.Split(" "+string(data), "\n")
+}
+
+func moveTo(w *bufio.Writer, row int) {
+	fmt.Fprintf(w, "\x1b[%d;1H", row)
+}
+
+// writeCell writes the segments, truncated or padded to the given width.
+func writeCell(w *bufio.Writer, width int, segments ...segment) {
+	for _, seg := range segments {
+		if width <= 0 {
+			break
+		}
+		runes := []rune(seg.text)
+		if len(runes) > width {
+			runes = runes[:width]
+		}
+		width -= len(runes)
+		w.WriteString(resetStyle)
+		if seg.style != "" {
+			fmt.Fprintf(w, "\x1b[%sm", strings.TrimPrefix(seg.style, ";"))
+		}
+		w.WriteString(string(runes))
+	}
+	// Pad with the style of the last segment, so selected lines are highlighted on the whole width
+	if width > 0 {
+		w.WriteString(strings.Repeat(" ", width))
+	}
+	w.WriteString(resetStyle)
+}
@@ -0,0 +1,173 @@
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+type (
+	// terminal drives a terminal in raw mode with ANSI escape sequences.
+	terminal struct {
+		in    *os.File
+		out   *bufio.Writer
+		outFd int
+		state *term.State
+	}
+
+	KeyCode int
+
+	Key struct {
+		Code KeyCode
+		// Rune is the typed character, for RuneKey.
+		Rune rune
+	}
+)
+
+const (
+	RuneKey KeyCode = iota
+	UpKey
+	DownKey
+	PageUpKey
+	PageDownKey
+	HomeKey
+	EndKey
+	EnterKey
+	EscapeKey
+	BackspaceKey
+	TabKey
+	InterruptKey
+
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen    = "\x1b[H\x1b[2J"
+	resetStyle     = "\x1b[0m"
+)
+
+var (
+	ErrNotTerminal = errors.New("standard input and output must be terminals")
+
+	escapeSequences = map[string]KeyCode{
+		"\x1b[A":  UpKey,
+		"\x1bOA":  UpKey,
+		"\x1b[B":  DownKey,
+		"\x1bOB":  DownKey,
+		"\x1b[5~": PageUpKey,
+		"\x1b[6~": PageDownKey,
+		"\x1b[H":  HomeKey,
+		"\x1bOH":  HomeKey,
+		"\x1b[1~": HomeKey,
+		"\x1b[F":  EndKey,
+		"\x1bOF":  EndKey,
+		"\x1b[4~": EndKey,
+	}
+)
+
+// openTerminal switches the terminal to raw mode and to the alternate screen.
+func openTerminal() (*terminal, error) {
+	inFd, outFd := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(inFd) || !term.IsTerminal(outFd) {
+		return nil, ErrNotTerminal
+	}
+	state, err := term.MakeRaw(inFd)
+	if err != nil {
+		return nil, err
+	}
+	t := &terminal{in: os.Stdin, out: bufio.NewWriter(os.Stdout), outFd: outFd, state: state}
+	t.out.WriteString(enterAltScreen)
+	return t, t.out.Flush()
+}
+
+// close restores the terminal in its previous state.
+func (t *terminal) close() error {
+	t.out.WriteString(resetStyle + leaveAltScreen)
+	t.out.Flush()
+	return term.Restore(int(t.in.Fd()), t.state)
+}
+
+func (t *terminal) size() (width, height int) {
+	width, height, err := term.GetSize(t.outFd)
+	if err != nil {
+		return 80, 24
+	}
+	return
+}
+
+// readKeys sends the keys typed on the terminal until the input is closed.
+func (t *terminal) readKeys(keys chan<- Key, done <-chan struct{}) {
+	buf := make([]byte, 64)
+	for {
+		n, err := t.in.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range decodeKeys(buf[:n]) {
+			select {
+			case keys <- key:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// decodeKeys splits the input into keys ; unknown escape sequences are ignored.
+func decodeKeys(input []byte) (keys []Key) {
+	for len(input) > 0 {
+		switch b := input[0]; {
+		case b == 0x1b:
+			size := escapeSequenceSize(input)
+			if size == 1 {
+				keys = append(keys, Key{Code: EscapeKey})
+			} else if code, found := escapeSequences[string(input[:size])]; found {
+				keys = append(keys, Key{Code: code})
+			}
+			input = input[size:]
+			continue
+		case b == '\r' || b == '\n':
+			keys = append(keys, Key{Code: EnterKey})
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, Key{Code: BackspaceKey})
+		case b == '\t':
+			keys = append(keys, Key{Code: TabKey})
+		case b == 0x03 || b == 0x04:
+			keys = append(keys, Key{Code: InterruptKey})
+		case b < 0x20:
+			// Other control characters
+		default:
+			r, size := utf8.DecodeRune(input)
+			keys = append(keys, Key{Code: RuneKey, Rune: r})
+			input = input[size:]
+			continue
+		}
+		input = input[1:]
+	}
+	return
+}
+
+// escapeSequenceSize returns the length of the escape sequence at the beginning of the input,
+// i.e. 1 for a lone escape key.
+func escapeSequenceSize(input []byte) int {
+	if len(input) < 2 {
+		return 1
+	}
+	switch input[1] {
+	case '[':
+		// CSI: parameters, then a final byte in the 0x40-0x7e range
+		for i := 2; i < len(input); i++ {
+			if input[i] >= 0x40 && input[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(input)
+	case 'O':
+		if len(input) >= 3 {
+			return 3
+		}
+		return len(input)
+	}
+	return 1
+}
@@ -0,0 +1,168 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/adirelle/docker-graph/src/go/lib/docker/containers"
+	"github.com/adirelle/docker-graph/src/go/lib/utils"
+)
+
+type (
+	NodeKind int
+
+	// Node is an entry of the container tree.
+	Node struct {
+		Kind  NodeKind
+		Label string
+		// Container is the container the entry belongs to, if any.
+		Container *containers.Container
+		Children  []*Node
+	}
+
+	// Line is a node with the prefix that draws its branch of the tree.
+	Line struct {
+		Prefix string
+		Node   *Node
+	}
+)
+
+const (
+	HostNode NodeKind = iota
+	ProjectNode
+	ServiceNode
+	ContainerNode
+	// ResourceNode is a network, a mount, a port or a dependency of a container.
+	ResourceNode
+
+	noProject = "(no project)"
+)
+
+// BuildTree arranges the containers as trees of hosts, projects and services,
+// with their networks, mounts, ports and dependencies. The containers that do not match are left out.
+func BuildTree(hosts []string, ctns []containers.Container, match func(*containers.Container) bool) []*Node {
+	byHost := make(map[string]map[string]map[string][]*containers.Container, len(hosts))
+	for _, host := range hosts {
+		byHost[host] = make(map[string]map[string][]*containers.Container)
+	}
+	for i := range ctns {
+		ctn := &ctns[i]
+		if match != nil && !match(ctn) {
+			continue
+		}
+		project := noProject
+		if ctn.Project != nil {
+			project = ctn.Project.Name
+		}
+		byProject, found := byHost[ctn.Host]
+		if !found {
+			continue
+		}
+		if byProject[project] == nil {
+			byProject[project] = make(map[string][]*containers.Container)
+		}
+		byProject[project][ctn.Service] = append(byProject[project][ctn.Service], ctn)
+	}
+
+	roots := make([]*Node, len(hosts))
+	for i, host := range hosts {
+		root := &Node{Kind: HostNode, Label: host}
+		byProject := byHost[host]
+		for _, project := range sortedProjects(byProject) {
+			projectNode := root.add(ProjectNode, project, nil)
+			byService := byProject[project]
+			for _, service := range utils.SortedKeys(byService) {
+				parent := projectNode
+				if service != "" {
+					parent = projectNode.add(ServiceNode, service, nil)
+				}
+				ctns := byService[service]
+				sort.Slice(ctns, func(i, j int) bool { return ctns[i].Name < ctns[j].Name })
+				for _, ctn := range ctns {
+					parent.Children = append(parent.Children, containerNode(ctn))
+				}
+			}
+		}
+		roots[i] = root
+	}
+	return roots
+}
+
+// WriteTree prints the trees as plain text.
+func WriteTree(w io.Writer, roots []*Node) error {
+	buf := bufio.NewWriter(w)
+	for _, line := range Flatten(roots) {
+		fmt.Fprintln(buf, line.Prefix+line.Node.Label)
+	}
+	return buf.Flush()
+}
+
+// Flatten lists the nodes of the trees, in display order.
+func Flatten(roots []*Node) (lines []Line) {
+	for _, root := range roots {
+		lines = root.flatten(lines, "", "")
+	}
+	return
+}
+
+func containerNode(ctn *containers.Container) *Node {
+	status := string(ctn.Status)
+	if ctn.Healthy != "" {
+		status += ", " + ctn.Healthy
+	}
+	node := &Node{Kind: ContainerNode, Label: fmt.Sprintf("%s [%s] %s", ctn.Name, status, ctn.Image), Container: ctn}
+	for _, name := range utils.SortedKeys(ctn.Networks) {
+		node.add(ResourceNode, "network "+name, ctn)
+	}
+	for _, mount := range ctn.Mounts {
+		source := mount.Source
+		if mount.Type == "volume" {
+			source = mount.Name
+		}
+		access := "ro"
+		if mount.ReadWrite {
+			access = "rw"
+		}
+		node.add(ResourceNode, fmt.Sprintf("%s %s -> %s (%s)", mount.Type, source, mount.Destination, access), ctn)
+	}
+	for _, inner := range utils.SortedKeys(ctn.Ports) {
+		port := ctn.Ports[inner]
+		ip := port.HostIp
+		if ip == "" {
+			ip = "0.0.0.0"
+		}
+		node.add(ResourceNode, fmt.Sprintf("port %s:%d -> %s", ip, port.HostPort, inner), ctn)
+	}
+	for _, dep := range ctn.Dependencies {
+		node.add(ResourceNode, dep.String(), ctn)
+	}
+	return node
+}
+
+func (n *Node) add(kind NodeKind, label string, ctn *containers.Container) *Node {
+	child := &Node{Kind: kind, Label: label, Container: ctn}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// flatten appends the node after the first prefix, and its children after the second one.
+func (n *Node) flatten(lines []Line, prefix, childPrefix string) []Line {
+	lines = append(lines, Line{prefix, n})
+	for i, child := range n.Children {
+		if i < len(n.Children)-1 {
+			lines = child.flatten(lines, childPrefix+"├── ", childPrefix+"│   ")
+		} else {
+			lines = child.flatten(lines, childPrefix+"└── ", childPrefix+"    ")
+		}
+	}
+	return lines
+}
+
+// sortedProjects returns the project names, sorted, with the containers without project last.
+func sortedProjects[V any](byProject map[string]V) []string {
+	names := utils.SortedKeys(byProject)
+	sort.SliceStable(names, func(i, j int) bool { return names[i] != noProject && names[j] == noProject })
+	return names
+}
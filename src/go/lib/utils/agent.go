@@ -78,6 +78,9 @@ func (c updateCmd[T]) Execute(a *Agent[T], ctx context.Context) {
 	defer close(c.result)
 	result := agentResult[T]{}
 	result.value, result.err = c.update(a.value)
+	if result.err == nil {
+		a.value = result.value
+	}
 	select {
 	case c.result <- result:
 	case <-ctx.Done():
@@ -3,6 +3,9 @@ package utils
 import (
 	"context"
 	"sync"
+	"time"
+
+	"github.com/adirelle/docker-graph/src/go/lib/metrics"
 
 	log "github.com/inconshreveable/log15"
 	"github.com/thejerf/suture/v4"
@@ -11,10 +14,19 @@ import (
 type (
 	Dispatcher[T any] struct {
 		*Agent[subscribers[T]]
-		NewSubscriberHook func(chan<- T)
+		NewSubscriberHooks []func() []T
+
+		name     string
+		buffer   int
+		duration *metrics.Histogram
 	}
 
-	subscribers[T any] [](chan T)
+	subscribers[T any] []subscriber[T]
+
+	subscriber[T any] struct {
+		c    chan T
+		done chan struct{}
+	}
 )
 
 var (
@@ -23,36 +35,78 @@ var (
 	Log = log.New()
 )
 
-func NewDispatcher[T any]() *Dispatcher[T] {
-	return &Dispatcher[T]{Agent: NewAgent[subscribers[T]](nil)}
+// NewDispatcher creates a dispatcher ; name labels the durations of its dispatches, which are not measured
+// when it is empty, e.g. when the owner of the dispatcher measures them itself.
+func NewDispatcher[T any](name string) *Dispatcher[T] {
+	d := &Dispatcher[T]{Agent: NewAgent[subscribers[T]](nil)}
+	if name != "" {
+		d.duration = metrics.DispatchDuration.With(name)
+	}
+	return d
+}
+
+// NewLossyDispatcher creates a dispatcher that does not wait for its subscribers: each one has a buffer of the given
+// size, and the values that do not fit in it are dropped ; this suits the values that are soon superseded, like the stats.
+func NewLossyDispatcher[T any](name string, buffer int) *Dispatcher[T] {
+	d := NewDispatcher[T](name)
+	d.name, d.buffer = name, buffer
+	return d
 }
 
-func (d *Dispatcher[T]) OnNewSubscriber(hook func(chan<- T)) {
-	d.NewSubscriberHook = hook
+// OnNewSubscriber registers a hook providing the values to send to new subscribers.
+func (d *Dispatcher[T]) OnNewSubscriber(hook func() []T) {
+	d.NewSubscriberHooks = append(d.NewSubscriberHooks, hook)
 }
 
+// Prime collects the values provided by the new subscriber hooks.
+func (d *Dispatcher[T]) Prime() (values []T) {
+	for _, hook := range d.NewSubscriberHooks {
+		values = append(values, hook()...)
+	}
+	return
+}
+
+// Subscribe returns a channel that receives the values provided by the new subscriber hooks, then the dispatched values.
 func (d *Dispatcher[T]) Subscribe() (c <-chan T, cancel func()) {
-	bidiChan := make(chan T)
-	c = bidiChan
+	sub, cancel := d.subscribe()
+	primed := d.Prime()
+	go func() {
+		for _, value := range primed {
+			select {
+			case sub.c <- value:
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+	return sub.c, cancel
+}
+
+// SubscribeWithoutHooks returns a channel that only receives the dispatched values.
+func (d *Dispatcher[T]) SubscribeWithoutHooks() (c <-chan T, cancel func()) {
+	sub, cancel := d.subscribe()
+	return sub.c, cancel
+}
+
+func (d *Dispatcher[T]) subscribe() (sub subscriber[T], cancel func()) {
+	sub = subscriber[T]{make(chan T, d.buffer), make(chan struct{})}
 	_, _ = d.Agent.Update(func(subs subscribers[T]) (subscribers[T], error) {
-		subs = append(subs, bidiChan)
-		Log.Debug("added subscriber", "c", bidiChan)
+		subs = append(subs, sub)
+		Log.Debug("added subscriber", "c", sub.c)
 		return subs, nil
 	})
-	if d.NewSubscriberHook != nil {
-		go d.NewSubscriberHook(bidiChan)
-	}
 	cancel = func() {
 		_, _ = d.Agent.Update(func(subs subscribers[T]) (subscribers[T], error) {
 			j := 0
-			for i, sub := range subs {
-				if sub != bidiChan {
+			for i, other := range subs {
+				if other.c != sub.c {
 					subs[j] = subs[i]
 					j++
 				}
 			}
-			Log.Debug("removed subscriber", "c", c)
-			close(bidiChan)
+			Log.Debug("removed subscriber", "c", sub.c)
+			// Do not close the value channel, as Dispatch could be sending to it
+			close(sub.done)
 			return subs[:j], nil
 		})
 	}
@@ -60,6 +114,9 @@ func (d *Dispatcher[T]) Subscribe() (c <-chan T, cancel func()) {
 }
 
 func (d *Dispatcher[T]) Dispatch(value T, ctx context.Context) (err error) {
+	if d.duration != nil {
+		defer d.duration.ObserveSince(time.Now())
+	}
 	subs, err := d.Agent.Get()
 	if err != nil {
 		return err
@@ -68,13 +125,18 @@ func (d *Dispatcher[T]) Dispatch(value T, ctx context.Context) (err error) {
 	if len(subs) == 0 {
 		return
 	}
+	if d.buffer > 0 {
+		d.dispatchLossy(value, subs)
+		return
+	}
 	wg := sync.WaitGroup{}
 	wg.Add(len(subs))
 	for _, target := range subs {
-		go func(target chan<- T) {
+		go func(target subscriber[T]) {
 			defer wg.Done()
 			select {
-			case target <- value:
+			case target.c <- value:
+			case <-target.done:
 			case <-ctx.Done():
 				err = ctx.Err()
 				return
@@ -84,3 +146,17 @@ func (d *Dispatcher[T]) Dispatch(value T, ctx context.Context) (err error) {
 	wg.Wait()
 	return
 }
+
+func (d *Dispatcher[T]) dispatchLossy(value T, subs subscribers[T]) {
+	for _, target := range subs {
+		select {
+		case target.c <- value:
+		case <-target.done:
+		default:
+			Log.Debug("dropped value of a lagging subscriber", "c", target.c)
+			if d.name != "" {
+				metrics.DroppedValues.Inc(d.name)
+			}
+		}
+	}
+}
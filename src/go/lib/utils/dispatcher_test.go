@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thejerf/suture/v4"
+)
+
+func serve(t *testing.T, service suture.Service) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = service.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestLossyDispatcherDoesNotWaitForTheSubscribers(t *testing.T) {
+	d := NewLossyDispatcher[int]("", 2)
+	serve(t, d)
+
+	stuck, cancelStuck := d.Subscribe()
+	defer cancelStuck()
+	reader, cancelReader := d.Subscribe()
+	defer cancelReader()
+
+	received := make(chan int)
+	go func() {
+		for value := range reader {
+			received <- value
+		}
+	}()
+
+	for i := 1; i <= 5; i++ {
+		dispatched := make(chan error, 1)
+		go func(i int) { dispatched <- d.Dispatch(i, context.Background()) }(i)
+		select {
+		case err := <-dispatched:
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("dispatch %d blocked by a stuck subscriber", i)
+		}
+		select {
+		case value := <-received:
+			if value != i {
+				t.Errorf("unexpected value: %d, want %d", value, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("value %d not received", i)
+		}
+	}
+
+	// The stuck subscriber only gets the values that fit in its buffer
+	for _, want := range []int{1, 2} {
+		if value := <-stuck; value != want {
+			t.Errorf("unexpected value: %d, want %d", value, want)
+		}
+	}
+	select {
+	case value := <-stuck:
+		t.Errorf("unexpected value: %d", value)
+	default:
+	}
+}
+
+func TestDispatcherWaitsForTheSubscribers(t *testing.T) {
+	d := NewDispatcher[int]("")
+	serve(t, d)
+
+	stuck, cancel := d.Subscribe()
+	defer cancel()
+
+	ctx, cancelDispatch := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelDispatch()
+	if err := d.Dispatch(1, ctx); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	dispatched := make(chan error, 1)
+	go func() { dispatched <- d.Dispatch(2, context.Background()) }()
+	if value := <-stuck; value != 2 {
+		t.Errorf("unexpected value: %d, want 2", value)
+	}
+	if err := <-dispatched; err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
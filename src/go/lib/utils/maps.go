@@ -0,0 +1,13 @@
+package utils
+
+import "sort"
+
+// SortedKeys returns the keys of the map, sorted.
+func SortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
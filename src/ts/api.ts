@@ -1,10 +1,19 @@
 
 export interface EventBase {
+  Host?: string;
   TargetID: string;
   TargetType: string;
   Type: string;
   Time: string;
   Details?: object;
+  // What changed since the previous event about the same target, as a JSON patch
+  Changes?: PatchOperation[];
+}
+
+export interface PatchOperation {
+  op: "add" | "remove" | "replace";
+  path: string;
+  value?: unknown;
 }
 
 export interface UpdatedEvent extends EventBase {
@@ -20,19 +29,124 @@ export interface ContainerUpdated extends UpdatedEvent {
   Details: Container;
 }
 
-export type Event = ContainerUpdated | RemovedEvent;
+export interface NetworkUpdated extends UpdatedEvent {
+  TargetType: "network";
+  Details: NetworkDetails;
+}
+
+export interface VolumeUpdated extends UpdatedEvent {
+  TargetType: "volume";
+  Details: VolumeDetails;
+}
+
+export interface ImageUpdated extends UpdatedEvent {
+  TargetType: "image";
+  Details: ImageDetails;
+}
+
+export interface SwarmNodeUpdated extends UpdatedEvent {
+  TargetType: "node";
+  Details: SwarmNode;
+}
+
+export interface ServiceUpdated extends UpdatedEvent {
+  TargetType: "service";
+  Details: Service;
+}
+
+export interface TaskUpdated extends UpdatedEvent {
+  TargetType: "task";
+  Details: Task;
+}
+
+export interface ConfigUpdated extends UpdatedEvent {
+  TargetType: "config";
+  Details: Config;
+}
+
+export interface SecretUpdated extends UpdatedEvent {
+  TargetType: "secret";
+  Details: Secret;
+}
+
+// Only sent to the clients that ask for them, with the "stats" query parameter
+export interface ContainerStatsEvent extends EventBase {
+  TargetType: "container";
+  Type: "stats";
+  Details: ContainerStats;
+}
+
+export interface StreamEvent extends EventBase {
+  TargetType: "stream";
+  Type: "resync" | "synced" | "reset" | "daemon-disconnected";
+}
+
+export type Event = ContainerUpdated | NetworkUpdated | VolumeUpdated | ImageUpdated
+  | SwarmNodeUpdated | ServiceUpdated | TaskUpdated | ConfigUpdated | SecretUpdated
+  | StreamEvent | RemovedEvent | ContainerStatsEvent;
 
 export interface Container {
   ID: string;
+  Host: string;
   Name: string;
   Status: string;
   Image: string;
+  ImageID: string;
   Healty: string;
   Service?: string;
   Project?: Project;
   Networks?: Networks;
   Mounts?: Mount[];
   Ports?: Ports;
+  Dependencies?: Dependency[];
+  Groups?: Group[];
+  Labels?: { [key: string]: string };
+  // The values of the variables that are not allowed by the server are null
+  Env?: { [name: string]: string | null };
+  Entrypoint?: string[];
+  Cmd?: string[];
+  WorkingDir?: string;
+  User?: string;
+  // Formatted like the --restart option, e.g. "on-failure:3"
+  RestartPolicy?: string;
+  RestartCount?: number;
+  ExitCode?: number;
+  OOMKilled?: boolean;
+  StartedAt?: string;
+  FinishedAt?: string;
+}
+
+export interface ContainerStats {
+  Host: string;
+  ID: string;
+  // Average over the interval, 100 is a whole CPU
+  CPUPercent: number;
+  MemoryUsage: number;
+  MemoryLimit: number;
+  // Bytes transferred since the container started
+  NetworkRx: number;
+  NetworkTx: number;
+  BlockRead: number;
+  BlockWrite: number;
+}
+
+// Group is the membership of a container in a hierarchy of labels
+export interface Group {
+  // The comma-separated names of the labels
+  Grouping: string;
+  // The values of the labels, from the top of the hierarchy
+  Path: string[];
+}
+
+export type DependencyKind = "depends_on" | "link" | "network_mode" | "volumes_from";
+
+// Dependency refers either to a service of the same project, or to a container by name or ID
+export interface Dependency {
+  Kind: DependencyKind;
+  Service?: string;
+  Container?: string;
+  Condition?: string;
+  Alias?: string;
 }
 
 export interface Image {
@@ -41,6 +155,16 @@ export interface Image {
   Tag: string;
 }
 
+export interface ImageDetails {
+  ID: string;
+  Host: string;
+  CreatedAt: string;
+  RepoTags?: string[];
+  RepoDigests?: string[];
+  Size: number;
+  Parents?: string[];
+}
+
 export interface Project {
   Name: string;
   WorkingDir: string;
@@ -59,6 +183,109 @@ export interface Network {
   Name: string;
 }
 
+export interface NetworkDetails {
+  ID: string;
+  Host: string;
+  Name: string;
+  Driver: string;
+  Scope: string;
+  Internal: boolean;
+  Attachable: boolean;
+  Subnets?: Subnet[];
+  Labels?: Labels;
+  Project?: Project;
+}
+
+export interface Subnet {
+  Subnet: string;
+  Gateway?: string;
+}
+
+export interface VolumeDetails {
+  Name: string;
+  Host: string;
+  Driver: string;
+  Mountpoint: string;
+  Scope: string;
+  Labels?: Labels;
+  Project?: Project;
+  Usage?: VolumeUsage;
+}
+
+export interface VolumeUsage {
+  Size: number;
+  RefCount: number;
+}
+
+export interface SwarmNode {
+  ID: string;
+  Host: string;
+  Hostname: string;
+  Role: string;
+  Availability: string;
+  State: string;
+  Addr?: string;
+  Leader: boolean;
+  EngineVersion?: string;
+  Labels?: Labels;
+}
+
+export interface Service {
+  ID: string;
+  Host: string;
+  Name: string;
+  Image: string;
+  Mode: string;
+  Replicas?: number;
+  Networks?: string[];
+  Configs?: string[];
+  Secrets?: string[];
+  Ports?: ServicePort[];
+  Labels?: Labels;
+  Project?: Project;
+}
+
+export interface ServicePort {
+  Protocol: string;
+  TargetPort: number;
+  PublishedPort?: number;
+  PublishMode: string;
+}
+
+export interface Task {
+  ID: string;
+  Host: string;
+  Name: string;
+  ServiceID: string;
+  NodeID?: string;
+  Slot?: number;
+  State: string;
+  DesiredState: string;
+  Message?: string;
+  Error?: string;
+  ContainerID?: string;
+  Networks?: string[];
+}
+
+export interface Config {
+  ID: string;
+  Host: string;
+  Name: string;
+  Labels?: Labels;
+}
+
+export interface Secret {
+  ID: string;
+  Host: string;
+  Name: string;
+  Driver?: string;
+  Labels?: Labels;
+}
+
+export interface Labels {
+  [name: string]: string;
+}
+
 export interface Mount {
   Name: string;
   Type: string;
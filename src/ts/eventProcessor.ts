@@ -1,45 +1,275 @@
-import { Container, Event } from "./api";
+import { Config, Container, ContainerStats, Dependency, Event, ImageDetails, NetworkDetails, Secret, Service, SwarmNode, Task, VolumeDetails } from "./api";
 import { NodeModel } from "./models";
-import { parseImage, shortName, shortPath } from "./utils";
+import { parseImage, shortID, shortName, shortPath } from "./utils";
 
 export type NodeUpdateFunc = (node: NodeModel, updater: Updater) => void;
 
+// Builds node IDs that do not collide between Docker hosts
+export type NodeIDFunc = (id: string) => string;
+
 export interface Updater {
   updateNode(id: string, update: NodeUpdateFunc): void;
   removeNode(id: string): void;
+  clear(): void;
   updateLink(sourceID: string, targetID: string, update: NodeUpdateFunc): void;
   tidy(): void;
 }
 
 export class EventProcessor {
+  // The last known state of the containers, by node ID, to resolve their dependencies
+  private readonly containers = new Map<string, Container>();
 
   public constructor(
     private readonly updaterFactory: () => Updater
   ) { }
 
   public process(event: Event): boolean {
-    if (event.TargetType != "container") {
+    if (!["container", "network", "volume", "image", "node", "service", "task", "config", "secret", "stream"].includes(event.TargetType)) {
       return false;
     }
     const updater = this.updaterFactory();
-    if (event.Type == "removed") {
-      updater.removeNode(event.TargetID);
+    if (event.TargetType == "stream") {
+      // The server could not resume the stream, the whole state is going to be sent again
+      if (event.Type == "resync") {
+        updater.clear();
+        this.containers.clear();
+      }
     } else {
-      updater.updateNode(event.TargetID, (n, u) => this.updateContainer(n, event.Details, u));
+      const nid: NodeIDFunc = (id) => event.Host ? `${event.Host}/${id}` : id;
+      const id = nid(event.TargetID);
+      if (event.Type == "removed") {
+        updater.removeNode(id);
+        if (event.TargetType == "container" && this.containers.delete(id)) {
+          this.updateDependents(event.Host, updater, nid);
+        }
+      } else if (event.Type == "stats") {
+        if (!this.containers.has(id)) {
+          return false;
+        }
+        updater.updateNode(id, (n) => this.updateStats(n, event.Details));
+      } else if (event.TargetType == "container") {
+        this.containers.set(id, event.Details);
+        updater.updateNode(id, (n, u) => this.updateContainer(n, event.Details, u, nid));
+        this.updateDependents(event.Host, updater, nid);
+      } else if (event.TargetType == "network") {
+        updater.updateNode(id, (n) => this.updateNetwork(n, event.Details));
+      } else if (event.TargetType == "volume") {
+        updater.updateNode(id, (n) => this.updateVolume(n, event.Details));
+      } else if (event.TargetType == "image") {
+        updater.updateNode(id, (n, u) => this.updateImage(n, event.Details, u, nid));
+      } else if (event.TargetType == "node") {
+        updater.updateNode(id, (n) => this.updateSwarmNode(n, event.Details));
+      } else if (event.TargetType == "service") {
+        updater.updateNode(id, (n, u) => this.updateService(n, event.Details, u, nid));
+      } else if (event.TargetType == "task") {
+        updater.updateNode(id, (n, u) => this.updateTask(n, event.Details, u, nid));
+      } else if (event.TargetType == "config") {
+        updater.updateNode(id, (n) => this.updateConfig(n, event.Details));
+      } else {
+        updater.updateNode(id, (n) => this.updateSecret(n, event.Details));
+      }
     }
     updater.tidy();
     return true;
   }
 
-  private updateContainer(node: NodeModel, ctn: Container, updater: Updater): void {
+  private updateNetwork(node: NodeModel, net: NetworkDetails): void {
+    node.type = "network";
+    node.label = shortName(net.Name || net.ID, net.Project);
+    node.tooltip = makeTooltip(
+      "network", net.Name,
+      "id", net.ID,
+      "driver", net.Driver,
+      "scope", net.Scope,
+      "subnets", (net.Subnets || []).map(s => s.Subnet).join(", ") || "none",
+      "internal?", net.Internal ? "yes" : "no",
+      "project", net.Project?.Name || "none"
+    );
+  }
+
+  private updateVolume(node: NodeModel, vol: VolumeDetails): void {
+    node.type = "volume";
+    node.label = shortName(vol.Name, vol.Project);
+    node.tooltip = makeTooltip(
+      "volume", vol.Name,
+      "driver", vol.Driver,
+      "mountpoint", vol.Mountpoint,
+      "scope", vol.Scope,
+      "size", vol.Usage && vol.Usage.Size >= 0 ? `${vol.Usage.Size} bytes` : "unknown",
+      "containers", vol.Usage && vol.Usage.RefCount >= 0 ? `${vol.Usage.RefCount}` : "unknown",
+      "project", vol.Project?.Name || "none"
+    );
+  }
+
+  private updateImage(node: NodeModel, img: ImageDetails, updater: Updater, nid: NodeIDFunc): void {
+    const tags = img.RepoTags || [];
+    node.type = "image";
+    node.label = tags.length > 0 ? parseImage(tags[0]).Name : shortID(img.ID.replace(/^sha256:/, ""));
+    node.tooltip = makeTooltip(
+      "image", img.ID,
+      "tags", tags.join(", ") || "none",
+      "size", `${img.Size} bytes`,
+      "created", img.CreatedAt
+    );
+    if (tags.length == 0) {
+      // Untagged images are usually stale ones, replaced by a more recent pull
+      node.color = '#888';
+    } else {
+      delete node.color;
+    }
+    const parent = (img.Parents || [])[0];
+    if (parent) {
+      updater.updateLink(nid(img.ID), nid(parent), (node) => {
+        node.type = "image";
+        node.label ||= shortID(parent.replace(/^sha256:/, ""));
+      });
+    }
+  }
+
+  private updateSwarmNode(node: NodeModel, swarmNode: SwarmNode): void {
+    node.type = "node";
+    node.label = swarmNode.Hostname || shortID(swarmNode.ID);
+    node.tooltip = makeTooltip(
+      "node", swarmNode.Hostname,
+      "id", swarmNode.ID,
+      "role", swarmNode.Leader ? `${swarmNode.Role} (leader)` : swarmNode.Role,
+      "availability", swarmNode.Availability,
+      "state", swarmNode.State,
+      "address", swarmNode.Addr || "unknown",
+      "engine", swarmNode.EngineVersion || "unknown"
+    );
+    if (swarmNode.State != "ready") {
+      node.color = '#888';
+    } else {
+      delete node.color;
+    }
+  }
+
+  private updateService(node: NodeModel, svc: Service, updater: Updater, nid: NodeIDFunc): void {
+    const svcID = nid(svc.ID);
+    node.type = "service";
+    node.label = shortName(svc.Name, svc.Project);
+    node.tooltip = makeTooltip(
+      "service", svc.Name,
+      "id", svc.ID,
+      "image", svc.Image,
+      "mode", svc.Replicas !== undefined ? `${svc.Mode} (${svc.Replicas})` : svc.Mode,
+      "ports", (svc.Ports || []).map(p => `${p.PublishedPort || "-"}:${p.TargetPort}/${p.Protocol}`).join(", ") || "none",
+      "stack", svc.Project?.Name || "none"
+    );
+    for (const netID of (svc.Networks || [])) {
+      updater.updateLink(svcID, nid(netID), (node) => {
+        node.type = "network";
+        node.label ||= shortID(netID);
+      });
+    }
+    for (const configID of (svc.Configs || [])) {
+      updater.updateLink(svcID, nid(configID), (node) => {
+        node.type = "config";
+        node.label ||= shortID(configID);
+      });
+    }
+    for (const secretID of (svc.Secrets || [])) {
+      updater.updateLink(svcID, nid(secretID), (node) => {
+        node.type = "secret";
+        node.label ||= shortID(secretID);
+      });
+    }
+  }
+
+  private updateTask(node: NodeModel, task: Task, updater: Updater, nid: NodeIDFunc): void {
+    const taskID = nid(task.ID);
+    node.type = "task";
+    node.label = task.Name || shortID(task.ID);
+    node.tooltip = makeTooltip(
+      "task", task.Name,
+      "id", task.ID,
+      "state", task.State,
+      "desired state", task.DesiredState,
+      "message", task.Error || task.Message || "none"
+    );
+    switch (task.State) {
+      case 'running':
+        node.color = '#070';
+        break;
+      case 'failed':
+      case 'rejected':
+        node.color = '#a00';
+        break;
+      default:
+        delete node.color;
+    }
+    updater.updateLink(taskID, nid(task.ServiceID), (node) => {
+      node.type = "service";
+      node.label ||= shortID(task.ServiceID);
+    });
+    if (task.NodeID) {
+      const nodeID = task.NodeID;
+      updater.updateLink(taskID, nid(nodeID), (node) => {
+        node.type = "node";
+        node.label ||= shortID(nodeID);
+      });
+    }
+    if (task.ContainerID) {
+      const ctnID = task.ContainerID;
+      updater.updateLink(taskID, nid(ctnID), (node) => {
+        node.type = "container";
+        node.label ||= shortID(ctnID);
+      });
+    }
+  }
+
+  // updateDependents refreshes the links of the containers of the host that have dependencies,
+  // as the containers they depend on may have been created or removed
+  private updateDependents(host: string | undefined, updater: Updater, nid: NodeIDFunc): void {
+    for (const [id, ctn] of this.containers) {
+      if (ctn.Host == host && ctn.Dependencies?.length) {
+        updater.updateNode(id, (n, u) => this.updateContainer(n, ctn, u, nid));
+      }
+    }
+  }
+
+  private updateConfig(node: NodeModel, config: Config): void {
+    node.type = "config";
+    node.label = config.Name;
+    node.tooltip = makeTooltip("config", config.Name, "id", config.ID);
+  }
+
+  private updateSecret(node: NodeModel, secret: Secret): void {
+    node.type = "secret";
+    node.label = secret.Name;
+    node.tooltip = makeTooltip("secret", secret.Name, "id", secret.ID, "driver", secret.Driver || "internal");
+  }
+
+  private updateStats(node: NodeModel, stats: ContainerStats): void {
+    node.load = stats.CPUPercent / 100;
+    node.usage = makeTooltip(
+      "cpu", `${stats.CPUPercent.toFixed(1)}%`,
+      "memory", `${formatBytes(stats.MemoryUsage)} / ${formatBytes(stats.MemoryLimit)}`,
+      "network", `${formatBytes(stats.NetworkRx)} in, ${formatBytes(stats.NetworkTx)} out`,
+      "block io", `${formatBytes(stats.BlockRead)} read, ${formatBytes(stats.BlockWrite)} written`
+    );
+  }
+
+  private updateContainer(node: NodeModel, ctn: Container, updater: Updater, nid: NodeIDFunc): void {
+    const ctnID = nid(ctn.ID);
     node.type = "container";
     node.label = shortName(ctn.Name || ctn.ID, ctn.Project);
     node.tooltip = makeTooltip(
       "container", ctn.Name,
       "id", ctn.ID,
+      "host", ctn.Host,
       "status", ctn.Status,
-      "project", ctn.Project?.Name || "none"
+      "project", ctn.Project?.Name || "none",
+      "groups", (ctn.Groups || []).map(g => g.Path.join(" / ")).join(", ") || "none",
+      "command", [...(ctn.Entrypoint || []), ...(ctn.Cmd || [])].join(" ") || "none",
+      "restart", `${ctn.RestartPolicy || "no"} (${ctn.RestartCount || 0} restarts)`,
+      "exit code", ctn.Status === "running" ? "none" : `${ctn.ExitCode || 0}${ctn.OOMKilled ? " (OOM killed)" : ""}`
     );
+    if (ctn.Status != "running") {
+      delete node.load;
+      delete node.usage;
+    }
     switch (ctn.Status) {
       case 'running':
         node.color = '#070';
@@ -52,12 +282,12 @@ export class EventProcessor {
         delete node.color;
     }
 
-    const imageID = `img:${ctn.Image}`;
-    updater.updateLink(ctn.ID, imageID, (node) => {
+    const imageID = nid(ctn.ImageID || `img:${ctn.Image}`);
+    updater.updateLink(ctnID, imageID, (node) => {
       node.type = "image";
       const { Name, Registry, Tag } = parseImage(ctn.Image);
-      node.label = shortName(Name, ctn.Project);
-      node.tooltip = makeTooltip(
+      node.label ||= shortName(Name, ctn.Project);
+      node.tooltip ||= makeTooltip(
         "image", ctn.Image,
         "registry", Registry,
         "name", Name,
@@ -67,7 +297,7 @@ export class EventProcessor {
 
     for (const net of Object.values(ctn.Networks || {})) {
       if (net.ID == "") continue;
-      updater.updateLink(ctn.ID, net.ID, (node) => {
+      updater.updateLink(ctnID, nid(net.ID), (node) => {
         node.type = "network";
         node.label = shortName(net.Name || net.ID, ctn.Project);
       });
@@ -76,7 +306,7 @@ export class EventProcessor {
     for (const mount of (ctn.Mounts || [])) {
       switch (mount.Type) {
         case "bind":
-          updater.updateLink(ctn.ID, mount.Source, (node) => {
+          updater.updateLink(ctnID, nid(mount.Source), (node) => {
             node.type = "bindMount";
             node.label = shortPath(mount.Source, ctn.Project);
             node.tooltip = makeTooltip(
@@ -88,26 +318,32 @@ export class EventProcessor {
           });
           break;
         case "volume":
-          updater.updateLink(ctn.ID, mount.Source, (node) => {
+          updater.updateLink(ctnID, nid(mount.Name), (node) => {
             node.type = "volume";
             node.label = shortName(mount.Name, ctn.Project);
-            node.tooltip = makeTooltip(
+            node.tooltip ||= makeTooltip(
               "volume", mount.Name,
-              "source", mount.Source,
-              "destination", mount.Destination,
-              "writable?", mount.ReadWrite ? "yes" : "no"
+              "source", mount.Source
             );
           });
           break;
       }
     }
 
+    for (const dep of (ctn.Dependencies || [])) {
+      for (const [otherID, other] of this.containers) {
+        if (other.Host == ctn.Host && dependsOn(ctn, dep, other)) {
+          updater.updateLink(ctnID, otherID, (node, updater) => this.updateContainer(node, other, updater, nid));
+        }
+      }
+    }
+
     for (const [inner, binding] of Object.entries(ctn.Ports || {})) {
-      const id = `${ctn.ID}:${inner}`;
-      updater.updateLink(ctn.ID, id, (node) => {
+      const id = `${ctnID}:${inner}`;
+      updater.updateLink(ctnID, id, (node) => {
         node.type = "port",
           node.label = inner;
-        updater.updateLink(id, `IP:${binding.HostIp}`, (node) => {
+        updater.updateLink(id, nid(`IP:${binding.HostIp}`), (node) => {
           node.type = "hostIP";
           node.label = binding.HostIp;
         });
@@ -116,6 +352,31 @@ export class EventProcessor {
   }
 }
 
+// The IDs that can be abbreviated, as the names can also be made of hexadecimal digits
+const SHORT_ID_PATTERN = /^[0-9a-f]{12,64}$/;
+
+function dependsOn(ctn: Container, dep: Dependency, other: Container): boolean {
+  if (ctn.ID == other.ID) {
+    return false;
+  }
+  if (dep.Service) {
+    return other.Service == dep.Service && !!ctn.Project && !!other.Project
+      && ctn.Project.Name == other.Project.Name && ctn.Project.WorkingDir == other.Project.WorkingDir;
+  }
+  // Docker accepts short IDs, of at least 12 digits so they cannot be mistaken for names like "db"
+  return !!dep.Container && (other.Name == dep.Container || (SHORT_ID_PATTERN.test(dep.Container) && other.ID.startsWith(dep.Container)));
+}
+
+function formatBytes(bytes: number): string {
+  const units = ["B", "KiB", "MiB", "GiB", "TiB"];
+  let i = 0;
+  while (bytes >= 1024 && i < units.length - 1) {
+    bytes /= 1024;
+    i++;
+  }
+  return `${bytes.toFixed(i ? 1 : 0)} ${units[i]}`;
+}
+
 function makeTooltip(...parts: string[]): string {
   const lines = [];
   for (let i = 0, l = parts.length; i < l; i += 2) {
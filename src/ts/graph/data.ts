@@ -12,6 +12,12 @@ export class GraphData implements GraphModel {
     };
   }
 
+  public clear(): void {
+    this.nodes.clear();
+    this.links.clear();
+    console.debug("cleared graph");
+  }
+
   public removeNode(id: string): void {
     const node = this.nodes.get(id);
     if (!node) return;
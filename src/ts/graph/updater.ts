@@ -20,6 +20,10 @@ export class GraphUpdater implements Updater {
     this.graph.removeNode(id);
   }
 
+  public clear(): void {
+    this.graph.clear();
+  }
+
   public updateLink(sourceID: string, targetID: string, update: NodeUpdateFunc): void {
     let unvisitedLinks = this.unvisitedLinks.get(sourceID);
     if (!unvisitedLinks) {
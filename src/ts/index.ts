@@ -30,7 +30,10 @@ import { consumeEvents, debouncer, Status } from "./utils";
 
   const forceGraph = ForceGraph();
   forceGraph(graphElem)
-    .nodeLabel("tooltip")
+    .nodeLabel((node: NodeObject) => {
+      const { tooltip, usage } = node as NodeModel;
+      return usage ? `${tooltip}<br/>${usage}` : tooltip || "";
+    })
     .nodeCanvasObject((node: NodeObject, ctx, scale) => nodePainter.paint(node as NodeModel, ctx, scale))
     .nodePointerAreaPaint((node: NodeObject, color, ctx) => nodePainter.paintInteractionArea(node as NodeModel, color, ctx));
 
@@ -40,19 +43,41 @@ import { consumeEvents, debouncer, Status } from "./utils";
     forceGraph.graphData(data);
   });
 
+  const statusIcons: Record<Status, string> = {
+    open: 'wifi',
+    closed: 'wifi-slash',
+    loading: 'spinner fa-spin',
+    disconnected: 'plug-circle-xmark',
+  };
+  const setStatus = (status: Status) => {
+    statusElem.className = `fas fa-${statusIcons[status]}`;
+  };
+
+  // The query of the page, e.g. "?project=shop", filters the containers ; "?stats=1" shows their load
   consumeEvents(
-    "/api/events",
+    "/api/events" + window.location.search,
     ({ data }) => {
       const event = JSON.parse(data) as Event;
       console.debug("event", event);
+      if (event.TargetType == "stream") {
+        switch (event.Type) {
+          case "synced":
+            setStatus('open');
+            break;
+          case "reset":
+          case "resync":
+            setStatus('loading');
+            break;
+          case "daemon-disconnected":
+            setStatus('disconnected');
+            break;
+        }
+      }
       if (processor.process(event)) {
         trigger();
       }
     },
-    (status: Status) => {
-      const icon = status == 'open' ? 'wifi' : 'wifi-slash';
-      statusElem.className = `fas fa-${icon}`;
-    }
+    (status: Status) => setStatus(status == 'open' ? 'loading' : status)
   );
 })(
   document.getElementById("graph"),
@@ -1,12 +1,16 @@
 import { LinkObject, NodeObject } from "force-graph";
 
-export type NodeType = 'container' | 'network' | 'hostIP' | 'image' | 'bindMount' | 'port' | 'volume';
+export type NodeType = 'container' | 'network' | 'hostIP' | 'image' | 'bindMount' | 'port' | 'volume'
+  | 'node' | 'service' | 'task' | 'config' | 'secret';
 
 export interface NodeModel extends NodeObject {
   id: string;
   type: NodeType;
   label: string;
   tooltip?: string;
+  // The resource usage of the containers, when the stats are requested
+  load?: number;
+  usage?: string;
   color?: string;
   width?: number;
   height?: number;
@@ -21,6 +25,7 @@ export interface LinkModel extends LinkObject {
 export interface GraphModel {
   getOrCreateNode(id: string): NodeModel;
   removeNode(id: string): void;
+  clear(): void;
 
   getOrCreateLink(sourceID: string, targetID: string): LinkModel;
   removeLink(link: LinkModel): void;
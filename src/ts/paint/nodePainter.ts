@@ -29,6 +29,16 @@ export class NodePainter {
     this.iconRenderer.render(ctx, scale, icon, x, y);
     [node.width, node.height] = this.iconRenderer.measure(ctx, scale, icon);
 
+    if (node.load !== undefined) {
+      // An arc around the icon, full when a whole CPU is used
+      ctx.beginPath();
+      ctx.strokeStyle = node.load > 0.8 ? "#c00" : "#e80";
+      ctx.lineWidth = 1 / scale;
+      const radius = Math.max(node.width, node.height) / 2 + 1 / scale;
+      ctx.arc(x, y, radius, -Math.PI / 2, -Math.PI / 2 + 2 * Math.PI * Math.min(node.load, 1));
+      ctx.stroke();
+    }
+
     if (label) {
       y += node.height;
       this.labelRenderer.render(ctx, scale, label, x, y);
@@ -78,17 +78,25 @@ export function debouncer(delay: number, proc: () => void): () => void {
   };
 }
 
-export type Status = 'open' | 'closed';
+export type Status = 'open' | 'closed' | 'loading' | 'disconnected';
 
 export function consumeEvents(sourceURL: string, handler: (ev: MessageEvent) => void, statusHandler: (st: Status) => void = () => null): void {
   let restartHandle: number | null = null;
+  let lastEventId = "";
   const run = () => {
-    const source = new EventSource(sourceURL);
+    // Resume the stream where it stopped
+    const url = lastEventId ? `${sourceURL}?lastEventId=${encodeURIComponent(lastEventId)}` : sourceURL;
+    const source = new EventSource(url);
     const starting = Date.now();
     statusHandler('closed');
     restartHandle = null;
 
-    source.addEventListener("message", handler);
+    source.addEventListener("message", (ev: MessageEvent) => {
+      if (ev.lastEventId) {
+        lastEventId = ev.lastEventId;
+      }
+      handler(ev);
+    });
     source.addEventListener("open", () => statusHandler('open'));
     source.addEventListener("error", (ev: Event) => {
       source.close();